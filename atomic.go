@@ -0,0 +1,264 @@
+package gofs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/absfs/absfs"
+)
+
+// ErrTxDone is returned by the methods of a Tx that has already been
+// committed or rolled back.
+var ErrTxDone = errors.New("transaction already committed or rolled back")
+
+// siblingName returns a unique hidden name in the same directory as name,
+// so that renaming it to name never crosses a filesystem boundary.
+func siblingName(name, tag string) string {
+	var suffix [6]byte
+	rand.Read(suffix[:])
+	dir, base := "", name
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		dir, base = name[:i+1], name[i+1:]
+	}
+	return dir + "." + base + "." + tag + "-" + hex.EncodeToString(suffix[:])
+}
+
+// writeTemp writes data to a new temporary file next to name, syncs it and
+// returns its name. The temporary file gets the permissions of name if it
+// exists, and perm otherwise. It is removed on failure.
+func writeTemp(fsys absfs.Filer, name string, data []byte, perm os.FileMode) (string, error) {
+	tmp := siblingName(name, "tmp")
+	info, statErr := fsys.Stat(name)
+	if statErr == nil {
+		perm = info.Mode().Perm()
+	}
+	f, err := fsys.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return "", err
+	}
+	if statErr == nil {
+		// The creation mode is subject to the umask; the old one is not.
+		err = fsys.Chmod(tmp, perm)
+	}
+	if err == nil {
+		_, err = f.Write(data)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fsys.Remove(tmp)
+		return "", err
+	}
+	return tmp, nil
+}
+
+// replace renames tmp to name. On backends that refuse to rename over an
+// existing file, the old file is first moved aside and restored if the
+// rename fails, which leaves a moment where name does not exist but never
+// one where it holds partial contents.
+func replace(fsys absfs.Filer, tmp, name string) error {
+	err := fsys.Rename(tmp, name)
+	if !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	backup := siblingName(name, "bak")
+	if err := fsys.Rename(name, backup); err != nil {
+		return err
+	}
+	if err := fsys.Rename(tmp, name); err != nil {
+		fsys.Rename(backup, name)
+		return err
+	}
+	fsys.Remove(backup)
+	return nil
+}
+
+// WriteFileAtomic writes data to the named file, creating it with perm if
+// necessary; like os.WriteFile, it keeps the permissions of an existing
+// file. The data is written to a temporary file in the same directory,
+// synced and renamed over name, so a crash leaves either the old contents
+// or the new ones, never a partial write. On failure the temporary file is
+// removed and name is left untouched, although a crash can leave a
+// ".name.tmp-*" file behind.
+func WriteFileAtomic(fsys absfs.Filer, name string, data []byte, perm os.FileMode) error {
+	tmp, err := writeTemp(fsys, name, data, perm)
+	if err != nil {
+		return err
+	}
+	if err := replace(fsys, tmp, name); err != nil {
+		fsys.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// txOp is a staged change: a write when remove is false.
+type txOp struct {
+	name   string
+	data   []byte
+	perm   os.FileMode
+	remove bool
+
+	tmp    string // staged contents, for writes
+	backup string // where the previous file was moved, if it existed
+	done   bool   // whether the op has been applied to name
+}
+
+// Tx stages writes and removals of files and applies them all together.
+// Nothing is changed until Commit, which either applies every staged change
+// or, if any step fails, rolls back those already applied and leaves the
+// files as they were.
+//
+// Commit first writes every new file to a temporary name next to its
+// target, then moves each existing target aside and moves its replacement
+// into place, and finally deletes the moved-aside files, ignoring errors
+// since the commit has succeeded by then. Rollback is only
+// as reliable as the Rename of the underlying Filer; a crash in the middle
+// of Commit can leave temporary and backup files, named ".name.tmp-*" and
+// ".name.bak-*", next to the targets.
+//
+// A Tx is not safe for concurrent use.
+type Tx struct {
+	fsys absfs.Filer
+	ops  []*txOp
+	done bool
+}
+
+// Begin starts a transaction against fsys.
+func Begin(fsys absfs.Filer) *Tx {
+	return &Tx{fsys: fsys}
+}
+
+// stage records op, replacing any earlier op on the same file.
+func (tx *Tx) stage(op *txOp) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	for i, old := range tx.ops {
+		if old.name == op.name {
+			tx.ops[i] = op
+			return nil
+		}
+	}
+	tx.ops = append(tx.ops, op)
+	return nil
+}
+
+// WriteFile stages writing data to the named file, creating it with perm if
+// necessary and otherwise keeping its permissions. data is retained until the transaction ends and must not be
+// modified.
+func (tx *Tx) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return tx.stage(&txOp{name: name, data: data, perm: perm})
+}
+
+// Remove stages removing the named file. Commit fails if it does not exist
+// by then.
+func (tx *Tx) Remove(name string) error {
+	return tx.stage(&txOp{name: name, remove: true})
+}
+
+// Rollback discards the staged changes without touching the filesystem.
+func (tx *Tx) Rollback() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done, tx.ops = true, nil
+	return nil
+}
+
+// Commit applies the staged changes. If it returns an error, the changes
+// applied so far have been undone; the error also reports any failure to
+// undo them.
+func (tx *Tx) Commit() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+
+	for _, op := range tx.ops {
+		if op.remove {
+			continue
+		}
+		tmp, err := writeTemp(tx.fsys, op.name, op.data, op.perm)
+		if err != nil {
+			return tx.abort(fmt.Errorf("staging %s: %w", op.name, err))
+		}
+		op.tmp = tmp
+	}
+
+	for _, op := range tx.ops {
+		if err := tx.apply(op); err != nil {
+			return tx.abort(err)
+		}
+	}
+
+	for _, op := range tx.ops {
+		if op.backup != "" {
+			tx.fsys.Remove(op.backup)
+		}
+	}
+	tx.ops = nil
+	return nil
+}
+
+// apply moves the current file at op.name aside and puts the staged
+// contents, if any, in its place.
+func (tx *Tx) apply(op *txOp) error {
+	info, err := tx.fsys.Stat(op.name)
+	switch {
+	case err == nil && info.IsDir():
+		return &os.PathError{Op: "commit", Path: op.name, Err: errors.New("is a directory")}
+	case err == nil:
+		backup := siblingName(op.name, "bak")
+		if err := tx.fsys.Rename(op.name, backup); err != nil {
+			return fmt.Errorf("moving aside %s: %w", op.name, err)
+		}
+		op.backup = backup
+	case !errors.Is(err, fs.ErrNotExist):
+		return err
+	case op.remove:
+		return &os.PathError{Op: "remove", Path: op.name, Err: fs.ErrNotExist}
+	}
+
+	if !op.remove {
+		if err := tx.fsys.Rename(op.tmp, op.name); err != nil {
+			return fmt.Errorf("installing %s: %w", op.name, err)
+		}
+		op.tmp = ""
+	}
+	op.done = true
+	return nil
+}
+
+// abort undoes the applied ops in reverse order and removes staged files.
+func (tx *Tx) abort(cause error) error {
+	errs := []error{cause}
+	for i := len(tx.ops) - 1; i >= 0; i-- {
+		op := tx.ops[i]
+		if op.done && !op.remove {
+			if err := tx.fsys.Remove(op.name); err != nil {
+				errs = append(errs, fmt.Errorf("rollback %s: %w", op.name, err))
+				continue
+			}
+		}
+		if op.backup != "" {
+			if err := tx.fsys.Rename(op.backup, op.name); err != nil {
+				errs = append(errs, fmt.Errorf("rollback %s: %w", op.name, err))
+			}
+		}
+		if op.tmp != "" {
+			tx.fsys.Remove(op.tmp)
+		}
+	}
+	tx.ops = nil
+	return errors.Join(errs...)
+}
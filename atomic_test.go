@@ -0,0 +1,252 @@
+package gofs
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/absfs/absfs"
+	"github.com/absfs/memfs"
+)
+
+var errInjected = errors.New("injected fault")
+
+// faultFS is a Filer that fails the failAt'th mutating operation, counting
+// file creation, writes, syncs, renames and removals.
+type faultFS struct {
+	absfs.Filer
+	calls  int
+	failAt int
+}
+
+func (f *faultFS) fault() error {
+	f.calls++
+	if f.calls == f.failAt {
+		return errInjected
+	}
+	return nil
+}
+
+func (f *faultFS) OpenFile(name string, flag int, perm os.FileMode) (absfs.File, error) {
+	if flag&absfs.O_ACCESS == os.O_RDONLY {
+		return f.Filer.OpenFile(name, flag, perm)
+	}
+	if err := f.fault(); err != nil {
+		return nil, err
+	}
+	file, err := f.Filer.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &faultFile{File: file, fs: f}, nil
+}
+
+func (f *faultFS) Rename(oldpath, newpath string) error {
+	if err := f.fault(); err != nil {
+		return err
+	}
+	return f.Filer.Rename(oldpath, newpath)
+}
+
+func (f *faultFS) Remove(name string) error {
+	if err := f.fault(); err != nil {
+		return err
+	}
+	return f.Filer.Remove(name)
+}
+
+type faultFile struct {
+	absfs.File
+	fs *faultFS
+}
+
+func (f *faultFile) Write(p []byte) (int, error) {
+	if err := f.fs.fault(); err != nil {
+		return 0, err
+	}
+	return f.File.Write(p)
+}
+
+func (f *faultFile) Sync() error {
+	if err := f.fs.fault(); err != nil {
+		return err
+	}
+	return f.File.Sync()
+}
+
+// snapshotFiles returns the contents of every file in the root of mfs.
+func snapshotFiles(t *testing.T, mfs *memfs.FileSystem) map[string]string {
+	t.Helper()
+	entries, err := mfs.ReadDir("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	for _, entry := range entries {
+		data, err := mfs.ReadFile("/" + entry.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[entry.Name()] = string(data)
+	}
+	return files
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	for failAt := 1; ; failAt++ {
+		mfs, _ := memfs.NewFS()
+		writeFile(mfs, "/config.yaml", []byte("old"))
+		fsys := &faultFS{Filer: mfs, failAt: failAt}
+
+		err := WriteFileAtomic(fsys, "/config.yaml", []byte("new"), 0644)
+		got := snapshotFiles(t, mfs)
+		if err == nil {
+			// Removing the moved-aside original is best effort.
+			if got["config.yaml"] != "new" || len(withoutBackups(got)) != 1 {
+				t.Errorf("after success files = %v", got)
+			}
+			if failAt == 1 {
+				t.Fatal("no faults were injected")
+			}
+			return
+		}
+		if !errors.Is(err, errInjected) {
+			t.Fatalf("failAt=%d: error = %v", failAt, err)
+		}
+		if got["config.yaml"] != "old" && got["config.yaml"] != "new" {
+			t.Errorf("failAt=%d: partial contents %q", failAt, got["config.yaml"])
+		}
+		for name := range got {
+			if name != "config.yaml" {
+				t.Errorf("failAt=%d: left behind %q", failAt, name)
+			}
+		}
+	}
+}
+
+func TestWriteFileAtomic_Perm(t *testing.T) {
+	mfs, _ := memfs.NewFS()
+	writeFile(mfs, "/existing", []byte("old"))
+	if err := mfs.Chmod("/existing", 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFileAtomic(mfs, "/existing", []byte("new"), 0644); err != nil {
+		t.Fatalf("WriteFileAtomic(existing) failed: %v", err)
+	}
+	if err := WriteFileAtomic(mfs, "/created", []byte("new"), 0640); err != nil {
+		t.Fatalf("WriteFileAtomic(created) failed: %v", err)
+	}
+	tx := Begin(mfs)
+	if err := tx.WriteFile("/existing", []byte("newer"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() failed: %v", err)
+	}
+
+	for name, want := range map[string]os.FileMode{"/existing": 0600, "/created": 0640} {
+		info, err := mfs.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("mode of %s = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestTx(t *testing.T) {
+	setup := func() *memfs.FileSystem {
+		mfs, _ := memfs.NewFS()
+		writeFile(mfs, "/a", []byte("a1"))
+		writeFile(mfs, "/b", []byte("b1"))
+		writeFile(mfs, "/c", []byte("c1"))
+		return mfs
+	}
+	stage := func(tx *Tx) {
+		tx.WriteFile("/a", []byte("a2"), 0644)
+		tx.WriteFile("/d", []byte("d2"), 0644)
+		tx.Remove("/b")
+		tx.WriteFile("/c", []byte("ignored"), 0644)
+		tx.WriteFile("/c", []byte("c2"), 0644)
+	}
+	want := map[string]string{"a": "a2", "c": "c2", "d": "d2"}
+
+	for failAt := 1; ; failAt++ {
+		mfs := setup()
+		before := snapshotFiles(t, mfs)
+		tx := Begin(&faultFS{Filer: mfs, failAt: failAt})
+		stage(tx)
+
+		err := tx.Commit()
+		got := snapshotFiles(t, mfs)
+		if err == nil {
+			if !equalFiles(withoutBackups(got), want) {
+				t.Errorf("failAt=%d: after commit files = %v, want %v", failAt, got, want)
+			}
+			if failAt == 1 {
+				t.Fatal("no faults were injected")
+			}
+			break
+		}
+		if !errors.Is(err, errInjected) {
+			t.Fatalf("failAt=%d: error = %v", failAt, err)
+		}
+		if !equalFiles(got, before) {
+			t.Errorf("failAt=%d: after failed commit files = %v, want %v (%v)", failAt, got, before, err)
+		}
+	}
+
+	t.Run("remove missing", func(t *testing.T) {
+		mfs := setup()
+		tx := Begin(mfs)
+		tx.WriteFile("/a", []byte("a2"), 0644)
+		tx.Remove("/missing")
+		if err := tx.Commit(); err == nil {
+			t.Fatal("Commit succeeded")
+		}
+		if got := snapshotFiles(t, mfs); got["a"] != "a1" {
+			t.Errorf("a = %q after failed commit, want a1", got["a"])
+		}
+	})
+
+	t.Run("done", func(t *testing.T) {
+		tx := Begin(setup())
+		tx.WriteFile("/a", []byte("a2"), 0644)
+		if err := tx.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Commit(); !errors.Is(err, ErrTxDone) {
+			t.Errorf("Commit after Rollback = %v, want ErrTxDone", err)
+		}
+		if err := tx.WriteFile("/a", nil, 0644); !errors.Is(err, ErrTxDone) {
+			t.Errorf("WriteFile after Rollback = %v, want ErrTxDone", err)
+		}
+	})
+}
+
+// withoutBackups drops moved-aside originals, whose removal after a
+// successful replacement is best effort.
+func withoutBackups(files map[string]string) map[string]string {
+	out := make(map[string]string)
+	for name, data := range files {
+		if !strings.Contains(name, ".bak-") {
+			out[name] = data
+		}
+	}
+	return out
+}
+
+// equalFiles compares file maps, failing on any leftover hidden file.
+func equalFiles(got, want map[string]string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for name, data := range got {
+		if strings.HasPrefix(name, ".") || want[name] != data {
+			return false
+		}
+	}
+	return true
+}
@@ -253,3 +253,21 @@ func BenchmarkConcurrentReads(b *testing.B) {
 		}
 	})
 }
+
+// BenchmarkGlobAll benchmarks recursive globbing with directory pruning.
+func BenchmarkGlobAll(b *testing.B) {
+	mfs, _ := memfs.NewFS()
+	for i := 0; i < 10; i++ {
+		dir := "dir" + string(rune('0'+i))
+		mfs.Mkdir(dir, 0755)
+		for j := 0; j < 10; j++ {
+			writeFile(mfs, dir+"/file"+string(rune('0'+j))+".txt", []byte("data"))
+		}
+	}
+	fsys, _ := NewFs(mfs)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = GlobAll(fsys, "dir5/**/*.txt", nil)
+	}
+}
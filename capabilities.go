@@ -0,0 +1,75 @@
+package gofs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+
+	"github.com/absfs/absfs"
+)
+
+// BackendCapabilities describes the optional features of the Filer behind a
+// FileSystem.
+//
+// The absfs interfaces declare every method, and backends without a feature
+// report absfs.ErrNotImplemented, or a permission error for writes, when it
+// is used. Capabilities therefore finds these features by reading the root
+// of the FileSystem, and counts a feature as present unless the backend
+// rejects the probe. File features are probed on a regular file in the root
+// when there is one, and on the root directory itself otherwise, which some
+// backends treat differently. Whether the backend accepts writes cannot be found by
+// reading, so it is reported separately by ProbeWrite.
+type BackendCapabilities struct {
+	// SymLinker reports whether the Filer implements absfs.SymLinker.
+	SymLinker bool
+
+	// Seek and ReadAt report whether open files support Seek and ReadAt.
+	Seek   bool
+	ReadAt bool
+
+	// ReadFile and ReadDir report whether the Filer implements ReadFile and
+	// ReadDir itself, rather than FileSystem reading through an open file.
+	ReadFile bool
+	ReadDir  bool
+}
+
+// Capabilities reports the optional features of the Filer behind fsys.
+func Capabilities(fsys FileSystem) BackendCapabilities {
+	root, _ := fsys.resolve("capabilities", ".")
+	var caps BackendCapabilities
+	_, caps.SymLinker = fsys.Fs.(absfs.SymLinker)
+
+	_, err := fsys.Fs.ReadDir(root)
+	caps.ReadDir = !notImplemented(err)
+
+	probe := root
+	entries, _ := fsys.ReadDir(".")
+	for _, e := range entries {
+		if e.Type().IsRegular() {
+			probe, _ = fsys.resolve("capabilities", e.Name())
+			break
+		}
+	}
+	_, err = fsys.Fs.ReadFile(probe)
+	caps.ReadFile = !notImplemented(err)
+
+	if f, err := fsys.Fs.OpenFile(probe, absfs.O_RDONLY, 0); err == nil {
+		_, err = f.Seek(0, io.SeekCurrent)
+		caps.Seek = !notImplemented(err)
+		_, err = f.ReadAt(nil, 0)
+		caps.ReadAt = !notImplemented(err)
+		f.Close()
+	}
+	return caps
+}
+
+// ProbeWrite reports whether the Filer behind fsys accepts changes. It
+// calls Mkdir on the root of fsys: the root already exists, so a writable
+// backend reports fs.ErrExist and a read-only one refuses, and nothing is
+// changed on either. The call is nonetheless a write request, which a
+// backend may log, bill or forward, so Capabilities does not make it.
+func ProbeWrite(fsys FileSystem) bool {
+	root, _ := fsys.resolve("probe", ".")
+	err := fsys.Fs.Mkdir(root, 0755)
+	return err == nil || errors.Is(err, fs.ErrExist)
+}
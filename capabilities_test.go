@@ -0,0 +1,157 @@
+package gofs
+
+import (
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/absfs/absfs"
+)
+
+// minimalFiler is a read-only Filer that implements neither ReadFile nor
+// ReadDir, nor Seek and ReadAt on its files.
+type minimalFiler struct{ absfs.Filer }
+
+func (m minimalFiler) OpenFile(name string, flag int, perm os.FileMode) (absfs.File, error) {
+	if flag&absfs.O_ACCESS != os.O_RDONLY {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	f, err := m.Filer.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return minimalFile{f}, nil
+}
+
+func (m minimalFiler) Mkdir(name string, perm os.FileMode) error {
+	return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrPermission}
+}
+
+func (m minimalFiler) ReadDir(name string) ([]fs.DirEntry, error) {
+	return nil, &fs.PathError{Op: "readdir", Path: name, Err: absfs.ErrNotImplemented}
+}
+
+func (m minimalFiler) ReadFile(name string) ([]byte, error) {
+	return nil, &fs.PathError{Op: "readfile", Path: name, Err: absfs.ErrNotImplemented}
+}
+
+type minimalFile struct{ absfs.File }
+
+func (f minimalFile) Seek(offset int64, whence int) (int64, error) {
+	return 0, absfs.ErrNotImplemented
+}
+
+func (f minimalFile) ReadAt(b []byte, off int64) (int, error) {
+	return 0, absfs.ErrNotImplemented
+}
+
+// dirSeekFiler is a Filer whose directories, unlike its files, support
+// neither Seek nor ReadAt.
+type dirSeekFiler struct{ absfs.Filer }
+
+func (d dirSeekFiler) OpenFile(name string, flag int, perm os.FileMode) (absfs.File, error) {
+	f, err := d.Filer.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := f.Stat(); err == nil && info.IsDir() {
+		return minimalFile{f}, nil
+	}
+	return f, nil
+}
+
+func TestCapabilities(t *testing.T) {
+	mfs, gfs := setupTreeFS(t)
+	want := BackendCapabilities{SymLinker: true, Seek: true, ReadAt: true, ReadFile: true, ReadDir: true}
+	if got := Capabilities(gfs); got != want {
+		t.Errorf("Capabilities(memfs) = %+v, want %+v", got, want)
+	}
+
+	minimal, _ := NewFs(minimalFiler{mfs})
+	if got := Capabilities(minimal); got != (BackendCapabilities{}) {
+		t.Errorf("Capabilities(minimal) = %+v, want none", got)
+	}
+	sub, _ := gfs.Sub("a")
+	if got := Capabilities(sub.(FileSystem)); got != want {
+		t.Errorf("Capabilities(sub) = %+v, want %+v", got, want)
+	}
+
+	// File features are probed on root.txt, not on the root directory.
+	dirSeek, _ := NewFs(dirSeekFiler{mfs})
+	if got := Capabilities(dirSeek); !got.Seek || !got.ReadAt {
+		t.Errorf("Capabilities(dirSeek) = %+v, want Seek and ReadAt", got)
+	}
+	mfs.Mkdir("/empty", 0755)
+	empty, _ := dirSeek.Sub("empty")
+	if got := Capabilities(empty.(FileSystem)); got.Seek || got.ReadAt {
+		t.Errorf("Capabilities(empty dirSeek) = %+v, want no Seek or ReadAt", got)
+	}
+
+	if !ProbeWrite(gfs) {
+		t.Error("ProbeWrite(memfs) = false, want true")
+	}
+	if ProbeWrite(minimal) {
+		t.Error("ProbeWrite(minimal) = true, want false")
+	}
+}
+
+func TestFileSystem_ReadFallback(t *testing.T) {
+	mfs, _ := setupTreeFS(t)
+	big := strings.Repeat("0123456789", 1000)
+	writeFile(mfs, "/a/big.txt", []byte(big))
+	gfs, _ := NewFs(minimalFiler{mfs})
+
+	for name, want := range map[string]string{"root.txt": "root", "a/big.txt": big, "a/x/deep": "deep"} {
+		if data, err := gfs.ReadFile(name); err != nil || string(data) != want {
+			t.Errorf("ReadFile(%q) = %d bytes, %v; want %d", name, len(data), err, len(want))
+		}
+	}
+	if _, err := gfs.ReadFile("missing"); err == nil {
+		t.Error("ReadFile(missing) succeeded")
+	}
+
+	entries, err := gfs.ReadDir("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if strings.Join(names, " ") != "big.txt one.txt x" {
+		t.Errorf("ReadDir(a) = %v, want [big.txt one.txt x]", names)
+	}
+}
+
+// sharedDirFiler returns the same entry slice from every ReadDir call.
+type sharedDirFiler struct {
+	absfs.Filer
+	entries []fs.DirEntry
+}
+
+func (s sharedDirFiler) ReadDir(name string) ([]fs.DirEntry, error) {
+	return s.entries, nil
+}
+
+func TestFileSystem_ReadDirCopies(t *testing.T) {
+	mfs, _ := setupTreeFS(t)
+	dot, _ := mfs.Stat("/")
+	b, _ := mfs.Stat("/b")
+	a, _ := mfs.Stat("/a")
+	entries := []fs.DirEntry{fs.FileInfoToDirEntry(b), DirEntry{renamedInfo(dot, ".")}, fs.FileInfoToDirEntry(a)}
+	want := append([]fs.DirEntry(nil), entries...)
+
+	gfs, _ := NewFs(sharedDirFiler{mfs, entries})
+	for i := 0; i < 2; i++ {
+		got, err := gfs.ReadDir(".")
+		if err != nil || len(got) != 2 || got[0].Name() != "a" || got[1].Name() != "b" {
+			t.Fatalf("ReadDir(.) = %v, %v; want [a b]", got, err)
+		}
+	}
+	for i := range want {
+		if entries[i] != want[i] {
+			t.Fatalf("ReadDir modified the Filer's slice: %v", entries)
+		}
+	}
+}
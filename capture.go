@@ -0,0 +1,263 @@
+package gofs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"testing/fstest"
+	"time"
+
+	"github.com/absfs/memfs"
+)
+
+// DefaultCaptureLimit is the total size of file contents a capture accepts
+// when CaptureOptions.MaxTotalSize is zero.
+const DefaultCaptureLimit = 256 << 20
+
+// ErrCaptureLimit is returned when a capture exceeds one of the limits in
+// CaptureOptions.
+var ErrCaptureLimit = errors.New("capture limit exceeded")
+
+// CaptureOptions configures ToMapFS.
+type CaptureOptions struct {
+	// MaxFileSize is the largest file that may be captured. Zero means no
+	// limit other than MaxTotalSize.
+	MaxFileSize int64
+
+	// MaxTotalSize is the largest total size of the captured file contents.
+	// Zero means DefaultCaptureLimit and a negative value means no limit.
+	MaxTotalSize int64
+
+	// MaxFiles is the largest number of files and directories that may be
+	// captured. Zero means no limit.
+	MaxFiles int
+
+	// Include, if non-empty, restricts the capture to files matching at
+	// least one of these patterns. Patterns use the GlobAll syntax and are
+	// matched against the path relative to the root. Directories are
+	// captured regardless, so the directory structure is preserved.
+	Include []string
+
+	// Exclude lists patterns, in the GlobAll syntax, for paths to leave out.
+	// Excluded directories are not read.
+	Exclude []string
+}
+
+// ToMapFS copies the tree rooted at root in fsys into an fstest.MapFS, with
+// names relative to root. Modes, modification times and directories,
+// including empty ones, are preserved; entries that are neither regular
+// files nor directories are skipped.
+//
+// Limits are checked against each file's size before it is read, so an
+// accidentally large capture fails fast with an error wrapping
+// ErrCaptureLimit. opts may be nil, in which case DefaultCaptureLimit
+// applies.
+func ToMapFS(fsys fs.FS, root string, opts *CaptureOptions) (fstest.MapFS, error) {
+	m := make(fstest.MapFS)
+	err := capture(fsys, root, opts, func(name string, info fs.FileInfo, data []byte) error {
+		m[name] = &fstest.MapFile{Data: data, Mode: info.Mode(), ModTime: info.ModTime()}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ToMemFS copies the tree rooted at root in fsys into a new memfs, with
+// names relative to root placed below "/". Modes, modification times and
+// directories are preserved. The capture is limited to DefaultCaptureLimit
+// bytes of file contents; use ToMapFS for other limits and filters.
+func ToMemFS(fsys fs.FS, root string) (*memfs.FileSystem, error) {
+	mfs, err := memfs.NewFS()
+	if err != nil {
+		return nil, err
+	}
+	// Directory times are set last, since adding entries changes them.
+	var dirs []string
+	var dirTimes []time.Time
+	err = capture(fsys, root, nil, func(name string, info fs.FileInfo, data []byte) error {
+		p := "/" + name
+		if info.IsDir() {
+			dirs = append(dirs, p)
+			dirTimes = append(dirTimes, info.ModTime())
+			return mfs.Mkdir(p, info.Mode().Perm())
+		}
+		f, err := mfs.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(data); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		return mfs.Chtimes(p, info.ModTime(), info.ModTime())
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := mfs.Chtimes(dirs[i], dirTimes[i], dirTimes[i]); err != nil {
+			return nil, err
+		}
+	}
+	return mfs, nil
+}
+
+// capturer walks a tree, enforcing CaptureOptions.
+type capturer struct {
+	fsys    fs.FS
+	opts    CaptureOptions
+	include []*globMatcher
+	exclude []*globMatcher
+	total   int64
+	count   int
+	emit    func(name string, info fs.FileInfo, data []byte) error
+}
+
+// capture calls emit, in lexical order, for every directory and regular
+// file below root, with its name relative to root and, for files, its
+// contents.
+func capture(fsys fs.FS, root string, opts *CaptureOptions, emit func(string, fs.FileInfo, []byte) error) error {
+	c := &capturer{fsys: fsys, emit: emit}
+	if opts != nil {
+		c.opts = *opts
+	}
+	if c.opts.MaxTotalSize == 0 {
+		c.opts.MaxTotalSize = DefaultCaptureLimit
+	}
+	for _, p := range c.opts.Include {
+		m, err := compileGlob(p, true, false)
+		if err != nil {
+			return err
+		}
+		c.include = append(c.include, m)
+	}
+	for _, p := range c.opts.Exclude {
+		m, err := compileGlob(p, true, false)
+		if err != nil {
+			return err
+		}
+		c.exclude = append(c.exclude, m)
+	}
+
+	f, err := fsys.Open(root)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return &fs.PathError{Op: "capture", Path: root, Err: errors.New("not a directory")}
+	}
+	return c.dir(root, ".")
+}
+
+// dir captures the entries of dir, whose name relative to the root is rel.
+func (c *capturer) dir(dir, rel string) error {
+	entries, err := fs.ReadDir(c.fsys, dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := joinName(rel, entry.Name())
+		if matchAny(c.exclude, name) {
+			continue
+		}
+		full := path.Join(dir, entry.Name())
+		switch {
+		case entry.IsDir():
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			if err := c.add(name, info, nil); err != nil {
+				return err
+			}
+			if err := c.dir(full, name); err != nil {
+				return err
+			}
+		case entry.Type().IsRegular():
+			if len(c.include) > 0 && !matchAny(c.include, name) {
+				continue
+			}
+			if err := c.file(full, name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// file reads and captures the regular file full.
+func (c *capturer) file(full, name string) error {
+	f, err := c.fsys.Open(full)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	// Check the reported size first to fail fast, then the size actually
+	// read, in case the report was wrong.
+	if err := c.check(full, info.Size()); err != nil {
+		return err
+	}
+	data, err := io.ReadAll(c.limit(f))
+	if err != nil {
+		return err
+	}
+	if err := c.check(full, int64(len(data))); err != nil {
+		return err
+	}
+	c.total += int64(len(data))
+	return c.add(name, info, data)
+}
+
+// check reports whether a file of the given size fits within the limits.
+func (c *capturer) check(full string, size int64) error {
+	if c.opts.MaxFileSize > 0 && size > c.opts.MaxFileSize {
+		return fmt.Errorf("%s: file larger than %d bytes: %w", full, c.opts.MaxFileSize, ErrCaptureLimit)
+	}
+	if c.opts.MaxTotalSize > 0 && c.total+size > c.opts.MaxTotalSize {
+		return fmt.Errorf("%s: capture larger than %d bytes: %w", full, c.opts.MaxTotalSize, ErrCaptureLimit)
+	}
+	return nil
+}
+
+// limit returns r limited to one byte more than the remaining allowance.
+func (c *capturer) limit(r io.Reader) io.Reader {
+	allowed := int64(-1)
+	if c.opts.MaxFileSize > 0 {
+		allowed = c.opts.MaxFileSize
+	}
+	if c.opts.MaxTotalSize > 0 {
+		if rest := c.opts.MaxTotalSize - c.total; allowed < 0 || rest < allowed {
+			allowed = rest
+		}
+	}
+	if allowed < 0 {
+		return r
+	}
+	return io.LimitReader(r, allowed+1)
+}
+
+// add emits one entry, enforcing MaxFiles.
+func (c *capturer) add(name string, info fs.FileInfo, data []byte) error {
+	c.count++
+	if c.opts.MaxFiles > 0 && c.count > c.opts.MaxFiles {
+		return fmt.Errorf("%s: more than %d files: %w", name, c.opts.MaxFiles, ErrCaptureLimit)
+	}
+	return c.emit(name, info, data)
+}
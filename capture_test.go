@@ -0,0 +1,108 @@
+package gofs
+
+import (
+	"errors"
+	"io/fs"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestToMapFS(t *testing.T) {
+	mfs, gfs := setupTreeFS(t)
+	mtime := time.Unix(1e9, 0).UTC()
+	mfs.Chmod("/a/one.txt", 0600)
+	mfs.Chtimes("/a/one.txt", mtime, mtime)
+	mfs.Mkdir("/empty", 0700)
+
+	m, err := ToMapFS(gfs, ".", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	want := []string{"a", "a/one.txt", "a/x", "a/x/deep", "b", "b/two.txt", "empty", "root.txt"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("captured %v, want %v", names, want)
+	}
+	one := m["a/one.txt"]
+	if one.Mode != 0600 || !one.ModTime.Equal(mtime) {
+		t.Errorf("a/one.txt mode %v mtime %v, want 0600 %v", one.Mode, one.ModTime, mtime)
+	}
+	if !m["empty"].Mode.IsDir() || m["empty"].Mode.Perm() != 0700 {
+		t.Errorf("empty mode = %v, want drwx------", m["empty"].Mode)
+	}
+	if err := fstest.TestFS(m, "a/one.txt", "a/x/deep", "b/two.txt", "root.txt"); err != nil {
+		t.Error(err)
+	}
+
+	// The capture is independent of later changes.
+	writeFile(mfs, "/root.txt", []byte("changed"))
+	if data, _ := fs.ReadFile(m, "root.txt"); string(data) == "changed" {
+		t.Error("capture reflects a later change")
+	}
+}
+
+func TestToMapFS_Options(t *testing.T) {
+	mfs, gfs := setupTreeFS(t)
+	writeFile(mfs, "/b/big.bin", []byte(strings.Repeat("x", 1000)))
+
+	m, err := ToMapFS(gfs, ".", &CaptureOptions{Include: []string{"**/*.txt"}, Exclude: []string{"a/x"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	want := []string{"a", "a/one.txt", "b", "b/two.txt", "root.txt"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("filtered capture = %v, want %v", names, want)
+	}
+
+	m, err = ToMapFS(gfs, "b", nil)
+	if err != nil || len(m) != 2 || m["two.txt"] == nil {
+		t.Errorf("ToMapFS(b) = %v, %v; want big.bin and two.txt", m, err)
+	}
+
+	limits := []*CaptureOptions{
+		{MaxFileSize: 999},
+		{MaxTotalSize: 1000},
+		{MaxFiles: 3},
+	}
+	for _, opts := range limits {
+		if _, err := ToMapFS(gfs, ".", opts); !errors.Is(err, ErrCaptureLimit) {
+			t.Errorf("ToMapFS with %+v = %v, want ErrCaptureLimit", *opts, err)
+		}
+	}
+	if _, err := ToMapFS(gfs, ".", &CaptureOptions{MaxFileSize: 1000, MaxTotalSize: -1}); err != nil {
+		t.Errorf("ToMapFS within limits = %v", err)
+	}
+}
+
+func TestToMemFS(t *testing.T) {
+	mfs, gfs := setupTreeFS(t)
+	mtime := time.Unix(1e9, 0)
+	mfs.Chtimes("/a", mtime, mtime)
+
+	captured, err := ToMemFS(gfs, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := captured.ReadFile("/x/deep")
+	if err != nil || string(data) != "deep" {
+		t.Errorf("ReadFile(/x/deep) = %q, %v", data, err)
+	}
+
+	captured, _ = ToMemFS(gfs, ".")
+	if info, err := captured.Stat("/a"); err != nil || !info.ModTime().Equal(mtime) {
+		t.Errorf("Stat(/a) mtime = %v, %v; want %v", info.ModTime(), err, mtime)
+	}
+}
@@ -0,0 +1,195 @@
+package gofs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// ErrAmbiguousCase is returned by a CaseInsensitiveFS when a name matches
+// several entries of a directory that differ only in case, none of them
+// exactly.
+var ErrAmbiguousCase = errors.New("name matches entries differing only in case")
+
+// CaseInsensitiveFS is a read-only view of an fs.FS that looks names up
+// ignoring case, as on the default Windows and macOS file systems. It
+// implements fs.FS, fs.StatFS, fs.ReadDirFS and fs.ReadFileFS.
+//
+// Each path component is matched against the entries of its directory
+// using Unicode case folding, as strings.EqualFold does. An entry whose name
+// matches exactly is always preferred; otherwise a component matching more
+// than one entry fails with an error wrapping ErrAmbiguousCase that lists
+// them. Files are opened and reported under their names in the underlying
+// filesystem, so Stat().Name() returns the on-disk casing.
+//
+// The entries of each directory are read once and cached. A name that is
+// not found in a cached directory causes it to be read again, and a cached
+// match that has since disappeared is retried after clearing the cache, so
+// the view follows files being added and removed; Reset clears the cache
+// explicitly.
+type CaseInsensitiveFS struct {
+	// FS is the wrapped filesystem.
+	FS fs.FS
+
+	mu   sync.Mutex
+	dirs map[string]map[string][]string // dir -> folded name -> names
+}
+
+// CaseInsensitive returns a CaseInsensitiveFS over fsys.
+func CaseInsensitive(fsys fs.FS) *CaseInsensitiveFS {
+	return &CaseInsensitiveFS{FS: fsys}
+}
+
+// Reset discards the cached directory entries.
+func (c *CaseInsensitiveFS) Reset() {
+	c.mu.Lock()
+	c.dirs = nil
+	c.mu.Unlock()
+}
+
+// foldName returns a canonical form of name under Unicode simple case
+// folding: two names are equal under strings.EqualFold exactly when their
+// folded forms are equal.
+func foldName(name string) string {
+	return strings.Map(func(r rune) rune {
+		// The smallest rune of r's folding orbit represents it.
+		lo := r
+		for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+			lo = min(lo, f)
+		}
+		return lo
+	}, name)
+}
+
+// names returns the folded-name map of the underlying directory dir,
+// reading it if it is not cached or if reload is set.
+func (c *CaseInsensitiveFS) names(dir string, reload bool) (map[string][]string, error) {
+	c.mu.Lock()
+	m, ok := c.dirs[dir]
+	c.mu.Unlock()
+	if ok && !reload {
+		return m, nil
+	}
+	entries, err := fs.ReadDir(c.FS, dir)
+	if err != nil {
+		return nil, err
+	}
+	return c.store(dir, entries), nil
+}
+
+// store caches the entries of the underlying directory dir.
+func (c *CaseInsensitiveFS) store(dir string, entries []fs.DirEntry) map[string][]string {
+	m := make(map[string][]string, len(entries))
+	for _, e := range entries {
+		key := foldName(e.Name())
+		m[key] = append(m[key], e.Name())
+	}
+	c.mu.Lock()
+	if c.dirs == nil {
+		c.dirs = make(map[string]map[string][]string)
+	}
+	c.dirs[dir] = m
+	c.mu.Unlock()
+	return m
+}
+
+// resolve returns the underlying name matching name.
+func (c *CaseInsensitiveFS) resolve(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return ".", nil
+	}
+	dir := "."
+	for _, comp := range strings.Split(name, "/") {
+		match, err := c.match(dir, comp)
+		if err != nil {
+			return "", &fs.PathError{Op: op, Path: name, Err: err}
+		}
+		dir = joinName(dir, match)
+	}
+	return dir, nil
+}
+
+// match returns the entry of the underlying directory dir matching comp.
+func (c *CaseInsensitiveFS) match(dir, comp string) (string, error) {
+	key := foldName(comp)
+	for reload := false; ; reload = true {
+		m, err := c.names(dir, reload)
+		if err != nil {
+			if pe, ok := err.(*fs.PathError); ok {
+				err = pe.Err
+			}
+			return "", err
+		}
+		cands := m[key]
+		switch {
+		case slices.Contains(cands, comp):
+			return comp, nil
+		case len(cands) == 1:
+			return cands[0], nil
+		case len(cands) > 1:
+			return "", fmt.Errorf("%w: %s", ErrAmbiguousCase, strings.Join(cands, ", "))
+		case reload:
+			return "", fs.ErrNotExist
+		}
+	}
+}
+
+// foldRetry runs fn on the underlying name of name, clearing the cache and
+// trying again once if the cached match no longer exists.
+func foldRetry[T any](c *CaseInsensitiveFS, op, name string, fn func(string) (T, error)) (T, error) {
+	var zero T
+	under, err := c.resolve(op, name)
+	if err != nil {
+		return zero, err
+	}
+	v, err := fn(under)
+	if errors.Is(err, fs.ErrNotExist) {
+		c.Reset()
+		if under, err = c.resolve(op, name); err != nil {
+			return zero, err
+		}
+		v, err = fn(under)
+	}
+	if err != nil {
+		return zero, pathError(op, name, err)
+	}
+	return v, nil
+}
+
+// Open opens the named file.
+func (c *CaseInsensitiveFS) Open(name string) (fs.File, error) {
+	return foldRetry(c, "open", name, c.FS.Open)
+}
+
+// Stat returns the FileInfo of the named file, named with its on-disk
+// casing.
+func (c *CaseInsensitiveFS) Stat(name string) (fs.FileInfo, error) {
+	return foldRetry(c, "stat", name, func(under string) (fs.FileInfo, error) {
+		return fs.Stat(c.FS, under)
+	})
+}
+
+// ReadDir reads the named directory, refreshing its cached entries.
+func (c *CaseInsensitiveFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return foldRetry(c, "readdir", name, func(under string) ([]fs.DirEntry, error) {
+		entries, err := fs.ReadDir(c.FS, under)
+		if err == nil {
+			c.store(under, entries)
+		}
+		return entries, err
+	})
+}
+
+// ReadFile reads the named file.
+func (c *CaseInsensitiveFS) ReadFile(name string) ([]byte, error) {
+	return foldRetry(c, "readfile", name, func(under string) ([]byte, error) {
+		return fs.ReadFile(c.FS, under)
+	})
+}
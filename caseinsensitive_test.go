@@ -0,0 +1,93 @@
+package gofs
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/absfs/memfs"
+)
+
+func TestCaseInsensitive(t *testing.T) {
+	mfs, _ := memfs.NewFS()
+	mkdirs(mfs, "/Assets", "/Assets/CSS")
+	for name, data := range map[string]string{
+		"/Assets/CSS/Site.css":  "body{}",
+		"/Assets/readme.txt":    "lower",
+		"/Assets/README.txt":    "upper",
+		"/Assets/École.txt":     "école",
+		"/Assets/Straße.md":     "strasse",
+		"/Assets/Logo.PNG":      "png",
+		"/Assets/CSS/print.css": "@media print{}",
+	} {
+		writeFile(mfs, name, []byte(data))
+	}
+	gfs, _ := NewFs(mfs)
+	ci := CaseInsensitive(gfs)
+
+	for name, want := range map[string]string{
+		"assets/css/site.css": "body{}",
+		"ASSETS/CSS/SITE.CSS": "body{}",
+		"Assets/readme.txt":   "lower",
+		"Assets/README.txt":   "upper",
+		"assets/éCOLE.TXT":    "école",
+		"assets/STRAẞE.md":    "strasse",
+		"assets/logo.png":     "png",
+	} {
+		if data, err := ci.ReadFile(name); err != nil || string(data) != want {
+			t.Errorf("ReadFile(%q) = %q, %v; want %q", name, data, err, want)
+		}
+	}
+
+	info, err := ci.Stat("assets/css/SITE.css")
+	if err != nil || info.Name() != "Site.css" {
+		t.Errorf("Stat(assets/css/SITE.css) name = %v, %v; want Site.css", info, err)
+	}
+	f, err := ci.Open("ASSETS/logo.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := f.Stat(); info.Name() != "Logo.PNG" {
+		t.Errorf("opened file name = %q, want Logo.PNG", info.Name())
+	}
+	f.Close()
+
+	_, err = ci.ReadFile("assets/ReadMe.txt")
+	if !errors.Is(err, ErrAmbiguousCase) || !strings.Contains(err.Error(), "README.txt, readme.txt") {
+		t.Errorf("ReadFile(assets/ReadMe.txt) error = %v, want ErrAmbiguousCase naming both", err)
+	}
+	if _, err := ci.Stat("assets/missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat(assets/missing) error = %v, want fs.ErrNotExist", err)
+	}
+	if _, err := ci.Stat("assets/logo.png/x"); err == nil {
+		t.Error("Stat below a file succeeded")
+	}
+	if entries, err := ci.ReadDir("assets/CSS"); err != nil || len(entries) != 2 {
+		t.Errorf("ReadDir(assets/CSS) = %v, %v", entries, err)
+	}
+}
+
+func TestCaseInsensitive_Cache(t *testing.T) {
+	mfs, _ := memfs.NewFS()
+	mkdirs(mfs, "/dir")
+	writeFile(mfs, "/dir/Old.txt", []byte("old"))
+	gfs, _ := NewFs(mfs)
+	ci := CaseInsensitive(gfs)
+
+	if _, err := ci.Stat("DIR/old.txt"); err != nil {
+		t.Fatal(err)
+	}
+	// A file added after the directory was cached is found.
+	writeFile(mfs, "/dir/New.txt", []byte("new"))
+	if data, err := ci.ReadFile("dir/NEW.TXT"); err != nil || string(data) != "new" {
+		t.Errorf("ReadFile(dir/NEW.TXT) = %q, %v", data, err)
+	}
+	// A cached match that was renamed is looked up again.
+	if err := mfs.Rename("/dir/Old.txt", "/dir/OLD.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := ci.Stat("dir/old.txt"); err != nil || info.Name() != "OLD.txt" {
+		t.Errorf("Stat after rename = %v, %v; want OLD.txt", info, err)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/absfs/gofs"
+)
+
+// runGenerate implements
+// "gofs generate [-pkg name] [-var name] [-o file] [dir]".
+//
+// It writes Go source embedding dir, by default to standard output.
+func runGenerate(args []string) error {
+	flags := flag.NewFlagSet("generate", flag.ExitOnError)
+	pkg := flags.String("pkg", "assets", "package `name` of the generated file")
+	varName := flags.String("var", "Assets", "`name` of the generated variable")
+	out := flags.String("o", "", "write the source to `file` instead of standard output")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: gofs generate [-pkg name] [-var name] [-o file] [dir]\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	dir := "."
+	switch flags.NArg() {
+	case 0:
+	case 1:
+		dir = flags.Arg(0)
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	var buf bytes.Buffer
+	if err := gofs.GenerateGo(&buf, os.DirFS(dir), *pkg, *varName); err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err := os.Stdout.Write(buf.Bytes())
+		return err
+	}
+	return os.WriteFile(*out, buf.Bytes(), 0644)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/absfs/gofs"
+)
+
+// runHash implements "gofs hash [-check manifest] [dir]".
+//
+// Without -check it writes a manifest for dir to standard output. With
+// -check it verifies dir against the manifest and prints one line per file
+// in the style of "sha256sum --check".
+func runHash(args []string) error {
+	flags := flag.NewFlagSet("hash", flag.ExitOnError)
+	check := flags.String("check", "", "verify the directory against the sha256sum manifest `file`")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: gofs hash [-check file] [dir]\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	dir := "."
+	switch flags.NArg() {
+	case 0:
+	case 1:
+		dir = flags.Arg(0)
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+	fsys := os.DirFS(dir)
+
+	if *check == "" {
+		return gofs.WriteManifest(os.Stdout, fsys, ".")
+	}
+
+	f, err := os.Open(*check)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	report, err := gofs.VerifyManifest(fsys, f)
+	if err != nil {
+		return err
+	}
+
+	// A manifest stored inside the tree it describes is not an extra file.
+	if rel, err := filepath.Rel(dir, *check); err == nil {
+		rel = filepath.ToSlash(rel)
+		if rel != ".." && !strings.HasPrefix(rel, "../") {
+			report.Extra = without(report.Extra, rel)
+		}
+	}
+
+	for _, name := range report.Matched {
+		fmt.Printf("%s: OK\n", name)
+	}
+	for _, name := range report.Mismatched {
+		fmt.Printf("%s: FAILED\n", name)
+	}
+	for _, name := range report.Missing {
+		fmt.Printf("%s: FAILED open or read\n", name)
+	}
+	for _, name := range report.Extra {
+		fmt.Printf("%s: EXTRA\n", name)
+	}
+
+	if n := len(report.Mismatched); n > 0 {
+		fmt.Fprintf(os.Stderr, "gofs: WARNING: %d computed checksum(s) did NOT match\n", n)
+	}
+	if n := len(report.Missing); n > 0 {
+		fmt.Fprintf(os.Stderr, "gofs: WARNING: %d listed file(s) could not be read\n", n)
+	}
+	if n := len(report.Extra); n > 0 {
+		fmt.Fprintf(os.Stderr, "gofs: WARNING: %d file(s) not listed in manifest\n", n)
+	}
+	if len(report.Mismatched)+len(report.Missing)+len(report.Extra) > 0 {
+		return errFailed
+	}
+	return nil
+}
+
+// without returns list with every occurrence of name removed.
+func without(list []string, name string) []string {
+	out := list[:0]
+	for _, s := range list {
+		if s != name {
+			out = append(out, s)
+		}
+	}
+	return out
+}
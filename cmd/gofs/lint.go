@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/absfs/gofs"
+)
+
+// runLint implements "gofs lint [-json] [-skip rules] [-max-path n] [dir]".
+//
+// It prints the portability issues found in dir, one per line or as a JSON
+// array, and fails if there are any.
+func runLint(args []string) error {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print the issues as a JSON array")
+	skip := flags.String("skip", "", "comma-separated `rules` not to check")
+	maxPath := flags.Int("max-path", gofs.DefaultMaxPathLength, "longest path allowed, in UTF-16 code units; 0 disables the check")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: gofs lint [-json] [-skip rules] [-max-path n] [dir]\n")
+		flags.PrintDefaults()
+		fmt.Fprintf(flags.Output(), "rules: %s, %s, %s, %s, %s, %s, %s\n",
+			gofs.LintCaseCollision, gofs.LintUnicodeCollision, gofs.LintReservedName,
+			gofs.LintTrailingDotSpace, gofs.LintForbiddenChar, gofs.LintLongPath, gofs.LintInvalidUTF8)
+	}
+	flags.Parse(args)
+
+	dir := "."
+	switch flags.NArg() {
+	case 0:
+	case 1:
+		dir = flags.Arg(0)
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	rules := gofs.DefaultLintRules()
+	rules.MaxPathLength = *maxPath
+	if *skip != "" {
+		for _, rule := range strings.Split(*skip, ",") {
+			switch strings.TrimSpace(rule) {
+			case gofs.LintCaseCollision:
+				rules.CaseCollisions = false
+			case gofs.LintUnicodeCollision:
+				rules.UnicodeCollisions = false
+			case gofs.LintReservedName:
+				rules.ReservedNames = false
+			case gofs.LintTrailingDotSpace:
+				rules.TrailingDotsSpaces = false
+			case gofs.LintForbiddenChar:
+				rules.ForbiddenChars = false
+			case gofs.LintLongPath:
+				rules.MaxPathLength = 0
+			case gofs.LintInvalidUTF8:
+				rules.InvalidUTF8 = false
+			default:
+				return fmt.Errorf("unknown lint rule %q", rule)
+			}
+		}
+	}
+
+	issues, err := gofs.Lint(os.DirFS(dir), ".", rules)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		if issues == nil {
+			issues = []gofs.LintIssue{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(issues); err != nil {
+			return err
+		}
+	} else {
+		for _, issue := range issues {
+			fmt.Printf("%s: %s: %s\n", issue.Path, issue.Rule, issue.Message)
+		}
+	}
+	if len(issues) > 0 {
+		return errFailed
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+// Command gofs provides command line access to the utilities in the gofs
+// package, operating on directories of the host filesystem.
+//
+// Usage:
+//
+//	gofs <command> [arguments]
+//
+// The commands are:
+//
+//	generate  write Go source embedding a directory as an fs.FS
+//	hash      write or verify a sha256sum-compatible checksum manifest
+//	lint      report names that are not portable to other operating systems
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+)
+
+// errFailed is returned by a command that ran successfully but whose result
+// should be reported through a non-zero exit status, such as a failed check.
+var errFailed = errors.New("failed")
+
+// commands maps each subcommand name to its implementation.
+var commands = map[string]func(args []string) error{
+	"generate": runGenerate,
+	"hash":     runHash,
+	"lint":     runLint,
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("gofs: ")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(2)
+	}
+	run, ok := commands[flag.Arg(0)]
+	if !ok {
+		log.Printf("unknown command %q", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+
+	err := run(flag.Args()[1:])
+	switch {
+	case errors.Is(err, errFailed):
+		os.Exit(1)
+	case err != nil:
+		log.Fatal(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: gofs <command> [arguments]\n\ncommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "\t%s\n", name)
+	}
+}
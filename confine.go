@@ -0,0 +1,392 @@
+package gofs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/absfs/absfs"
+)
+
+// ErrPathEscapes is returned when a name given to a ConfinedFiler would
+// resolve to a location outside its root.
+var ErrPathEscapes = errors.New("path escapes from parent")
+
+// maxConfinedLinks bounds the symbolic links followed resolving one name.
+const maxConfinedLinks = 40
+
+// ConfinedFiler is an absfs.Filer that restricts access to the directory
+// tree below a root of another Filer, with the semantics of Go 1.24's
+// os.Root. Wrap it with NewFs to use it through the io/fs interfaces.
+//
+// Names are slash-separated and relative to the root. Each name is resolved
+// one component at a time: "." is ignored, ".." steps back to the parent of
+// the component before it, and, when the underlying Filer implements
+// absfs.SymLinker, symbolic links are read and their targets resolved in
+// place. Absolute names, ".." at the root, links with absolute targets and
+// links whose targets lead out of the root all fail with an error wrapping
+// ErrPathEscapes; empty names and names containing NUL bytes are invalid.
+// A link in the final component of a name is followed by the operations
+// that follow links in package os, and left alone by Lstat, Lchown,
+// Readlink, Remove, Rename and Symlink.
+//
+// Unlike os.Root, which relies on the operating system to resolve each
+// component atomically, a ConfinedFiler resolves names before acting on
+// them. A tree that is modified concurrently, by replacing a checked
+// directory with a link, can therefore race with a lookup; trees exposed to
+// untrusted writers should be confined by the operating system instead.
+//
+// Errors report names as they were given, never the paths used in the
+// underlying Filer.
+type ConfinedFiler struct {
+	base absfs.Filer
+	root string
+}
+
+// Confined returns a ConfinedFiler limited to the directory root of fsys.
+// The root itself is used as given, including any links in it, and must be
+// an existing directory.
+func Confined(fsys absfs.Filer, root string) (*ConfinedFiler, error) {
+	root = path.Clean(root)
+	info, err := fsys.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &os.PathError{Op: "confine", Path: root, Err: syscall.ENOTDIR}
+	}
+	return &ConfinedFiler{base: fsys, root: root}, nil
+}
+
+var (
+	_ absfs.Filer     = (*ConfinedFiler)(nil)
+	_ absfs.SymLinker = (*ConfinedFiler)(nil)
+)
+
+// Root returns the root directory in the underlying Filer.
+func (c *ConfinedFiler) Root() string { return c.root }
+
+// resolve returns the path in the underlying Filer of name, following a
+// link in its final component if follow is set. Only the final component
+// may be missing.
+func (c *ConfinedFiler) resolve(op, name string, follow bool) (string, error) {
+	if name == "" || strings.IndexByte(name, 0) >= 0 {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if path.IsAbs(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: ErrPathEscapes}
+	}
+	links, _ := c.base.(absfs.SymLinker)
+
+	var (
+		resolved []string
+		pending  = strings.Split(name, "/")
+		hops     int
+		via      string // the last link followed, for errors
+	)
+	for len(pending) > 0 {
+		comp := pending[0]
+		pending = pending[1:]
+		switch comp {
+		case "", ".":
+			continue
+		case "..":
+			if len(resolved) == 0 {
+				err := ErrPathEscapes
+				if via != "" {
+					err = fmt.Errorf("symlink %s leads outside the root: %w", via, ErrPathEscapes)
+				}
+				return "", &fs.PathError{Op: op, Path: name, Err: err}
+			}
+			resolved = resolved[:len(resolved)-1]
+			continue
+		}
+		if links == nil || (len(pending) == 0 && !follow) {
+			resolved = append(resolved, comp)
+			continue
+		}
+
+		p := c.join(append(resolved, comp))
+		info, err := links.Lstat(p)
+		if err != nil {
+			if len(pending) == 0 && errors.Is(err, fs.ErrNotExist) {
+				resolved = append(resolved, comp)
+				continue
+			}
+			return "", c.pathErr(op, name, err)
+		}
+		if info.Mode()&fs.ModeSymlink == 0 {
+			resolved = append(resolved, comp)
+			continue
+		}
+
+		if hops++; hops > maxConfinedLinks {
+			return "", &fs.PathError{Op: op, Path: name, Err: syscall.ELOOP}
+		}
+		target, err := links.Readlink(p)
+		if err != nil {
+			return "", c.pathErr(op, name, err)
+		}
+		link := path.Join(append(resolved, comp)...)
+		if target == "" || path.IsAbs(target) {
+			return "", &fs.PathError{Op: op, Path: name,
+				Err: fmt.Errorf("symlink %s has absolute target %q: %w", link, target, ErrPathEscapes)}
+		}
+		// The target replaces the link and is resolved relative to the
+		// link's directory.
+		via = link
+		pending = append(strings.Split(target, "/"), pending...)
+	}
+	return c.join(resolved), nil
+}
+
+// join returns the underlying path of the resolved components.
+func (c *ConfinedFiler) join(resolved []string) string {
+	if len(resolved) == 0 {
+		return c.root
+	}
+	return path.Join(c.root, strings.Join(resolved, "/"))
+}
+
+// pathErr returns err with its path replaced by name, so that errors from
+// the underlying Filer do not reveal the root.
+func (c *ConfinedFiler) pathErr(op, name string, err error) error {
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		return &fs.PathError{Op: op, Path: name, Err: pe.Err}
+	}
+	var le *os.LinkError
+	if errors.As(err, &le) {
+		return &fs.PathError{Op: op, Path: name, Err: le.Err}
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// OpenFile opens the named file, following a final link.
+func (c *ConfinedFiler) OpenFile(name string, flag int, perm os.FileMode) (absfs.File, error) {
+	p, err := c.resolve("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	f, err := c.base.OpenFile(p, flag, perm)
+	if err != nil {
+		return nil, c.pathErr("open", name, err)
+	}
+	return &confinedFile{File: f, name: name}, nil
+}
+
+// Mkdir creates a directory.
+func (c *ConfinedFiler) Mkdir(name string, perm os.FileMode) error {
+	p, err := c.resolve("mkdir", name, false)
+	if err != nil {
+		return err
+	}
+	if err := c.base.Mkdir(p, perm); err != nil {
+		return c.pathErr("mkdir", name, err)
+	}
+	return nil
+}
+
+// Remove removes the named file, empty directory or link.
+func (c *ConfinedFiler) Remove(name string) error {
+	p, err := c.resolve("remove", name, false)
+	if err != nil {
+		return err
+	}
+	if p == c.root {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	}
+	if err := c.base.Remove(p); err != nil {
+		return c.pathErr("remove", name, err)
+	}
+	return nil
+}
+
+// Rename renames oldpath to newpath. Links in the final components are
+// renamed, not followed.
+func (c *ConfinedFiler) Rename(oldpath, newpath string) error {
+	op, err := c.resolve("rename", oldpath, false)
+	if err != nil {
+		return err
+	}
+	np, err := c.resolve("rename", newpath, false)
+	if err != nil {
+		return err
+	}
+	if err := c.base.Rename(op, np); err != nil {
+		return c.pathErr("rename", oldpath, err)
+	}
+	return nil
+}
+
+// Stat returns the FileInfo of the named file, following a final link.
+func (c *ConfinedFiler) Stat(name string) (os.FileInfo, error) {
+	p, err := c.resolve("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	info, err := c.base.Stat(p)
+	if err != nil {
+		return nil, c.pathErr("stat", name, err)
+	}
+	return info, nil
+}
+
+// Chmod changes the mode of the named file, following a final link.
+func (c *ConfinedFiler) Chmod(name string, mode os.FileMode) error {
+	p, err := c.resolve("chmod", name, true)
+	if err != nil {
+		return err
+	}
+	if err := c.base.Chmod(p, mode); err != nil {
+		return c.pathErr("chmod", name, err)
+	}
+	return nil
+}
+
+// Chtimes changes the times of the named file, following a final link.
+func (c *ConfinedFiler) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	p, err := c.resolve("chtimes", name, true)
+	if err != nil {
+		return err
+	}
+	if err := c.base.Chtimes(p, atime, mtime); err != nil {
+		return c.pathErr("chtimes", name, err)
+	}
+	return nil
+}
+
+// Chown changes the owner of the named file, following a final link.
+func (c *ConfinedFiler) Chown(name string, uid, gid int) error {
+	p, err := c.resolve("chown", name, true)
+	if err != nil {
+		return err
+	}
+	if err := c.base.Chown(p, uid, gid); err != nil {
+		return c.pathErr("chown", name, err)
+	}
+	return nil
+}
+
+// ReadDir reads the named directory, following a final link.
+func (c *ConfinedFiler) ReadDir(name string) ([]fs.DirEntry, error) {
+	p, err := c.resolve("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := c.base.ReadDir(p)
+	if err != nil {
+		return nil, c.pathErr("readdir", name, err)
+	}
+	return entries, nil
+}
+
+// ReadFile reads the named file, following a final link.
+func (c *ConfinedFiler) ReadFile(name string) ([]byte, error) {
+	p, err := c.resolve("readfile", name, true)
+	if err != nil {
+		return nil, err
+	}
+	data, err := c.base.ReadFile(p)
+	if err != nil {
+		return nil, c.pathErr("readfile", name, err)
+	}
+	return data, nil
+}
+
+// Sub returns an fs.FS of the confined subtree rooted at dir.
+func (c *ConfinedFiler) Sub(dir string) (fs.FS, error) {
+	return absfs.FilerToFS(c, dir)
+}
+
+// symLinker returns the underlying Filer as an absfs.SymLinker.
+func (c *ConfinedFiler) symLinker(op, name string) (absfs.SymLinker, error) {
+	links, ok := c.base.(absfs.SymLinker)
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: absfs.ErrNotImplemented}
+	}
+	return links, nil
+}
+
+// Lstat returns the FileInfo of the named file without following a final
+// link.
+func (c *ConfinedFiler) Lstat(name string) (os.FileInfo, error) {
+	p, err := c.resolve("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	links, ok := c.base.(absfs.SymLinker)
+	if !ok {
+		return c.Stat(name)
+	}
+	info, err := links.Lstat(p)
+	if err != nil {
+		return nil, c.pathErr("lstat", name, err)
+	}
+	return info, nil
+}
+
+// Lchown changes the owner of the named file without following a final
+// link.
+func (c *ConfinedFiler) Lchown(name string, uid, gid int) error {
+	links, err := c.symLinker("lchown", name)
+	if err != nil {
+		return err
+	}
+	p, err := c.resolve("lchown", name, false)
+	if err != nil {
+		return err
+	}
+	if err := links.Lchown(p, uid, gid); err != nil {
+		return c.pathErr("lchown", name, err)
+	}
+	return nil
+}
+
+// Readlink returns the target of the named link.
+func (c *ConfinedFiler) Readlink(name string) (string, error) {
+	links, err := c.symLinker("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	p, err := c.resolve("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	target, err := links.Readlink(p)
+	if err != nil {
+		return "", c.pathErr("readlink", name, err)
+	}
+	return target, nil
+}
+
+// Symlink creates newname as a link to oldname. Any target may be stored,
+// but links leading out of the root cannot be followed.
+func (c *ConfinedFiler) Symlink(oldname, newname string) error {
+	links, err := c.symLinker("symlink", newname)
+	if err != nil {
+		return err
+	}
+	p, err := c.resolve("symlink", newname, false)
+	if err != nil {
+		return err
+	}
+	if err := links.Symlink(oldname, p); err != nil {
+		return c.pathErr("symlink", newname, err)
+	}
+	return nil
+}
+
+// confinedFile is a file opened through a ConfinedFiler. It reports the
+// name it was opened with rather than its underlying path.
+type confinedFile struct {
+	absfs.File
+	name string
+}
+
+func (f *confinedFile) Name() string { return f.name }
@@ -0,0 +1,194 @@
+package gofs
+
+import (
+	"errors"
+	"io/fs"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/absfs/absfs"
+	"github.com/absfs/memfs"
+)
+
+// setupJail returns a memfs holding /secret and a /jail tree with links
+// that stay inside it, links that escape it and a loop, confined to /jail.
+func setupJail(t testing.TB) (*memfs.FileSystem, *ConfinedFiler) {
+	t.Helper()
+	mfs, _ := memfs.NewFS()
+	mkdirs(mfs, "/jail", "/jail/dir")
+	for name, data := range map[string]string{
+		"/secret":        "secret",
+		"/jail/top":      "top",
+		"/jail/dir/file": "inside",
+	} {
+		if err := writeFile(mfs, name, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{
+		"/jail/dir/up":   "../top",
+		"/jail/dir/self": ".",
+		"/jail/linkdir":  "dir",
+		"/jail/chain":    "linkdir/up",
+		"/jail/esc":      "../secret",
+		"/jail/dir/esc":  "../../secret",
+		"/jail/dir/deep": "../linkdir/../../secret",
+		"/jail/abs":      "/secret",
+		"/jail/absin":    "/jail/top",
+		"/jail/loop":     "loop",
+	} {
+		if err := mfs.Symlink(target, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c, err := Confined(mfs, "/jail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mfs, c
+}
+
+func TestConfined(t *testing.T) {
+	_, c := setupJail(t)
+	for name, want := range map[string]string{
+		"top":                  "top",
+		"dir/file":             "inside",
+		"dir/../top":           "top",
+		"./dir//file":          "inside",
+		"dir/up":               "top",
+		"dir/self/self/file":   "inside",
+		"linkdir/file":         "inside",
+		"linkdir/../top":       "top",
+		"chain":                "top",
+		"dir/self/../dir/file": "inside",
+	} {
+		if got, err := c.ReadFile(name); err != nil || string(got) != want {
+			t.Errorf("ReadFile(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+
+	for name, wantErr := range map[string]error{
+		"../secret":            ErrPathEscapes,
+		"dir/../../secret":     ErrPathEscapes,
+		"/secret":              ErrPathEscapes,
+		"/jail/top":            ErrPathEscapes,
+		"esc":                  ErrPathEscapes,
+		"dir/esc":              ErrPathEscapes,
+		"dir/deep":             ErrPathEscapes,
+		"abs":                  ErrPathEscapes,
+		"absin":                ErrPathEscapes,
+		"linkdir/../../secret": ErrPathEscapes,
+		"loop":                 syscall.ELOOP,
+		"missing/file":         fs.ErrNotExist,
+		"":                     fs.ErrInvalid,
+		"top\x00":              fs.ErrInvalid,
+	} {
+		_, err := c.ReadFile(name)
+		var pe *fs.PathError
+		if !errors.Is(err, wantErr) || !errors.As(err, &pe) || pe.Path != name {
+			t.Errorf("ReadFile(%q) error = %v, want PathError for %q wrapping %v", name, err, name, wantErr)
+		}
+		if err != nil && strings.Contains(err.Error(), "/jail/"+strings.TrimPrefix(name, "/")) {
+			t.Errorf("ReadFile(%q) error %q reveals the root", name, err)
+		}
+	}
+	if _, err := c.Stat("abs"); err == nil || !strings.Contains(err.Error(), `symlink abs has absolute target "/secret"`) {
+		t.Errorf("Stat(abs) error = %v, want it to name the link and target", err)
+	}
+
+	// Operations on the link itself do not follow it.
+	if info, err := c.Lstat("esc"); err != nil || info.Mode()&fs.ModeSymlink == 0 {
+		t.Errorf("Lstat(esc) = %v, %v; want the link", info, err)
+	}
+	if target, err := c.Readlink("abs"); err != nil || target != "/secret" {
+		t.Errorf("Readlink(abs) = %q, %v", target, err)
+	}
+	if err := c.Remove("esc"); err != nil {
+		t.Errorf("Remove(esc) = %v", err)
+	}
+
+	// Creating through a link lands inside the root or fails.
+	if err := c.Symlink("dir/new", "newlink"); err != nil {
+		t.Fatal(err)
+	}
+	if err := putFile(c, "newlink", []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := c.ReadFile("dir/new"); err != nil || string(got) != "new" {
+		t.Errorf("ReadFile(dir/new) = %q, %v", got, err)
+	}
+	if err := putFile(c, "abs", []byte("pwned")); !errors.Is(err, ErrPathEscapes) {
+		t.Errorf("write through abs = %v, want ErrPathEscapes", err)
+	}
+
+	gfs, _ := NewFs(c)
+	entries, err := fs.ReadDir(gfs, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if !slices.Contains(names, "top") || !slices.Contains(names, "dir") {
+		t.Errorf("ReadDir(.) = %v", names)
+	}
+	if _, err := Confined(c, "top"); err == nil {
+		t.Error("Confined accepted a file as root")
+	}
+}
+
+func TestConfined_NoSymLinker(t *testing.T) {
+	mfs, _ := setupTreeFS(t)
+	c, err := Confined(filerOnly{mfs}, "/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := c.ReadFile("x/../one.txt"); err != nil || string(got) != "one" {
+		t.Errorf("ReadFile = %q, %v", got, err)
+	}
+	if _, err := c.ReadFile("../root.txt"); !errors.Is(err, ErrPathEscapes) {
+		t.Errorf("ReadFile(../root.txt) = %v, want ErrPathEscapes", err)
+	}
+	if _, err := c.Readlink("one.txt"); err == nil {
+		t.Error("Readlink succeeded without a SymLinker")
+	}
+}
+
+// filerOnly hides every method of a Filer beyond absfs.Filer.
+type filerOnly struct{ absfs.Filer }
+
+func FuzzConfined(f *testing.F) {
+	for _, seed := range []string{
+		"top", "dir/file", "..", "../secret", "dir/../../secret", "/secret",
+		"esc", "dir/esc", "dir/deep", "abs", "linkdir/../../secret",
+		"dir/self/../../secret", "..\\secret", "dir\\..\\..\\secret",
+		"top\x00../secret", "loop/x", "./../jail/top", "%2e%2e/secret",
+		strings.Repeat("dir/self/", 100) + "../../secret",
+		strings.Repeat("../", 50) + "secret",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, name string) {
+		mfs, c := setupJail(t)
+
+		if p, err := c.resolve("open", name, true); err == nil && p != "/jail" && !strings.HasPrefix(p, "/jail/") {
+			t.Fatalf("resolve(%q) = %q, outside the root", name, p)
+		}
+		if data, err := c.ReadFile(name); err == nil && string(data) == "secret" {
+			t.Fatalf("ReadFile(%q) read the secret", name)
+		}
+		if err := putFile(c, name, []byte("pwned")); err == nil {
+			if data, _ := mfs.ReadFile("/secret"); string(data) != "secret" {
+				t.Fatalf("writing %q overwrote the secret", name)
+			}
+		}
+		c.Mkdir(name, 0755)
+		c.Remove(name)
+		if entries, _ := mfs.ReadDir("/"); len(entries) != 2 {
+			t.Fatalf("operations on %q changed the parent: %v", name, entries)
+		}
+	})
+}
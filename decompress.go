@@ -0,0 +1,465 @@
+package gofs
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// codec describes a compressed file format recognized by DecompressFS.
+type codec struct {
+	ext       string
+	newReader func(io.Reader) (io.ReadCloser, error)
+}
+
+// codecs lists the supported formats in the order they are tried when
+// resolving a name without an extension.
+var codecs = []codec{
+	{".gz", func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) }},
+	{".zlib", zlib.NewReader},
+	{".flate", func(r io.Reader) (io.ReadCloser, error) { return flate.NewReader(r), nil }},
+}
+
+// codecFor returns the codec for the extension of name, if any.
+func codecFor(name string) (codec, bool) {
+	for _, c := range codecs {
+		if strings.HasSuffix(name, c.ext) && len(name) > len(c.ext) {
+			return c, true
+		}
+	}
+	return codec{}, false
+}
+
+// DecompressFS is a read-only view of an fs.FS that transparently
+// decompresses gzip (".gz"), zlib (".zlib") and raw DEFLATE (".flate")
+// files. It implements fs.FS, fs.StatFS and fs.ReadDirFS.
+//
+// By default compressed files are presented under their name without the
+// compression extension, so "data/foo.json.gz" is listed and opened as
+// "data/foo.json". If a file with the stripped name also exists, the real
+// file takes precedence and the compressed one is listed under its original
+// name. Compressed files remain reachable under their original names, in
+// which case their raw bytes are returned.
+type DecompressFS struct {
+	// FS is the wrapped filesystem.
+	FS fs.FS
+
+	// KeepNames presents compressed files under their original names,
+	// decompressed, instead of stripping the compression extension.
+	KeepNames bool
+
+	// Seekable makes decompressed files implement io.Seeker. Because the
+	// compressed formats do not support random access, seeking backwards
+	// re-reads the file from the start and seeking forwards discards the
+	// intervening data.
+	Seekable bool
+}
+
+// Decompressing returns a DecompressFS over fsys with the default settings.
+func Decompressing(fsys fs.FS) *DecompressFS {
+	return &DecompressFS{FS: fsys}
+}
+
+// resolve maps a name in the view to the underlying file. It returns the
+// codec to apply, if the file is compressed, and the underlying FileInfo.
+func (d *DecompressFS) resolve(op, name string) (under string, c codec, compressed bool, info fs.FileInfo, err error) {
+	if !fs.ValidPath(name) {
+		return "", codec{}, false, nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	info, err = fs.Stat(d.FS, name)
+	if err == nil {
+		if d.KeepNames && info.Mode().IsRegular() {
+			c, compressed = codecFor(name)
+		}
+		return name, c, compressed, info, nil
+	}
+	if d.KeepNames || !errors.Is(err, fs.ErrNotExist) {
+		return "", codec{}, false, nil, err
+	}
+
+	for _, c := range codecs {
+		info, cerr := fs.Stat(d.FS, name+c.ext)
+		if cerr == nil && info.Mode().IsRegular() {
+			return name + c.ext, c, true, info, nil
+		}
+	}
+	return "", codec{}, false, nil, err
+}
+
+// Open opens the named file, decompressing it if it is compressed.
+func (d *DecompressFS) Open(name string) (fs.File, error) {
+	under, c, compressed, info, err := d.resolve("open", name)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := d.FS.Open(under)
+	if err != nil {
+		return nil, err
+	}
+	if !compressed {
+		if info.IsDir() {
+			return &decompressDir{File: raw, d: d, dir: under}, nil
+		}
+		return raw, nil
+	}
+
+	f := &decompressFile{
+		fsys:  d.FS,
+		under: under,
+		codec: c,
+		info:  d.compressedInfo(under, c, info),
+	}
+	if err := f.reset(raw); err != nil {
+		raw.Close()
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if d.Seekable {
+		return &seekableDecompressFile{f}, nil
+	}
+	return f, nil
+}
+
+// Stat returns a FileInfo describing the named file. For compressed files
+// the name is the presented name and the size is the uncompressed size. It
+// is computed the first time Size is called: from the gzip trailer when that
+// can be trusted, which is the case for single-member gzip files of up to
+// about 4MiB on backends that support io.ReaderAt or io.Seeker, and
+// otherwise by decompressing the whole file. Size returns -1 if the file
+// cannot be decompressed.
+func (d *DecompressFS) Stat(name string) (fs.FileInfo, error) {
+	under, c, compressed, info, err := d.resolve("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	if !compressed {
+		return info, nil
+	}
+	return d.compressedInfo(under, c, info), nil
+}
+
+// ReadDir reads the named directory, presenting compressed files under their
+// view names, sorted by view name.
+func (d *DecompressFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	entries, err := fs.ReadDir(d.FS, name)
+	if err != nil {
+		return nil, err
+	}
+	return d.mapEntries(name, entries), nil
+}
+
+// mapEntries translates the entries of the underlying directory dir and
+// sorts them by their translated names. A compressed file is only listed
+// under its stripped name if resolve would open it under that name, so a
+// real file of that name, or a compressed one with an earlier codec, keeps
+// its original name.
+func (d *DecompressFS) mapEntries(dir string, entries []fs.DirEntry) []fs.DirEntry {
+	out := make([]fs.DirEntry, len(entries))
+	for i, e := range entries {
+		out[i] = e
+		if !e.Type().IsRegular() {
+			continue
+		}
+		c, ok := codecFor(e.Name())
+		if !ok {
+			continue
+		}
+		under := joinName(dir, e.Name())
+		viewName := e.Name()
+		if !d.KeepNames {
+			viewName = strings.TrimSuffix(viewName, c.ext)
+			if chosen, _, _, _, err := d.resolve("readdir", joinName(dir, viewName)); err != nil || chosen != under {
+				continue
+			}
+		}
+		out[i] = &decompressEntry{DirEntry: e, d: d, under: under, name: viewName, codec: c}
+	}
+	slices.SortFunc(out, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return out
+}
+
+// compressedInfo returns the FileInfo presented for the compressed file
+// under.
+func (d *DecompressFS) compressedInfo(under string, c codec, info fs.FileInfo) *decompressInfo {
+	name := info.Name()
+	if !d.KeepNames {
+		name = strings.TrimSuffix(name, c.ext)
+	}
+	return &decompressInfo{FileInfo: info, name: name, fsys: d.FS, under: under, codec: c}
+}
+
+// maxDeflateRatio bounds how many bytes of output a single byte of DEFLATE
+// data can produce.
+const maxDeflateRatio = 1032
+
+// trailerSize reads the ISIZE trailer of a gzip file, which holds the
+// uncompressed size of the last member modulo 2^32. The trailer is only
+// trusted when it is large enough to account for the compressed data after
+// the header, which rules out files with several members of which the last
+// is small, and when the compressed size is too small to expand past 4GiB.
+// It returns -1 for other formats, for sizes that cannot be trusted, and
+// when the trailer cannot be read without reading the whole file.
+func trailerSize(fsys fs.FS, name string, c codec, info fs.FileInfo) int64 {
+	if c.ext != ".gz" || info.Size() < 18 { // smallest valid gzip stream
+		return -1
+	}
+	f, err := fsys.Open(name)
+	if err != nil {
+		return -1
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return -1
+	}
+	// An upper bound on the header length; names and comments may have been
+	// converted from Latin-1 and so are at least as long as when stored.
+	header := int64(10 + 2 + len(zr.Extra) + len(zr.Name) + 1 + len(zr.Comment) + 1 + 2)
+
+	var trailer [4]byte
+	switch r := f.(type) {
+	case io.ReaderAt:
+		if _, err := r.ReadAt(trailer[:], info.Size()-4); err != nil && !errors.Is(err, io.EOF) {
+			return -1
+		}
+	case io.ReadSeeker:
+		if _, err := r.Seek(-4, io.SeekEnd); err != nil {
+			return -1
+		}
+		if _, err := io.ReadFull(r, trailer[:]); err != nil {
+			return -1
+		}
+	default:
+		return -1
+	}
+	size := int64(binary.LittleEndian.Uint32(trailer[:]))
+
+	// DEFLATE expands incompressible data by at most 5 bytes per stored
+	// block of up to 65535 bytes.
+	deflated := info.Size() - header - 8
+	if deflated > size+5*(size/65535+1) {
+		return -1
+	}
+	if (info.Size()-18)*maxDeflateRatio >= size+1<<32 {
+		return -1
+	}
+	return size
+}
+
+// decompressedSize returns the uncompressed size of the compressed file
+// name by decompressing it.
+func decompressedSize(fsys fs.FS, name string, c codec) (int64, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	r, err := c.newReader(f)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	return io.Copy(io.Discard, r)
+}
+
+// decompressInfo is the FileInfo of a compressed file as seen in the view.
+type decompressInfo struct {
+	fs.FileInfo
+	name  string
+	fsys  fs.FS
+	under string
+	codec codec
+
+	once sync.Once
+	size int64
+}
+
+func (i *decompressInfo) Name() string { return i.name }
+
+// Size returns the uncompressed size, computing it on the first call, or -1
+// if the file cannot be decompressed.
+func (i *decompressInfo) Size() int64 {
+	i.once.Do(func() {
+		if i.size = trailerSize(i.fsys, i.under, i.codec, i.FileInfo); i.size >= 0 {
+			return
+		}
+		var err error
+		if i.size, err = decompressedSize(i.fsys, i.under, i.codec); err != nil {
+			i.size = -1
+		}
+	})
+	return i.size
+}
+
+// decompressEntry is a directory entry for a compressed file.
+type decompressEntry struct {
+	fs.DirEntry
+	d     *DecompressFS
+	under string
+	name  string
+	codec codec
+}
+
+func (e *decompressEntry) Name() string { return e.name }
+
+func (e *decompressEntry) Info() (fs.FileInfo, error) {
+	info, err := e.DirEntry.Info()
+	if err != nil {
+		return nil, err
+	}
+	return e.d.compressedInfo(e.under, e.codec, info), nil
+}
+
+// decompressDir is a directory opened through a DecompressFS.
+type decompressDir struct {
+	fs.File
+	d   *DecompressFS
+	dir string
+
+	list *infoDir // the sorted entries, once read; only its paging is used
+}
+
+// ReadDir implements fs.ReadDirFile, translating entry names. Because the
+// translated names sort differently, the first call reads every entry.
+func (f *decompressDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if f.list == nil {
+		rd, ok := f.File.(fs.ReadDirFile)
+		if !ok {
+			return nil, &fs.PathError{Op: "readdir", Path: f.dir, Err: errors.ErrUnsupported}
+		}
+		entries, err := rd.ReadDir(-1)
+		if err != nil {
+			return nil, err
+		}
+		f.list = &infoDir{entries: f.d.mapEntries(f.dir, entries)}
+	}
+	return f.list.ReadDir(n)
+}
+
+// decompressFile streams the decompressed contents of a compressed file.
+type decompressFile struct {
+	fsys  fs.FS
+	under string
+	codec codec
+	info  *decompressInfo
+
+	raw fs.File
+	r   io.ReadCloser
+	pos int64
+}
+
+// reset starts decompressing from the beginning of raw, replacing any
+// current stream.
+func (f *decompressFile) reset(raw fs.File) error {
+	r, err := f.codec.newReader(raw)
+	if err != nil {
+		return err
+	}
+	f.raw, f.r, f.pos = raw, r, 0
+	return nil
+}
+
+func (f *decompressFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *decompressFile) Read(p []byte) (int, error) {
+	if f.r == nil {
+		return 0, &fs.PathError{Op: "read", Path: f.info.name, Err: fs.ErrClosed}
+	}
+	n, err := f.r.Read(p)
+	f.pos += int64(n)
+	return n, err
+}
+
+// seekableDecompressFile is a decompressFile opened through a Seekable
+// DecompressFS. Files opened otherwise do not implement io.Seeker at all, so
+// callers can detect the capability with a type assertion.
+type seekableDecompressFile struct {
+	*decompressFile
+}
+
+// Seek implements io.Seeker. Seeking relative to the end of a file whose
+// size cannot be read from the gzip trailer decompresses the whole file
+// once to determine it.
+func (s *seekableDecompressFile) Seek(offset int64, whence int) (int64, error) {
+	f := s.decompressFile
+	if f.r == nil {
+		return 0, &fs.PathError{Op: "seek", Path: f.info.name, Err: fs.ErrClosed}
+	}
+
+	var target int64
+	switch whence {
+	case io.SeekStart:
+		target = offset
+	case io.SeekCurrent:
+		target = f.pos + offset
+	case io.SeekEnd:
+		size := f.info.Size()
+		if size < 0 {
+			return 0, &fs.PathError{Op: "seek", Path: f.info.name, Err: errors.New("cannot determine size")}
+		}
+		target = size + offset
+	default:
+		return 0, &fs.PathError{Op: "seek", Path: f.info.name, Err: fs.ErrInvalid}
+	}
+	if target < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.info.name, Err: fs.ErrInvalid}
+	}
+
+	if target < f.pos {
+		if err := f.rewind(); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := io.CopyN(io.Discard, f, target-f.pos); err != nil && !errors.Is(err, io.EOF) {
+		return 0, err
+	}
+	// Seeking past the end is allowed; subsequent reads return io.EOF.
+	f.pos = target
+	return target, nil
+}
+
+// rewind restarts decompression from the beginning of the file, seeking the
+// underlying file if possible and reopening it otherwise.
+func (f *decompressFile) rewind() error {
+	f.r.Close()
+	raw := f.raw
+	if s, ok := raw.(io.Seeker); ok {
+		if _, err := s.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	} else {
+		raw.Close()
+		var err error
+		if raw, err = f.fsys.Open(f.under); err != nil {
+			f.r = nil
+			return err
+		}
+	}
+	if err := f.reset(raw); err != nil {
+		f.r = nil
+		return err
+	}
+	return nil
+}
+
+func (f *decompressFile) Close() error {
+	if f.r == nil {
+		return &fs.PathError{Op: "close", Path: f.info.name, Err: fs.ErrClosed}
+	}
+	f.r.Close()
+	f.r = nil
+	return f.raw.Close()
+}
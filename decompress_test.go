@@ -0,0 +1,293 @@
+package gofs
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"io/fs"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/absfs/memfs"
+)
+
+func compress(t *testing.T, ext string, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch ext {
+	case ".gz":
+		w = gzip.NewWriter(&buf)
+	case ".zlib":
+		w = zlib.NewWriter(&buf)
+	case ".flate":
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	}
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+var decompressPayload = strings.Repeat(`{"key": "value"}`+"\n", 100)
+
+func setupDecompressFS(t *testing.T) FileSystem {
+	t.Helper()
+	mfs, err := memfs.NewFS()
+	if err != nil {
+		t.Fatalf("Failed to create memfs: %v", err)
+	}
+	mfs.Mkdir("lake", 0755)
+	files := map[string][]byte{
+		"lake/events.json.gz":  compress(t, ".gz", []byte(decompressPayload)),
+		"lake/users.json.zlib": compress(t, ".zlib", []byte(decompressPayload)),
+		"lake/raw.bin.flate":   compress(t, ".flate", []byte(decompressPayload)),
+		"lake/plain.txt":       []byte("plain"),
+		"lake/dup.txt":         []byte("real file"),
+		"lake/dup.txt.gz":      compress(t, ".gz", []byte("compressed file")),
+		"lake/both.gz":         compress(t, ".gz", []byte("gzip")),
+		"lake/both.zlib":       compress(t, ".zlib", []byte("zlib")),
+		"lake/raw.bin.a":       []byte("listed after raw.bin"),
+	}
+	for name, data := range files {
+		if err := writeFile(mfs, name, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gfs, _ := NewFs(mfs)
+	return gfs
+}
+
+func TestDecompressing(t *testing.T) {
+	gfs := setupDecompressFS(t)
+	dfs := Decompressing(gfs)
+
+	var _ fs.StatFS = dfs
+	var _ fs.ReadDirFS = dfs
+
+	t.Run("read stripped names", func(t *testing.T) {
+		for _, name := range []string{"lake/events.json", "lake/users.json", "lake/raw.bin"} {
+			data, err := fs.ReadFile(dfs, name)
+			if err != nil {
+				t.Errorf("ReadFile(%q) failed: %v", name, err)
+				continue
+			}
+			if string(data) != decompressPayload {
+				t.Errorf("ReadFile(%q) returned %d bytes, want %d", name, len(data), len(decompressPayload))
+			}
+		}
+	})
+
+	t.Run("uncompressed passthrough", func(t *testing.T) {
+		data, err := fs.ReadFile(dfs, "lake/plain.txt")
+		if err != nil || string(data) != "plain" {
+			t.Errorf("ReadFile(plain.txt) = %q, %v", data, err)
+		}
+	})
+
+	t.Run("real file wins", func(t *testing.T) {
+		data, err := fs.ReadFile(dfs, "lake/dup.txt")
+		if err != nil || string(data) != "real file" {
+			t.Errorf("ReadFile(dup.txt) = %q, %v; want real file", data, err)
+		}
+	})
+
+	t.Run("original name returns raw bytes", func(t *testing.T) {
+		data, err := fs.ReadFile(dfs, "lake/events.json.gz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data[:2], []byte{0x1f, 0x8b}) {
+			t.Errorf("ReadFile(events.json.gz) is not gzip data")
+		}
+	})
+
+	t.Run("stat reports gzip size", func(t *testing.T) {
+		info, err := dfs.Stat("lake/events.json")
+		if err != nil {
+			t.Fatalf("Stat() failed: %v", err)
+		}
+		if info.Name() != "events.json" {
+			t.Errorf("Name() = %q, want events.json", info.Name())
+		}
+		if info.Size() != int64(len(decompressPayload)) {
+			t.Errorf("Size() = %d, want %d", info.Size(), len(decompressPayload))
+		}
+
+		info, err = dfs.Stat("lake/users.json")
+		if err != nil {
+			t.Fatalf("Stat() failed: %v", err)
+		}
+		if info.Size() != int64(len(decompressPayload)) {
+			t.Errorf("Size() of zlib file = %d, want %d", info.Size(), len(decompressPayload))
+		}
+	})
+
+	t.Run("stat decompresses when the trailer is distrusted", func(t *testing.T) {
+		// The trailer of a multi-member file describes only the last member.
+		mfs, _ := memfs.NewFS()
+		multi := append(compress(t, ".gz", []byte(strings.Repeat("x", 1<<20))), compress(t, ".gz", []byte("tail"))...)
+		if err := writeFile(mfs, "multi.gz", multi); err != nil {
+			t.Fatal(err)
+		}
+		gfs, _ := NewFs(mfs)
+		info, err := Decompressing(gfs).Stat("multi")
+		if err != nil {
+			t.Fatalf("Stat() failed: %v", err)
+		}
+		if want := int64(1<<20 + len("tail")); info.Size() != want {
+			t.Errorf("Size() of multi-member file = %d, want %d", info.Size(), want)
+		}
+
+		if err := writeFile(mfs, "corrupt.zlib", []byte("not zlib data")); err != nil {
+			t.Fatal(err)
+		}
+		info, err = Decompressing(gfs).Stat("corrupt")
+		if err != nil {
+			t.Fatalf("Stat() failed: %v", err)
+		}
+		if info.Size() != -1 {
+			t.Errorf("Size() of corrupt file = %d, want -1", info.Size())
+		}
+	})
+
+	t.Run("read dir", func(t *testing.T) {
+		entries, err := dfs.ReadDir("lake")
+		if err != nil {
+			t.Fatalf("ReadDir() failed: %v", err)
+		}
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		want := []string{"both", "both.zlib", "dup.txt", "dup.txt.gz", "events.json", "plain.txt", "raw.bin", "raw.bin.a", "users.json"}
+		if strings.Join(names, ",") != strings.Join(want, ",") {
+			t.Errorf("ReadDir() = %v, want %v", names, want)
+		}
+
+		f, err := dfs.Open("lake")
+		if err != nil {
+			t.Fatalf("Open(lake) failed: %v", err)
+		}
+		defer f.Close()
+		fromFile, err := f.(fs.ReadDirFile).ReadDir(-1)
+		if err != nil {
+			t.Fatalf("File.ReadDir() failed: %v", err)
+		}
+		if len(fromFile) != len(entries) {
+			t.Errorf("File.ReadDir() returned %d entries, want %d", len(fromFile), len(entries))
+		}
+	})
+
+	t.Run("paged read dir", func(t *testing.T) {
+		// "a-b" sorts before "a.gz" but after its view name "a".
+		mfs, _ := memfs.NewFS()
+		if err := writeFile(mfs, "a.gz", compress(t, ".gz", []byte("a"))); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeFile(mfs, "a-b", []byte("a-b")); err != nil {
+			t.Fatal(err)
+		}
+		gfs, _ := NewFs(mfs)
+		f, err := Decompressing(gfs).Open(".")
+		if err != nil {
+			t.Fatalf("Open(.) failed: %v", err)
+		}
+		defer f.Close()
+		var names []string
+		for {
+			page, err := f.(fs.ReadDirFile).ReadDir(1)
+			for _, e := range page {
+				names = append(names, e.Name())
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("File.ReadDir(1) failed: %v", err)
+			}
+		}
+		if want := []string{"a", "a-b"}; !slices.Equal(names, want) {
+			t.Errorf("File.ReadDir(1) pages = %v, want %v", names, want)
+		}
+	})
+
+	t.Run("keep names", func(t *testing.T) {
+		keep := &DecompressFS{FS: gfs, KeepNames: true}
+		data, err := fs.ReadFile(keep, "lake/events.json.gz")
+		if err != nil || string(data) != decompressPayload {
+			t.Errorf("ReadFile(events.json.gz) = %d bytes, %v", len(data), err)
+		}
+		if _, err := keep.Stat("lake/events.json"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Stat(events.json) error = %v, want fs.ErrNotExist", err)
+		}
+	})
+
+	t.Run("invalid path", func(t *testing.T) {
+		if _, err := dfs.Open("../x"); !errors.Is(err, fs.ErrInvalid) {
+			t.Errorf("Open(../x) error = %v, want fs.ErrInvalid", err)
+		}
+	})
+}
+
+func TestDecompressFile_Seek(t *testing.T) {
+	gfs := setupDecompressFS(t)
+
+	t.Run("not seekable by default", func(t *testing.T) {
+		f, err := Decompressing(gfs).Open("lake/events.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, ok := f.(io.Seeker); ok {
+			t.Error("file implements io.Seeker without Seekable")
+		}
+	})
+
+	for _, name := range []string{"lake/events.json", "lake/users.json"} {
+		t.Run(name, func(t *testing.T) {
+			dfs := &DecompressFS{FS: gfs, Seekable: true}
+			f, err := dfs.Open(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			s := f.(io.ReadSeeker)
+
+			buf := make([]byte, 10)
+			for _, tc := range []struct {
+				offset int64
+				whence int
+				want   int64
+			}{
+				{100, io.SeekStart, 100},
+				{-50, io.SeekCurrent, 60},
+				{5, io.SeekStart, 5},
+				{-10, io.SeekEnd, int64(len(decompressPayload)) - 10},
+			} {
+				pos, err := s.Seek(tc.offset, tc.whence)
+				if err != nil {
+					t.Fatalf("Seek(%d, %d) failed: %v", tc.offset, tc.whence, err)
+				}
+				if pos != tc.want {
+					t.Errorf("Seek(%d, %d) = %d, want %d", tc.offset, tc.whence, pos, tc.want)
+				}
+				if _, err := io.ReadFull(s, buf); err != nil {
+					t.Fatalf("Read after Seek failed: %v", err)
+				}
+				if string(buf) != decompressPayload[pos:pos+10] {
+					t.Errorf("Read after Seek(%d) = %q, want %q", pos, buf, decompressPayload[pos:pos+10])
+				}
+			}
+
+			if _, err := s.Seek(-1, io.SeekStart); err == nil {
+				t.Error("Seek to negative offset should fail")
+			}
+		})
+	}
+}
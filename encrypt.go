@@ -0,0 +1,760 @@
+package gofs
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/absfs/absfs"
+)
+
+// Encrypted file layout:
+//
+//	header: magic[8] | chunkSize uint32 | salt[32] | keyIDLen uint8 | keyID
+//	chunks: AES-GCM(chunk plaintext) for each chunk, in order
+//
+// Every file has a random salt from which its content key is derived, so no
+// two files share a key. Chunk i is sealed with the nonce
+// uint64(i) | uint32(final), which authenticates its position and whether it
+// is the last chunk; reordering, duplicating or truncating chunks causes
+// decryption to fail. The header is passed as additional data to every chunk.
+const (
+	encMagic      = "GOFSENC\x01"
+	encSaltSize   = 32
+	encFixedSize  = len(encMagic) + 4 + encSaltSize + 1
+	encDefaultCSz = 64 << 10
+	encMaxCSz     = 16 << 20
+)
+
+var (
+	// ErrDecrypt is returned when encrypted data fails authentication,
+	// meaning it was modified, truncated, reordered or sealed with a
+	// different key.
+	ErrDecrypt = errors.New("message authentication failed")
+
+	// ErrUnknownKey is returned when a file was encrypted with a key ID that
+	// is not in the Keyring.
+	ErrUnknownKey = errors.New("unknown encryption key")
+)
+
+// Keyring holds the AES keys used by an EncryptedFiler, indexed by key ID.
+// New files are encrypted with the Current key; existing files are decrypted
+// with whichever key their header names, so keys can be rotated by adding a
+// new key, making it Current and re-encrypting files with
+// EncryptedFiler.Rekey at leisure.
+type Keyring struct {
+	// Keys maps each key ID to a 16, 24 or 32 byte AES key. Key IDs are at
+	// most 255 bytes long.
+	Keys map[string][]byte
+
+	// Current is the ID of the key used to encrypt new files.
+	Current string
+}
+
+// Validate reports an error if any key in k is not a valid AES key size or
+// has an ID longer than 255 bytes. An EncryptedFiler validates its Keyring
+// whenever it looks up a key.
+func (k *Keyring) Validate() error {
+	for id, key := range k.Keys {
+		if len(id) > 255 {
+			return fmt.Errorf("key ID of %d bytes is longer than 255", len(id))
+		}
+		switch len(key) {
+		case 16, 24, 32:
+		default:
+			return fmt.Errorf("key %q: %w", id, aes.KeySizeError(len(key)))
+		}
+	}
+	return nil
+}
+
+// key returns the key with the given ID after validating the Keyring.
+func (k *Keyring) key(id string) ([]byte, error) {
+	if k == nil {
+		return nil, ErrUnknownKey
+	}
+	if err := k.Validate(); err != nil {
+		return nil, err
+	}
+	key, ok := k.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("key %q: %w", id, ErrUnknownKey)
+	}
+	return key, nil
+}
+
+// EncryptedFiler is an absfs.Filer that stores file contents, and optionally
+// file names, encrypted in an underlying Filer. Wrap it with NewFs to read
+// the decrypted files through the io/fs interfaces.
+//
+// Files opened for writing must be written sequentially from the start: a
+// writable open always begins a new encrypted file, so it requires O_TRUNC
+// unless the file does not exist yet, and Seek, WriteAt and Truncate are not
+// supported on it. Files opened read-only support Read, Seek and ReadAt.
+// Data is only written to the underlying Filer a chunk at a time, and the
+// final chunk is written by Close, which must therefore be checked for
+// errors.
+type EncryptedFiler struct {
+	// Base is the Filer that holds the encrypted data.
+	Base absfs.Filer
+
+	// Keys holds the content encryption keys.
+	Keys *Keyring
+
+	// NameKey, if set, enables file name encryption. Every path component
+	// is replaced by a deterministic, authenticated encryption of itself, so
+	// lookups still work but names reveal nothing beyond their length. The
+	// name key cannot be rotated without renaming every file.
+	NameKey []byte
+
+	// ChunkSize is the plaintext size of each encrypted chunk for new files.
+	// Zero means 64 KiB, and the maximum is 16 MiB. Existing files record
+	// their own chunk size.
+	ChunkSize int
+}
+
+// Encrypting returns an EncryptedFiler storing data in base encrypted with
+// keys, with file names left in the clear.
+func Encrypting(base absfs.Filer, keys *Keyring) *EncryptedFiler {
+	return &EncryptedFiler{Base: base, Keys: keys}
+}
+
+var _ absfs.Filer = (*EncryptedFiler)(nil)
+
+// encHeader is the parsed header of an encrypted file.
+type encHeader struct {
+	raw       []byte
+	chunkSize int
+	aead      cipher.AEAD
+}
+
+// contentAEAD derives the AEAD for a file from its key and salt.
+func contentAEAD(key, salt []byte) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("gofs content key"))
+	mac.Write(salt)
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// newHeader creates the header for a new file under the current key.
+func (e *EncryptedFiler) newHeader() (*encHeader, error) {
+	if e.Keys == nil {
+		return nil, ErrUnknownKey
+	}
+	key, err := e.Keys.key(e.Keys.Current)
+	if err != nil {
+		return nil, err
+	}
+	chunkSize := e.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = encDefaultCSz
+	}
+	if chunkSize > encMaxCSz {
+		return nil, fmt.Errorf("chunk size %d exceeds %d bytes", chunkSize, encMaxCSz)
+	}
+
+	raw := make([]byte, encFixedSize, encFixedSize+len(e.Keys.Current))
+	copy(raw, encMagic)
+	binary.BigEndian.PutUint32(raw[len(encMagic):], uint32(chunkSize))
+	salt := raw[len(encMagic)+4 : len(encMagic)+4+encSaltSize]
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	raw[encFixedSize-1] = byte(len(e.Keys.Current))
+	raw = append(raw, e.Keys.Current...)
+
+	aead, err := contentAEAD(key, salt)
+	if err != nil {
+		return nil, err
+	}
+	return &encHeader{raw: raw, chunkSize: chunkSize, aead: aead}, nil
+}
+
+// readHeader reads and parses the header at the start of r.
+func (e *EncryptedFiler) readHeader(r io.ReaderAt) (*encHeader, error) {
+	fixed := make([]byte, encFixedSize)
+	if _, err := r.ReadAt(fixed, 0); err != nil {
+		return nil, fmt.Errorf("reading encryption header: %w", ErrDecrypt)
+	}
+	if string(fixed[:len(encMagic)]) != encMagic {
+		return nil, fmt.Errorf("bad encryption header: %w", ErrDecrypt)
+	}
+	// The chunk size is only authenticated along with the first chunk, so
+	// it is bounded before any buffer of that size is allocated.
+	chunkSize := int(binary.BigEndian.Uint32(fixed[len(encMagic):]))
+	if chunkSize <= 0 || chunkSize > encMaxCSz {
+		return nil, fmt.Errorf("bad chunk size: %w", ErrDecrypt)
+	}
+
+	id := make([]byte, fixed[encFixedSize-1])
+	if _, err := r.ReadAt(id, int64(encFixedSize)); err != nil && len(id) > 0 {
+		return nil, fmt.Errorf("reading key ID: %w", ErrDecrypt)
+	}
+	key, err := e.Keys.key(string(id))
+	if err != nil {
+		return nil, err
+	}
+
+	salt := fixed[len(encMagic)+4 : len(encMagic)+4+encSaltSize]
+	aead, err := contentAEAD(key, salt)
+	if err != nil {
+		return nil, err
+	}
+	return &encHeader{raw: append(fixed, id...), chunkSize: chunkSize, aead: aead}, nil
+}
+
+// chunkNonce returns the nonce for chunk i.
+func chunkNonce(i int64, final bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce, uint64(i))
+	if final {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// sealedChunkSize is the size of an encrypted chunk of h.
+func (h *encHeader) sealedChunkSize() int64 {
+	return int64(h.chunkSize + h.aead.Overhead())
+}
+
+// plainSize computes the plaintext size of a file whose encrypted size is
+// size. It returns -1 if size is impossible for an intact file.
+func (h *encHeader) plainSize(size int64) int64 {
+	body := size - int64(len(h.raw))
+	sealed := h.sealedChunkSize()
+	chunks := (body + sealed - 1) / sealed
+	if body <= 0 || body-chunks*int64(h.aead.Overhead()) < 0 {
+		return -1
+	}
+	return body - chunks*int64(h.aead.Overhead())
+}
+
+// Name encryption. Each path component is encrypted deterministically with
+// a synthetic IV: iv = HMAC(macKey, name)[:16], ciphertext = AES-CTR(encKey,
+// iv, name), encoded as lowercase unpadded base32 of iv|ciphertext so that
+// the result is valid on case-insensitive filesystems.
+
+var nameEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+func (e *EncryptedFiler) nameKeys() (macKey, encKey []byte) {
+	mac := hmac.New(sha256.New, e.NameKey)
+	mac.Write([]byte("gofs name mac"))
+	macKey = mac.Sum(nil)
+	mac = hmac.New(sha256.New, e.NameKey)
+	mac.Write([]byte("gofs name enc"))
+	encKey = mac.Sum(nil)
+	return macKey, encKey
+}
+
+func (e *EncryptedFiler) encryptComponent(name string) string {
+	macKey, encKey := e.nameKeys()
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write([]byte(name))
+	iv := mac.Sum(nil)[:aes.BlockSize]
+
+	block, _ := aes.NewCipher(encKey)
+	out := make([]byte, aes.BlockSize+len(name))
+	copy(out, iv)
+	cipher.NewCTR(block, iv).XORKeyStream(out[aes.BlockSize:], []byte(name))
+	return nameEncoding.EncodeToString(out)
+}
+
+func (e *EncryptedFiler) decryptComponent(stored string) (string, bool) {
+	raw, err := nameEncoding.DecodeString(stored)
+	if err != nil || len(raw) < aes.BlockSize {
+		return "", false
+	}
+	macKey, encKey := e.nameKeys()
+	iv := raw[:aes.BlockSize]
+	block, _ := aes.NewCipher(encKey)
+	name := make([]byte, len(raw)-aes.BlockSize)
+	cipher.NewCTR(block, iv).XORKeyStream(name, raw[aes.BlockSize:])
+
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(name)
+	if !hmac.Equal(mac.Sum(nil)[:aes.BlockSize], iv) {
+		return "", false
+	}
+	return string(name), true
+}
+
+// storedPath maps a plaintext path to the path in Base.
+func (e *EncryptedFiler) storedPath(name string) string {
+	if e.NameKey == nil {
+		return name
+	}
+	parts := strings.Split(name, "/")
+	for i, part := range parts {
+		if part != "" && part != "." && part != ".." {
+			parts[i] = e.encryptComponent(part)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// plainName maps a stored base name back to plaintext.
+func (e *EncryptedFiler) plainName(stored string) (string, bool) {
+	if e.NameKey == nil || stored == "/" || stored == "." || stored == ".." {
+		return stored, true
+	}
+	return e.decryptComponent(stored)
+}
+
+// plainInfo returns info as seen through the EncryptedFiler: the plaintext
+// name and, for regular files, the plaintext size.
+func (e *EncryptedFiler) plainInfo(name string, info os.FileInfo, openBase func() (absfs.File, error)) os.FileInfo {
+	pi := &encInfo{FileInfo: info, name: name, size: info.Size()}
+	if info.Mode().IsRegular() {
+		pi.size = -1
+		if f, err := openBase(); err == nil {
+			if h, err := e.readHeader(f); err == nil {
+				pi.size = h.plainSize(info.Size())
+			}
+			f.Close()
+		}
+	}
+	return pi
+}
+
+// encInfo is a FileInfo with the plaintext name and size.
+type encInfo struct {
+	os.FileInfo
+	name string
+	size int64
+}
+
+func (i *encInfo) Name() string { return i.name }
+func (i *encInfo) Size() int64  { return i.size }
+
+func baseName(name string) string {
+	name = strings.TrimRight(name, "/")
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		return name[i+1:]
+	}
+	if name == "" {
+		return "/"
+	}
+	return name
+}
+
+// OpenFile opens the named file. See EncryptedFiler for the restrictions on
+// files opened for writing.
+func (e *EncryptedFiler) OpenFile(name string, flag int, perm os.FileMode) (absfs.File, error) {
+	stored := e.storedPath(name)
+	writable := flag&absfs.O_ACCESS != os.O_RDONLY
+	if !writable {
+		f, err := e.Base.OpenFile(stored, flag, perm)
+		if err != nil {
+			return nil, err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if info.IsDir() {
+			return &encFile{File: f, e: e, name: name}, nil
+		}
+		h, err := e.readHeader(f)
+		if err != nil {
+			f.Close()
+			return nil, &os.PathError{Op: "open", Path: name, Err: err}
+		}
+		return &encFile{File: f, e: e, name: name, h: h, size: h.plainSize(info.Size()), chunk: -1}, nil
+	}
+
+	if flag&os.O_TRUNC == 0 {
+		if _, err := e.Base.Stat(stored); err == nil {
+			return nil, &os.PathError{Op: "open", Path: name, Err: absfs.ErrNotImplemented}
+		}
+	}
+	if flag&os.O_APPEND != 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: absfs.ErrNotImplemented}
+	}
+	h, err := e.newHeader()
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	f, err := e.Base.OpenFile(stored, flag&^os.O_RDWR|os.O_WRONLY, perm)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(h.raw); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &encFile{File: f, e: e, name: name, h: h, writing: true}, nil
+}
+
+// Mkdir creates a directory, encrypting its name if enabled.
+func (e *EncryptedFiler) Mkdir(name string, perm os.FileMode) error {
+	return e.Base.Mkdir(e.storedPath(name), perm)
+}
+
+// Remove removes the named file or empty directory.
+func (e *EncryptedFiler) Remove(name string) error {
+	return e.Base.Remove(e.storedPath(name))
+}
+
+// Rename renames a file. The contents are not re-encrypted.
+func (e *EncryptedFiler) Rename(oldpath, newpath string) error {
+	return e.Base.Rename(e.storedPath(oldpath), e.storedPath(newpath))
+}
+
+// Stat returns the FileInfo for the named file with its plaintext name and
+// size. The size is -1 if the file's header cannot be read.
+func (e *EncryptedFiler) Stat(name string) (os.FileInfo, error) {
+	stored := e.storedPath(name)
+	info, err := e.Base.Stat(stored)
+	if err != nil {
+		return nil, err
+	}
+	return e.plainInfo(baseName(name), info, func() (absfs.File, error) {
+		return e.Base.OpenFile(stored, os.O_RDONLY, 0)
+	}), nil
+}
+
+// Chmod changes the mode of the named file.
+func (e *EncryptedFiler) Chmod(name string, mode os.FileMode) error {
+	return e.Base.Chmod(e.storedPath(name), mode)
+}
+
+// Chtimes changes the access and modification times of the named file.
+func (e *EncryptedFiler) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return e.Base.Chtimes(e.storedPath(name), atime, mtime)
+}
+
+// Chown changes the owner and group of the named file.
+func (e *EncryptedFiler) Chown(name string, uid, gid int) error {
+	return e.Base.Chown(e.storedPath(name), uid, gid)
+}
+
+// ReadDir reads the named directory, returning entries with plaintext names
+// sorted by name. Entries whose names cannot be
+// decrypted, such as files placed in Base by other means, are omitted.
+func (e *EncryptedFiler) ReadDir(name string) ([]fs.DirEntry, error) {
+	f, err := e.OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	entries, err := f.ReadDir(-1)
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return entries, err
+}
+
+// ReadFile reads and decrypts the named file.
+func (e *EncryptedFiler) ReadFile(name string) ([]byte, error) {
+	f, err := e.OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// Sub returns an fs.FS of the decrypted subtree rooted at dir.
+func (e *EncryptedFiler) Sub(dir string) (fs.FS, error) {
+	return absfs.FilerToFS(e, dir)
+}
+
+// Rekey re-encrypts the named file under the Keyring's current key. The
+// new contents are written to a temporary file next to it and renamed over
+// the original, so the file is never left partially re-encrypted. If Base
+// refuses to rename over an existing file, the original is removed first.
+func (e *EncryptedFiler) Rekey(name string) error {
+	data, err := e.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	info, err := e.Base.Stat(e.storedPath(name))
+	if err != nil {
+		return err
+	}
+	tmp := name + ".rekey"
+	f, err := e.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		e.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		e.Remove(tmp)
+		return err
+	}
+	err = e.Rename(tmp, name)
+	if errors.Is(err, fs.ErrExist) {
+		if err = e.Remove(name); err == nil {
+			err = e.Rename(tmp, name)
+		}
+	}
+	return err
+}
+
+// encFile is a file opened through an EncryptedFiler. It is a directory
+// when h is nil, a reader when writing is false, and a writer otherwise.
+type encFile struct {
+	absfs.File
+	e    *EncryptedFiler
+	name string
+	h    *encHeader
+
+	// Reader state.
+	size  int64
+	pos   int64
+	chunk int64 // index of the chunk cached in plain, or -1
+	plain []byte
+
+	// Writer state.
+	writing bool
+	index   int64
+	buf     []byte
+	closed  bool
+}
+
+func (f *encFile) Name() string { return f.name }
+
+func (f *encFile) Stat() (os.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	switch {
+	case f.writing:
+		size = f.index*int64(f.h.chunkSize) + int64(len(f.buf))
+	case f.h != nil:
+		size = f.size
+	}
+	return &encInfo{FileInfo: info, name: baseName(f.name), size: size}, nil
+}
+
+func (f *encFile) pathErr(op string, err error) error {
+	return &os.PathError{Op: op, Path: f.name, Err: err}
+}
+
+// loadChunk decrypts chunk i into f.plain.
+func (f *encFile) loadChunk(i int64) error {
+	if f.chunk == i {
+		return nil
+	}
+	sealedSize := f.h.sealedChunkSize()
+	last := (f.size - 1) / int64(f.h.chunkSize)
+	if f.size == 0 {
+		last = 0
+	}
+	sealed := make([]byte, sealedSize)
+	n, err := f.File.ReadAt(sealed, int64(len(f.h.raw))+i*sealedSize)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	plain, err := f.h.aead.Open(sealed[:0], chunkNonce(i, i == last), sealed[:n], f.h.raw)
+	if err != nil {
+		return ErrDecrypt
+	}
+	f.chunk, f.plain = i, plain
+	return nil
+}
+
+// ReadAt decrypts len(p) bytes starting at plaintext offset off.
+func (f *encFile) ReadAt(p []byte, off int64) (int, error) {
+	if f.h == nil || f.writing {
+		return 0, f.pathErr("read", absfs.ErrNotImplemented)
+	}
+	if off < 0 {
+		return 0, f.pathErr("read", fs.ErrInvalid)
+	}
+	if f.size < 0 {
+		return 0, f.pathErr("read", ErrDecrypt)
+	}
+	n := 0
+	for n < len(p) {
+		if off >= f.size {
+			// Authenticate the final chunk even for empty reads at EOF, so a
+			// truncated file is never mistaken for a complete one.
+			if f.size == 0 {
+				if err := f.loadChunk(0); err != nil {
+					return n, f.pathErr("read", err)
+				}
+			}
+			return n, io.EOF
+		}
+		i := off / int64(f.h.chunkSize)
+		if err := f.loadChunk(i); err != nil {
+			return n, f.pathErr("read", err)
+		}
+		c := copy(p[n:], f.plain[off-i*int64(f.h.chunkSize):])
+		n += c
+		off += int64(c)
+	}
+	return n, nil
+}
+
+func (f *encFile) Read(p []byte) (int, error) {
+	if f.h == nil {
+		return f.File.Read(p)
+	}
+	n, err := f.ReadAt(p, f.pos)
+	f.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *encFile) Seek(offset int64, whence int) (int64, error) {
+	if f.h == nil || f.writing {
+		return 0, f.pathErr("seek", absfs.ErrNotImplemented)
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.pos
+	case io.SeekEnd:
+		offset += f.size
+	default:
+		return 0, f.pathErr("seek", fs.ErrInvalid)
+	}
+	if offset < 0 {
+		return 0, f.pathErr("seek", fs.ErrInvalid)
+	}
+	f.pos = offset
+	return offset, nil
+}
+
+// flush seals and writes the buffered chunk.
+func (f *encFile) flush(final bool) error {
+	sealed := f.h.aead.Seal(nil, chunkNonce(f.index, final), f.buf, f.h.raw)
+	if _, err := f.File.Write(sealed); err != nil {
+		return err
+	}
+	f.index++
+	f.buf = f.buf[:0]
+	return nil
+}
+
+func (f *encFile) Write(p []byte) (int, error) {
+	if !f.writing || f.closed {
+		return 0, f.pathErr("write", os.ErrPermission)
+	}
+	n := 0
+	for len(p) > 0 {
+		// A full buffer is only sealed once more data arrives, because the
+		// last chunk must be sealed as final.
+		if len(f.buf) == f.h.chunkSize {
+			if err := f.flush(false); err != nil {
+				return n, f.pathErr("write", err)
+			}
+		}
+		if f.buf == nil {
+			f.buf = make([]byte, 0, f.h.chunkSize)
+		}
+		c := copy(f.buf[len(f.buf):f.h.chunkSize], p)
+		f.buf = f.buf[:len(f.buf)+c]
+		p = p[c:]
+		n += c
+	}
+	return n, nil
+}
+
+func (f *encFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *encFile) WriteAt(p []byte, off int64) (int, error) {
+	return 0, f.pathErr("writeat", absfs.ErrNotImplemented)
+}
+
+func (f *encFile) Truncate(size int64) error {
+	return f.pathErr("truncate", absfs.ErrNotImplemented)
+}
+
+func (f *encFile) Readdir(n int) ([]os.FileInfo, error) {
+	infos, err := f.File.Readdir(n)
+	out := infos[:0]
+	for _, info := range infos {
+		name, ok := f.e.plainName(info.Name())
+		if !ok {
+			continue
+		}
+		stored := joinName(f.File.Name(), info.Name())
+		out = append(out, f.e.plainInfo(name, info, func() (absfs.File, error) {
+			return f.e.Base.OpenFile(stored, os.O_RDONLY, 0)
+		}))
+	}
+	return out, err
+}
+
+func (f *encFile) Readdirnames(n int) ([]string, error) {
+	infos, err := f.Readdir(n)
+	names := make([]string, len(infos))
+	for i, info := range infos {
+		names[i] = info.Name()
+	}
+	return names, err
+}
+
+func (f *encFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	entries, err := f.File.ReadDir(n)
+	out := entries[:0]
+	for _, entry := range entries {
+		name, ok := f.e.plainName(entry.Name())
+		if !ok {
+			continue
+		}
+		out = append(out, &encEntry{DirEntry: entry, f: f, name: name})
+	}
+	return out, err
+}
+
+// encEntry is a directory entry with its plaintext name and size.
+type encEntry struct {
+	fs.DirEntry
+	f    *encFile
+	name string
+}
+
+func (e *encEntry) Name() string { return e.name }
+
+func (e *encEntry) Info() (fs.FileInfo, error) {
+	info, err := e.DirEntry.Info()
+	if err != nil {
+		return nil, err
+	}
+	stored := joinName(e.f.File.Name(), e.DirEntry.Name())
+	return e.f.e.plainInfo(e.name, info, func() (absfs.File, error) {
+		return e.f.e.Base.OpenFile(stored, os.O_RDONLY, 0)
+	}), nil
+}
+
+// Close seals the final chunk of a file being written and closes it.
+func (f *encFile) Close() error {
+	if f.writing && !f.closed {
+		f.closed = true
+		if err := f.flush(true); err != nil {
+			f.File.Close()
+			return f.pathErr("close", err)
+		}
+	}
+	return f.File.Close()
+}
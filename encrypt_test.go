@@ -0,0 +1,235 @@
+package gofs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/absfs/memfs"
+)
+
+func testKeyring() *Keyring {
+	return &Keyring{
+		Keys:    map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)},
+		Current: "k1",
+	}
+}
+
+func setupEncryptFS(t *testing.T, nameKey []byte) (*memfs.FileSystem, *EncryptedFiler) {
+	t.Helper()
+	mfs, err := memfs.NewFS()
+	if err != nil {
+		t.Fatalf("Failed to create memfs: %v", err)
+	}
+	e := &EncryptedFiler{Base: mfs, Keys: testKeyring(), NameKey: nameKey, ChunkSize: 16}
+	return mfs, e
+}
+
+func encWrite(t *testing.T, e *EncryptedFiler, name string, data []byte) {
+	t.Helper()
+	f, err := e.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncryptedFiler(t *testing.T) {
+	sizes := []int{0, 1, 15, 16, 17, 32, 100}
+	for _, nameKey := range [][]byte{nil, []byte("name key")} {
+		mfs, e := setupEncryptFS(t, nameKey)
+		if err := e.Mkdir("/dir", 0755); err != nil {
+			t.Fatal(err)
+		}
+		files := map[string]string{}
+		for _, n := range sizes {
+			name := "dir/f" + strings.Repeat("x", n%7) + string(rune('a'+n%26))
+			data := strings.Repeat("0123456789", 11)[:n]
+			encWrite(t, e, "/"+name, []byte(data))
+			files[name] = data
+		}
+
+		gfs, _ := NewFs(e)
+		for name, want := range files {
+			got, err := gfs.ReadFile(name)
+			if err != nil || string(got) != want {
+				t.Errorf("ReadFile(%q) = %q, %v; want %q", name, got, err, want)
+			}
+			info, err := gfs.Stat(name)
+			if err != nil || info.Size() != int64(len(want)) {
+				t.Errorf("Stat(%q) size = %v, %v; want %d", name, info.Size(), err, len(want))
+			}
+		}
+
+		sub, err := e.Sub("/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for name := range files {
+			names = append(names, name)
+		}
+		if err := fstest.TestFS(sub, names...); err != nil {
+			t.Errorf("nameKey=%q: %v", nameKey, err)
+		}
+
+		// The plaintext must not appear in the underlying filesystem.
+		raw, _ := mfs.ReadFile("/" + e.storedPath("dir/fxxw")) // the 100-byte file
+		if len(raw) == 0 || bytes.Contains(raw, []byte("0123456789")) {
+			t.Error("plaintext visible in stored file")
+		}
+		entries, _ := mfs.ReadDir("/" + e.storedPath("dir"))
+		for _, entry := range entries {
+			if nameKey != nil && strings.HasPrefix(entry.Name(), "f") {
+				t.Errorf("stored name %q not encrypted", entry.Name())
+			}
+		}
+	}
+}
+
+func TestEncryptedFiler_ReadAtSeek(t *testing.T) {
+	_, e := setupEncryptFS(t, nil)
+	data := []byte(strings.Repeat("abcdefghijklmnopqrstuvwxyz", 5))
+	encWrite(t, e, "/f", data)
+
+	gfs, _ := NewFs(e)
+	f, err := gfs.Open("f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	ra := f.(io.ReaderAt)
+	for _, off := range []int{0, 5, 15, 16, 31, 100, 125} {
+		buf := make([]byte, 20)
+		n, err := ra.ReadAt(buf, int64(off))
+		want := data[off:min(off+20, len(data))]
+		if !bytes.Equal(buf[:n], want) || (len(want) == 20 && err != nil) {
+			t.Errorf("ReadAt(%d) = %q, %v; want %q", off, buf[:n], err, want)
+		}
+	}
+
+	s := f.(io.Seeker)
+	if pos, err := s.Seek(-10, io.SeekEnd); err != nil || pos != int64(len(data)-10) {
+		t.Fatalf("Seek = %d, %v", pos, err)
+	}
+	rest, err := io.ReadAll(f)
+	if err != nil || !bytes.Equal(rest, data[len(data)-10:]) {
+		t.Errorf("read after seek = %q, %v", rest, err)
+	}
+}
+
+func TestEncryptedFiler_Tamper(t *testing.T) {
+	mfs, e := setupEncryptFS(t, nil)
+	data := []byte(strings.Repeat("0123456789abcdef", 4)) // exactly 4 chunks
+	encWrite(t, e, "/f", data)
+	orig, _ := mfs.ReadFile("/f")
+	hdr := encFixedSize + len("k1")
+	chunk := 16 + 16
+
+	tamper := map[string]func([]byte) []byte{
+		"flip bit": func(b []byte) []byte { b[hdr+3] ^= 1; return b },
+		"swap chunks": func(b []byte) []byte {
+			c0 := append([]byte(nil), b[hdr:hdr+chunk]...)
+			copy(b[hdr:], b[hdr+chunk:hdr+2*chunk])
+			copy(b[hdr+chunk:], c0)
+			return b
+		},
+		"drop last chunk": func(b []byte) []byte { return b[:len(b)-chunk] },
+		"truncate header": func(b []byte) []byte { return b[:10] },
+		"change key id":   func(b []byte) []byte { b[hdr-1] = '2'; return b },
+		"huge chunk size": func(b []byte) []byte { copy(b[len(encMagic):], []byte{0xff, 0xff, 0xff, 0xff}); return b },
+	}
+	for name, fn := range tamper {
+		t.Run(name, func(t *testing.T) {
+			b := fn(append([]byte(nil), orig...))
+			if err := writeFile(mfs, "/f", b); err != nil {
+				t.Fatal(err)
+			}
+			_, err := e.ReadFile("/f")
+			if !errors.Is(err, ErrDecrypt) && !errors.Is(err, ErrUnknownKey) {
+				t.Errorf("ReadFile error = %v, want authentication failure", err)
+			}
+		})
+	}
+}
+
+func TestEncryptedFiler_UniqueNonces(t *testing.T) {
+	mfs, e := setupEncryptFS(t, nil)
+	encWrite(t, e, "/a", []byte("same"))
+	encWrite(t, e, "/b", []byte("same"))
+	a, _ := mfs.ReadFile("/a")
+	b, _ := mfs.ReadFile("/b")
+	if bytes.Equal(a, b) {
+		t.Error("identical plaintexts produced identical ciphertexts")
+	}
+}
+
+func TestEncryptedFiler_KeyRotation(t *testing.T) {
+	mfs, e := setupEncryptFS(t, []byte("names"))
+	encWrite(t, e, "/old", []byte("secret"))
+
+	e.Keys.Keys["k2"] = bytes.Repeat([]byte{2}, 32)
+	e.Keys.Current = "k2"
+	encWrite(t, e, "/new", []byte("fresh"))
+
+	for name, want := range map[string]string{"/old": "secret", "/new": "fresh"} {
+		if got, err := e.ReadFile(name); err != nil || string(got) != want {
+			t.Errorf("ReadFile(%q) = %q, %v", name, got, err)
+		}
+	}
+
+	if err := e.Rekey("/old"); err != nil {
+		t.Fatal(err)
+	}
+	delete(e.Keys.Keys, "k1")
+	if got, err := e.ReadFile("/old"); err != nil || string(got) != "secret" {
+		t.Errorf("after Rekey ReadFile = %q, %v", got, err)
+	}
+	entries, err := e.ReadDir("/")
+	if err != nil || len(entries) != 2 {
+		t.Errorf("ReadDir = %v, %v; want 2 entries", entries, err)
+	}
+	if _, err := mfs.Stat("/" + e.storedPath("old.rekey")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+}
+
+func TestEncryptedFiler_WriteRestrictions(t *testing.T) {
+	_, e := setupEncryptFS(t, nil)
+	encWrite(t, e, "/f", []byte("data"))
+	if _, err := e.OpenFile("/f", os.O_WRONLY, 0); err == nil {
+		t.Error("writable open without O_TRUNC succeeded")
+	}
+	if _, err := e.OpenFile("/f", os.O_WRONLY|os.O_APPEND, 0); err == nil {
+		t.Error("append open succeeded")
+	}
+}
+
+func TestEncryptedFiler_BadKeys(t *testing.T) {
+	_, e := setupEncryptFS(t, nil)
+	encWrite(t, e, "/f", []byte("data"))
+
+	e.Keys.Keys["short"] = []byte("too short")
+	if _, err := e.ReadFile("/f"); err == nil {
+		t.Error("ReadFile with an invalid key in the keyring succeeded")
+	}
+	if _, err := e.OpenFile("/g", os.O_WRONLY|os.O_CREATE, 0644); err == nil {
+		t.Error("OpenFile with an invalid key in the keyring succeeded")
+	}
+	delete(e.Keys.Keys, "short")
+
+	e.ChunkSize = encMaxCSz + 1
+	if _, err := e.OpenFile("/g", os.O_WRONLY|os.O_CREATE, 0644); err == nil {
+		t.Error("OpenFile with an oversized ChunkSize succeeded")
+	}
+}
@@ -1,6 +1,7 @@
 package gofs_test
 
 import (
+	"crypto"
 	"fmt"
 	"io/fs"
 	"log"
@@ -259,3 +260,43 @@ func Example_fileRead() {
 	// DEF
 	// GH
 }
+
+// ExampleTreeDigest demonstrates locating the subtrees that changed between
+// two digests of the same filesystem.
+func ExampleTreeDigest() {
+	mfs, _ := memfs.NewFS()
+	mfs.Mkdir("config", 0755)
+	mfs.Mkdir("static", 0755)
+	writeFile(mfs, "config/app.yaml", []byte("debug: false"))
+	writeFile(mfs, "static/index.html", []byte("<html></html>"))
+
+	fsys, _ := gofs.NewFs(mfs)
+	before, _ := gofs.TreeDigest(fsys, ".", crypto.SHA256)
+
+	writeFile(mfs, "config/app.yaml", []byte("debug: true"))
+	after, _ := gofs.TreeDigest(fsys, ".", crypto.SHA256)
+
+	for _, name := range after.Changed(before) {
+		fmt.Println(name)
+	}
+	// Output:
+	// .
+	// config
+	// config/app.yaml
+}
+
+// ExampleWalk demonstrates ranging over a file tree with an iterator.
+func ExampleWalk() {
+	mfs, _ := memfs.NewFS()
+	mfs.Mkdir("site", 0755)
+	writeFile(mfs, "site/index.html", []byte("<html></html>"))
+
+	fsys, _ := gofs.NewFs(mfs)
+
+	for name, d := range gofs.Walk(fsys, "site") {
+		fmt.Printf("%s (dir: %v)\n", name, d.IsDir())
+	}
+	// Output:
+	// site (dir: true)
+	// site/index.html (dir: false)
+}
@@ -0,0 +1,364 @@
+package gofs
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+)
+
+// FilterOptions configures Filter.
+type FilterOptions struct {
+	// Include, if non-empty, restricts the view to files matching at least
+	// one of these patterns. Patterns use the GlobAll syntax and are matched
+	// against the path relative to the root. Directories are kept
+	// regardless, so matches below them stay reachable.
+	Include []string
+
+	// Exclude lists patterns, in the GlobAll syntax, for files and
+	// directories to hide. Hiding a directory hides everything below it.
+	Exclude []string
+
+	// GitIgnore hides the files ignored by the .gitignore files in the
+	// tree, as git would, along with any ".git" directory.
+	GitIgnore bool
+}
+
+// FilterFS is a read-only view of an fs.FS showing only the files selected
+// by its FilterOptions. It implements fs.FS, fs.StatFS, fs.ReadDirFS and
+// fs.ReadFileFS.
+//
+// Hidden files are left out of directory listings, and opening or
+// statting them fails with fs.ErrNotExist, as if they did not exist.
+//
+// With GitIgnore set, .gitignore files are read from the wrapped filesystem
+// itself, in the root and in every directory below it, and interpreted as
+// git does: later patterns override earlier ones, patterns in a deeper
+// .gitignore override those above it, "!" re-includes a file, a trailing "/"
+// matches only directories, a "/" at the start or in the middle anchors a
+// pattern to the directory of its .gitignore, and "**" matches any number of
+// directories. As in git, a file cannot be re-included if a directory
+// containing it is ignored. The root of the view is taken as the root of the
+// repository; ignore files above it, in .git/info/exclude or configured
+// through core.excludesFile are not consulted.
+//
+// Each .gitignore is read once and cached; Reset clears the cache.
+type FilterFS struct {
+	// FS is the wrapped filesystem.
+	FS fs.FS
+
+	include   []*globMatcher
+	exclude   []*globMatcher
+	gitIgnore bool
+
+	mu      sync.Mutex
+	ignores map[string][]ignoreRule // dir -> rules of its .gitignore
+}
+
+// Filter returns a FilterFS over fsys. It fails if a pattern in opts is
+// malformed.
+func Filter(fsys fs.FS, opts FilterOptions) (*FilterFS, error) {
+	f := &FilterFS{FS: fsys, gitIgnore: opts.GitIgnore}
+	for _, p := range opts.Include {
+		m, err := compileGlob(p, true, false)
+		if err != nil {
+			return nil, err
+		}
+		f.include = append(f.include, m)
+	}
+	for _, p := range opts.Exclude {
+		m, err := compileGlob(p, true, false)
+		if err != nil {
+			return nil, err
+		}
+		f.exclude = append(f.exclude, m)
+	}
+	return f, nil
+}
+
+// Reset discards the cached .gitignore rules.
+func (f *FilterFS) Reset() {
+	f.mu.Lock()
+	f.ignores = nil
+	f.mu.Unlock()
+}
+
+// hidden reports whether the file name, a directory if isDir is set, is
+// filtered out. The directories containing it are not checked.
+func (f *FilterFS) hidden(name string, isDir bool) (bool, error) {
+	if matchAny(f.exclude, name) {
+		return true, nil
+	}
+	if !isDir && len(f.include) > 0 && !matchAny(f.include, name) {
+		return true, nil
+	}
+	if f.gitIgnore {
+		return f.ignored(name, isDir)
+	}
+	return false, nil
+}
+
+// check returns the FileInfo of name, or an error if it or a directory
+// containing it is filtered out.
+func (f *FilterFS) check(op, name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name != "." {
+		comps := strings.Split(name, "/")
+		dir := "."
+		for _, comp := range comps[:len(comps)-1] {
+			dir = joinName(dir, comp)
+			if hidden, err := f.hidden(dir, true); err != nil || hidden {
+				return nil, f.hiddenError(op, name, err)
+			}
+		}
+	}
+	info, err := fs.Stat(f.FS, name)
+	if err != nil {
+		return nil, pathError(op, name, err)
+	}
+	if name != "." {
+		if hidden, err := f.hidden(name, info.IsDir()); err != nil || hidden {
+			return nil, f.hiddenError(op, name, err)
+		}
+	}
+	return info, nil
+}
+
+// hiddenError returns the error for name being hidden, or err if the
+// filters could not be evaluated.
+func (f *FilterFS) hiddenError(op, name string, err error) error {
+	if err != nil {
+		return pathError(op, name, err)
+	}
+	return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+}
+
+// filterEntries returns the entries of the directory dir that are not
+// filtered out.
+func (f *FilterFS) filterEntries(dir string, entries []fs.DirEntry) ([]fs.DirEntry, error) {
+	kept := entries[:0]
+	for _, e := range entries {
+		hidden, err := f.hidden(joinName(dir, e.Name()), e.IsDir())
+		if err != nil {
+			return nil, err
+		}
+		if !hidden {
+			kept = append(kept, e)
+		}
+	}
+	return kept, nil
+}
+
+// Open opens the named file.
+func (f *FilterFS) Open(name string) (fs.File, error) {
+	info, err := f.check("open", name)
+	if err != nil {
+		return nil, err
+	}
+	file, err := f.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &filterDir{File: file, f: f, dir: name}, nil
+	}
+	return file, nil
+}
+
+// Stat returns the FileInfo of the named file.
+func (f *FilterFS) Stat(name string) (fs.FileInfo, error) {
+	return f.check("stat", name)
+}
+
+// ReadDir reads the named directory, leaving out hidden entries.
+func (f *FilterFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if _, err := f.check("readdir", name); err != nil {
+		return nil, err
+	}
+	entries, err := fs.ReadDir(f.FS, name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err = f.filterEntries(name, entries)
+	if err != nil {
+		return nil, pathError("readdir", name, err)
+	}
+	return entries, nil
+}
+
+// ReadFile reads the named file.
+func (f *FilterFS) ReadFile(name string) ([]byte, error) {
+	if _, err := f.check("readfile", name); err != nil {
+		return nil, err
+	}
+	return fs.ReadFile(f.FS, name)
+}
+
+// filterDir is a directory opened through a FilterFS.
+type filterDir struct {
+	fs.File
+	f   *FilterFS
+	dir string
+}
+
+// ReadDir implements fs.ReadDirFile, leaving out hidden entries.
+func (d *filterDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rd, ok := d.File.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: d.dir, Err: errors.ErrUnsupported}
+	}
+	for {
+		entries, err := rd.ReadDir(n)
+		kept, ferr := d.f.filterEntries(d.dir, entries)
+		if ferr != nil {
+			return nil, pathError("readdir", d.dir, ferr)
+		}
+		// A batch that was filtered out entirely must not be mistaken
+		// for the end of the directory.
+		if len(kept) > 0 || err != nil || n <= 0 {
+			return kept, err
+		}
+	}
+}
+
+// ignoreRule is a pattern from a .gitignore file.
+type ignoreRule struct {
+	segments []string // pattern split at "/"; "**" matches any directories
+	negate   bool
+	dirOnly  bool
+}
+
+// parseGitIgnore returns the rules of a .gitignore file.
+func parseGitIgnore(data []byte) []ignoreRule {
+	var rules []ignoreRule
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSuffix(sc.Text(), "\r")
+		// Trailing spaces are dropped unless escaped with a backslash.
+		for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+			line = line[:len(line)-1]
+		}
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		var r ignoreRule
+		if line[0] == '!' {
+			r.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			r.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		// A pattern without a slash, other than a trailing one, matches at
+		// any depth; otherwise it is relative to the .gitignore's directory.
+		anchored := strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+		if !anchored {
+			r.segments = append(r.segments, "**")
+		}
+		for _, seg := range strings.Split(line, "/") {
+			// path.Match negates a class with "^", git also with "!".
+			seg = strings.ReplaceAll(seg, "[!", "[^")
+			r.segments = append(r.segments, seg)
+		}
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+// match reports whether the rule matches name, relative to the directory
+// of its .gitignore.
+func (r *ignoreRule) match(name string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	return matchIgnoreSegments(r.segments, strings.Split(name, "/"))
+}
+
+// matchIgnoreSegments matches the components of a name against pattern
+// segments. A "**" segment matches any number of components, except at the
+// end of a pattern, where it matches at least one: "dir/**" matches what is
+// inside dir but not dir itself.
+func matchIgnoreSegments(pat, name []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			if len(pat) == 1 {
+				return len(name) > 0
+			}
+			for i := range len(name) + 1 {
+				if matchIgnoreSegments(pat[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		// Malformed patterns match nothing, as in git.
+		if ok, _ := path.Match(pat[0], name[0]); !ok {
+			return false
+		}
+		pat, name = pat[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// ignoreRules returns the rules of the .gitignore in dir, reading it if it
+// is not cached.
+func (f *FilterFS) ignoreRules(dir string) ([]ignoreRule, error) {
+	f.mu.Lock()
+	rules, ok := f.ignores[dir]
+	f.mu.Unlock()
+	if ok {
+		return rules, nil
+	}
+	data, err := fs.ReadFile(f.FS, joinName(dir, ".gitignore"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	rules = parseGitIgnore(data)
+	f.mu.Lock()
+	if f.ignores == nil {
+		f.ignores = make(map[string][]ignoreRule)
+	}
+	f.ignores[dir] = rules
+	f.mu.Unlock()
+	return rules, nil
+}
+
+// ignored reports whether the .gitignore files in the directories above
+// name ignore it. The directories containing name are not checked.
+func (f *FilterFS) ignored(name string, isDir bool) (bool, error) {
+	comps := strings.Split(name, "/")
+	if isDir && comps[len(comps)-1] == ".git" {
+		return true, nil
+	}
+	ignored := false
+	for i := range comps {
+		dir := "."
+		if i > 0 {
+			dir = strings.Join(comps[:i], "/")
+		}
+		rules, err := f.ignoreRules(dir)
+		if err != nil {
+			return false, err
+		}
+		rel := strings.Join(comps[i:], "/")
+		for j := range rules {
+			if rules[j].match(rel, isDir) {
+				ignored = !rules[j].negate
+			}
+		}
+	}
+	return ignored, nil
+}
@@ -0,0 +1,131 @@
+package gofs
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/absfs/memfs"
+)
+
+func TestFilter(t *testing.T) {
+	mfs, _ := memfs.NewFS()
+	mkdirs(mfs, "/.git", "/build", "/src", "/src/gen", "/src/lib", "/src/lib/build", "/docs", "/logs")
+	for name, data := range map[string]string{
+		"/.git/HEAD":         "ref",
+		"/.gitignore":        "# build output\n/build/\n*.log\n!keep.log\nlogs/\n*.tmp\n",
+		"/app.go":            "app",
+		"/debug.log":         "log",
+		"/keep.log":          "keep",
+		"/build/app":         "bin",
+		"/logs/keep.log":     "hidden by its directory",
+		"/src/.gitignore":    "gen/*\n!gen/keep.go\n!*.tmp\nlib/**/*.o\n",
+		"/src/main.go":       "main",
+		"/src/x.tmp":         "tmp",
+		"/src/gen/out.go":    "gen",
+		"/src/gen/keep.go":   "keep",
+		"/src/lib/lib.go":    "lib",
+		"/src/lib/lib.o":     "obj",
+		"/src/lib/build/app": "not anchored at the root",
+		"/docs/guide.md":     "guide",
+		"/docs/notes.txt":    "notes",
+		"/docs/draft.md":     "draft",
+	} {
+		writeFile(mfs, name, []byte(data))
+	}
+	gfs, _ := NewFs(mfs)
+
+	ff, err := Filter(gfs, FilterOptions{GitIgnore: true, Exclude: []string{"docs/draft.*"}, Include: []string{"**/*.go", "**/*.md", "**/*.log", "**/*.tmp", "**/app", "**/.gitignore"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	err = fs.WalkDir(ff, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		got = append(got, name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ". .gitignore app.go docs docs/guide.md keep.log src src/.gitignore src/gen src/gen/keep.go src/lib src/lib/build src/lib/build/app src/lib/lib.go src/main.go src/x.tmp"
+	if strings.Join(got, " ") != want {
+		t.Errorf("walk = %v\nwant   %v", got, want)
+	}
+
+	for _, name := range []string{"debug.log", "build", "build/app", "logs/keep.log", ".git/HEAD", "src/gen/out.go", "src/lib/lib.o", "docs/notes.txt", "docs/draft.md"} {
+		if _, err := ff.Stat(name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Stat(%q) error = %v, want ErrNotExist", name, err)
+		}
+		if _, err := ff.Open(name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Open(%q) error = %v, want ErrNotExist", name, err)
+		}
+	}
+	if data, err := ff.ReadFile("src/gen/keep.go"); err != nil || string(data) != "keep" {
+		t.Errorf("ReadFile(src/gen/keep.go) = %q, %v", data, err)
+	}
+
+	// Directories opened through the view list only visible entries, even
+	// when read in small batches.
+	d, err := ff.Open("src/gen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	entries, err := d.(fs.ReadDirFile).ReadDir(1)
+	if err != nil || len(entries) != 1 || entries[0].Name() != "keep.go" {
+		t.Errorf("ReadDir(1) = %v, %v; want [keep.go]", entries, err)
+	}
+
+	if _, err := Filter(gfs, FilterOptions{Exclude: []string{"src/[a"}}); !errors.Is(err, path.ErrBadPattern) {
+		t.Errorf("Filter error = %v, want path.ErrBadPattern", err)
+	}
+}
+
+func TestIgnoreRuleMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		isDir   bool
+		want    bool
+	}{
+		{"*.o", "a.o", false, true},
+		{"*.o", "x/y/a.o", false, true},
+		{"/a.o", "x/a.o", false, false},
+		{"/a.o", "a.o", false, true},
+		{"doc/frotz", "doc/frotz", true, true},
+		{"doc/frotz", "a/doc/frotz", true, false},
+		{"frotz/", "a/frotz", true, true},
+		{"frotz/", "a/frotz", false, false},
+		{"**/foo", "a/b/foo", false, true},
+		{"**/foo/bar", "foo/bar", false, true},
+		{"abc/**", "abc", true, false},
+		{"abc/**", "abc/x/y", false, true},
+		{"a/**/b", "a/b", false, true},
+		{"a/**/b", "a/x/y/b", false, true},
+		{"[!a]*", "bcd", false, true},
+		{"[!a]*", "abc", false, false},
+		{`\#hash`, "#hash", false, true},
+		{`\!bang`, "!bang", false, true},
+		{`trail\ `, "trail ", false, true},
+		{"trail   ", "trail", false, true},
+	}
+	for _, tt := range tests {
+		rules := parseGitIgnore([]byte(tt.pattern))
+		if len(rules) != 1 {
+			t.Errorf("parseGitIgnore(%q) = %d rules, want 1", tt.pattern, len(rules))
+			continue
+		}
+		if got := rules[0].match(tt.name, tt.isDir); got != tt.want {
+			t.Errorf("%q match %q (dir %v) = %v, want %v", tt.pattern, tt.name, tt.isDir, got, tt.want)
+		}
+	}
+	if rules := parseGitIgnore([]byte("# comment\n\n   \n/\n")); len(rules) != 0 {
+		t.Errorf("comments and blank lines gave %d rules", len(rules))
+	}
+}
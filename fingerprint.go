@@ -0,0 +1,436 @@
+package gofs
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultFingerprintLength is the number of hex digits of the content hash
+// in fingerprinted names when FingerprintOptions.Length is zero.
+const DefaultFingerprintLength = 8
+
+// FingerprintOptions configures Fingerprint.
+type FingerprintOptions struct {
+	// Hash is the hash function fingerprints are taken from. Zero means
+	// crypto.SHA256.
+	Hash crypto.Hash
+
+	// Length is the number of hex digits of the hash used in names. Zero
+	// means DefaultFingerprintLength.
+	Length int
+
+	// Include, if non-empty, restricts fingerprinting to files matching at
+	// least one of these patterns, in the GlobAll syntax. Other files are
+	// presented under their own names only.
+	Include []string
+
+	// ManifestName, if set, is the name at which the view serves the JSON
+	// manifest returned by ManifestJSON. The served manifest is cached: it
+	// is rebuilt after Reset, or once the view finds that the fingerprint
+	// of a file has changed, so files added to or removed from the wrapped
+	// filesystem may not be listed until then.
+	ManifestName string
+}
+
+// FingerprintFS is a read-only view of an fs.FS that presents each file
+// also under a name containing a hash of its contents, such as
+// "js/app.3f2a9c1e.js" for "js/app.js", so the file can be served with a
+// far-future cache lifetime. The hash goes before the extension, or at the
+// end of names without one. It implements fs.FS, fs.StatFS, fs.ReadDirFS
+// and fs.ReadFileFS.
+//
+// Fingerprints are computed when first needed and cached, and recomputed
+// when a file's size or modification time changes. A fingerprinted name
+// whose hash no longer matches the contents does not exist, so stale links
+// fail instead of serving new contents. Files of the wrapped filesystem
+// whose names look fingerprinted take precedence.
+type FingerprintFS struct {
+	// FS is the wrapped filesystem.
+	FS fs.FS
+
+	algo         crypto.Hash
+	length       int
+	include      []*globMatcher
+	manifestName string
+
+	mu       sync.Mutex
+	hashes   map[string]fingerprint
+	manifest []byte // cached contents of the file at manifestName
+	gen      int    // incremented whenever manifest is invalidated
+}
+
+// fingerprint is the cached hash of a file.
+type fingerprint struct {
+	size    int64
+	modTime time.Time
+	hash    string
+}
+
+// Fingerprint returns a FingerprintFS over fsys. opts may be nil, in which
+// case every file is fingerprinted with the first DefaultFingerprintLength
+// hex digits of its SHA-256 hash.
+func Fingerprint(fsys fs.FS, opts *FingerprintOptions) (*FingerprintFS, error) {
+	f := &FingerprintFS{FS: fsys, algo: crypto.SHA256, length: DefaultFingerprintLength}
+	if opts != nil {
+		if opts.Hash != 0 {
+			f.algo = opts.Hash
+		}
+		if opts.Length != 0 {
+			f.length = opts.Length
+		}
+		for _, p := range opts.Include {
+			m, err := compileGlob(p, true, false)
+			if err != nil {
+				return nil, err
+			}
+			f.include = append(f.include, m)
+		}
+		if opts.ManifestName != "" && !fs.ValidPath(opts.ManifestName) {
+			return nil, &fs.PathError{Op: "fingerprint", Path: opts.ManifestName, Err: fs.ErrInvalid}
+		}
+		f.manifestName = opts.ManifestName
+	}
+	if !f.algo.Available() {
+		return nil, ErrHashUnavailable
+	}
+	if f.length < 0 || f.length > 2*f.algo.Size() {
+		return nil, errors.New("fingerprint length out of range")
+	}
+	return f, nil
+}
+
+// Reset discards the cached fingerprints and manifest.
+func (f *FingerprintFS) Reset() {
+	f.mu.Lock()
+	f.hashes = nil
+	f.invalidateManifest()
+	f.mu.Unlock()
+}
+
+// invalidateManifest discards the cached manifest, including one still
+// being built. The caller must hold mu.
+func (f *FingerprintFS) invalidateManifest() {
+	f.manifest = nil
+	f.gen++
+}
+
+// included reports whether the file name, with FileInfo info, is
+// fingerprinted.
+func (f *FingerprintFS) included(name string, info fs.FileInfo) bool {
+	return info.Mode().IsRegular() && name != f.manifestName &&
+		(len(f.include) == 0 || matchAny(f.include, name))
+}
+
+// hash returns the fingerprint of the file name, with FileInfo info.
+func (f *FingerprintFS) hash(name string, info fs.FileInfo) (string, error) {
+	f.mu.Lock()
+	fp, ok := f.hashes[name]
+	f.mu.Unlock()
+	if ok && fp.size == info.Size() && fp.modTime.Equal(info.ModTime()) {
+		return fp.hash, nil
+	}
+	sum, err := hashFile(f.FS, name, f.algo)
+	if err != nil {
+		return "", err
+	}
+	fp = fingerprint{info.Size(), info.ModTime(), hex.EncodeToString(sum)[:f.length]}
+	f.mu.Lock()
+	if f.hashes == nil {
+		f.hashes = make(map[string]fingerprint)
+	}
+	// A file not hashed before is missing from a cached manifest, but not
+	// from one being built.
+	if old, ok := f.hashes[name]; ok && old.hash != fp.hash || !ok && f.manifest != nil {
+		f.invalidateManifest()
+	}
+	f.hashes[name] = fp
+	f.mu.Unlock()
+	return fp.hash, nil
+}
+
+// splitExt splits the base name of a file into its stem and extension.
+// Names starting with a dot and having no other have no extension.
+func splitExt(base string) (stem, ext string) {
+	ext = path.Ext(base)
+	if ext == base {
+		return base, ""
+	}
+	return strings.TrimSuffix(base, ext), ext
+}
+
+// fingerprinted returns name with hash inserted before its extension.
+func fingerprinted(name, hash string) string {
+	dir, base := path.Split(name)
+	stem, ext := splitExt(base)
+	return dir + stem + "." + hash + ext
+}
+
+// isHex reports whether s is a string of n lowercase hex digits.
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !('0' <= s[i] && s[i] <= '9' || 'a' <= s[i] && s[i] <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// logical returns the names that the fingerprinted name may stand for,
+// with the hash each must have.
+func (f *FingerprintFS) logical(name string) (names, hashes []string) {
+	dir, base := path.Split(name)
+	// A hash before the extension, as in "app.3f2a9c1e.js".
+	if stem, ext := splitExt(base); ext != "" {
+		if s, h := splitExt(stem); isHex(strings.TrimPrefix(h, "."), f.length) {
+			names = append(names, dir+s+ext)
+			hashes = append(hashes, h[1:])
+		}
+	}
+	// A hash at the end, as in "LICENSE.3f2a9c1e".
+	if s, h := splitExt(base); isHex(strings.TrimPrefix(h, "."), f.length) {
+		names = append(names, dir+s)
+		hashes = append(hashes, h[1:])
+	}
+	return names, hashes
+}
+
+// resolve returns the underlying name of name and its FileInfo, named as
+// in the view.
+func (f *FingerprintFS) resolve(op, name string) (string, fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return "", nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	info, err := fs.Stat(f.FS, name)
+	if err == nil {
+		return name, info, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return "", nil, pathError(op, name, err)
+	}
+	names, hashes := f.logical(name)
+	for i, under := range names {
+		uinfo, uerr := fs.Stat(f.FS, under)
+		if uerr != nil || !f.included(under, uinfo) {
+			continue
+		}
+		hash, herr := f.hash(under, uinfo)
+		if herr != nil {
+			return "", nil, pathError(op, name, herr)
+		}
+		if hash == hashes[i] {
+			return under, renamedInfo(uinfo, path.Base(name)), nil
+		}
+	}
+	return "", nil, pathError(op, name, err)
+}
+
+// AssetPath returns the fingerprinted name of the file name, for use in
+// templates, such as "js/app.3f2a9c1e.js" for "js/app.js". A leading "/",
+// as in URL paths, is kept. Names of files that are not fingerprinted are
+// returned unchanged.
+func (f *FingerprintFS) AssetPath(name string) (string, error) {
+	rel, rooted := strings.CutPrefix(name, "/")
+	if !fs.ValidPath(rel) {
+		return "", &fs.PathError{Op: "assetpath", Path: name, Err: fs.ErrInvalid}
+	}
+	info, err := fs.Stat(f.FS, rel)
+	if err != nil {
+		return "", pathError("assetpath", name, err)
+	}
+	if !f.included(rel, info) {
+		return name, nil
+	}
+	hash, err := f.hash(rel, info)
+	if err != nil {
+		return "", pathError("assetpath", name, err)
+	}
+	if rooted {
+		return "/" + fingerprinted(rel, hash), nil
+	}
+	return fingerprinted(rel, hash), nil
+}
+
+// Manifest returns a map from the name of every fingerprinted file to its
+// fingerprinted name.
+func (f *FingerprintFS) Manifest() (map[string]string, error) {
+	m := make(map[string]string)
+	err := fs.WalkDir(f.FS, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !f.included(name, info) {
+			return nil
+		}
+		hash, err := f.hash(name, info)
+		if err != nil {
+			return err
+		}
+		m[name] = fingerprinted(name, hash)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ManifestJSON returns the Manifest as an indented JSON object, sorted by
+// name.
+func (f *FingerprintFS) ManifestJSON() ([]byte, error) {
+	m, err := f.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// manifestFile returns the FileInfo and contents of the manifest served at
+// ManifestName.
+func (f *FingerprintFS) manifestFile(op string) (fs.FileInfo, []byte, error) {
+	f.mu.Lock()
+	data, gen := f.manifest, f.gen
+	f.mu.Unlock()
+	if data == nil {
+		var err error
+		if data, err = f.ManifestJSON(); err != nil {
+			return nil, nil, pathError(op, f.manifestName, err)
+		}
+		f.mu.Lock()
+		// A manifest invalidated while it was built is served once but
+		// not cached.
+		if f.gen == gen {
+			f.manifest = data
+		}
+		f.mu.Unlock()
+	}
+	info := &frozenInfo{name: path.Base(f.manifestName), size: int64(len(data)), mode: 0444}
+	return info, data, nil
+}
+
+// Open opens the named file.
+func (f *FingerprintFS) Open(name string) (fs.File, error) {
+	if name == f.manifestName && name != "" {
+		info, data, err := f.manifestFile("open")
+		if err != nil {
+			return nil, err
+		}
+		return &embedOpenFile{Reader: bytes.NewReader(data), info: info}, nil
+	}
+	under, info, err := f.resolve("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		entries, err := f.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+		return &infoDir{info: info, entries: entries}, nil
+	}
+	file, err := f.FS.Open(under)
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+	if under == name {
+		return file, nil
+	}
+	return &renamedFile{File: file, info: info}, nil
+}
+
+// Stat returns the FileInfo of the named file.
+func (f *FingerprintFS) Stat(name string) (fs.FileInfo, error) {
+	if name == f.manifestName && name != "" {
+		info, _, err := f.manifestFile("stat")
+		return info, err
+	}
+	_, info, err := f.resolve("stat", name)
+	return info, err
+}
+
+// ReadDir reads the named directory, listing each fingerprinted file under
+// both of its names.
+func (f *FingerprintFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	entries, err := fs.ReadDir(f.FS, name)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		seen[e.Name()] = true
+	}
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		p := joinName(name, e.Name())
+		info, err := e.Info()
+		if err != nil {
+			return nil, pathError("readdir", name, err)
+		}
+		if !f.included(p, info) {
+			continue
+		}
+		hash, err := f.hash(p, info)
+		if err != nil {
+			return nil, pathError("readdir", name, err)
+		}
+		alias := path.Base(fingerprinted(p, hash))
+		if !seen[alias] {
+			seen[alias] = true
+			entries = append(entries, fs.FileInfoToDirEntry(renamedInfo(info, alias)))
+		}
+	}
+	if f.manifestName != "" && path.Dir(f.manifestName) == name && !seen[path.Base(f.manifestName)] {
+		info, _, err := f.manifestFile("readdir")
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return entries, nil
+}
+
+// ReadFile reads the named file.
+func (f *FingerprintFS) ReadFile(name string) ([]byte, error) {
+	if name == f.manifestName && name != "" {
+		_, data, err := f.manifestFile("readfile")
+		// The contents are cached, so the caller gets a copy.
+		return bytes.Clone(data), err
+	}
+	under, info, err := f.resolve("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: errors.New("is a directory")}
+	}
+	data, err := fs.ReadFile(f.FS, under)
+	if err != nil {
+		return nil, pathError("readfile", name, err)
+	}
+	return data, nil
+}
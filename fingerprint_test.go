@@ -0,0 +1,146 @@
+package gofs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFingerprint(t *testing.T) {
+	mfs, gfs := setupTreeFS(t)
+	writeFile(mfs, "/a/app.js", []byte("console.log(1)"))
+	writeFile(mfs, "/LICENSE", []byte("MIT"))
+	sum := func(s string) string {
+		h := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(h[:])[:DefaultFingerprintLength]
+	}
+	app, license := "a/app."+sum("console.log(1)")+".js", "LICENSE."+sum("MIT")
+
+	fp, err := Fingerprint(gfs, &FingerprintOptions{ManifestName: "manifest.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{app: "console.log(1)", license: "MIT", "a/app.js": "console.log(1)"} {
+		if data, err := fp.ReadFile(name); err != nil || string(data) != want {
+			t.Errorf("ReadFile(%q) = %q, %v; want %q", name, data, err, want)
+		}
+	}
+	if info, err := fp.Stat(app); err != nil || info.Name() != strings.TrimPrefix(app, "a/") {
+		t.Errorf("Stat(%q) = %v, %v", app, info, err)
+	}
+	for _, name := range []string{"a/app.00000000.js", "a/app.js.00000000", "LICENSE.0000"} {
+		if _, err := fp.Stat(name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Stat(%q) error = %v, want ErrNotExist", name, err)
+		}
+	}
+
+	entries, err := fp.ReadDir("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	want := "app." + sum("console.log(1)") + ".js app.js one." + sum("one") + ".txt one.txt x"
+	if strings.Join(names, " ") != want {
+		t.Errorf("ReadDir(a) = %v, want %v", names, want)
+	}
+
+	var manifest map[string]string
+	data, err := fp.ReadFile("manifest.json")
+	if err != nil || json.Unmarshal(data, &manifest) != nil {
+		t.Fatalf("ReadFile(manifest.json) = %q, %v", data, err)
+	}
+	if manifest["a/app.js"] != app || manifest["LICENSE"] != license || len(manifest) != 6 {
+		t.Errorf("manifest = %v", manifest)
+	}
+
+	tmpl := template.Must(template.New("").Funcs(template.FuncMap{"asset": fp.AssetPath}).Parse(`<script src="{{asset "/a/app.js"}}"></script>`))
+	var b strings.Builder
+	if err := tmpl.Execute(&b, nil); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != `<script src="/`+app+`"></script>` {
+		t.Errorf("template output = %s", b.String())
+	}
+
+	// Changing a file changes its fingerprint; the old name disappears.
+	writeFile(mfs, "/a/app.js", []byte("console.log(22)"))
+	if _, err := fp.Stat(app); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat(stale %q) error = %v, want ErrNotExist", app, err)
+	}
+	if got, _ := fp.AssetPath("a/app.js"); got != "a/app."+sum("console.log(22)")+".js" {
+		t.Errorf("AssetPath after change = %q", got)
+	}
+	manifest = nil
+	data, _ = fp.ReadFile("manifest.json")
+	if json.Unmarshal(data, &manifest); manifest["a/app.js"] != "a/app."+sum("console.log(22)")+".js" {
+		t.Errorf("manifest after change = %v", manifest)
+	}
+
+	// The served manifest is cached until a fingerprint changes or Reset.
+	writeFile(mfs, "/new.txt", []byte("new"))
+	if data2, _ := fp.ReadFile("manifest.json"); string(data2) != string(data) {
+		t.Errorf("manifest rebuilt without a change: %s", data2)
+	}
+	fp.Reset()
+	if data2, _ := fp.ReadFile("manifest.json"); !strings.Contains(string(data2), `"new.txt"`) {
+		t.Errorf("manifest after Reset = %s, want new.txt", data2)
+	}
+
+	only, _ := Fingerprint(gfs, &FingerprintOptions{Include: []string{"**/*.js"}, Length: 4})
+	if got, _ := only.AssetPath("root.txt"); got != "root.txt" {
+		t.Errorf("AssetPath(excluded root.txt) = %q, want unchanged", got)
+	}
+	if _, err := fp.AssetPath("missing.js"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("AssetPath(missing.js) error = %v, want ErrNotExist", err)
+	}
+	if err := fstest.TestFS(fp, "root.txt", "manifest.json", license); err != nil {
+		t.Error(err)
+	}
+	if _, err := Fingerprint(gfs, &FingerprintOptions{Length: 100}); err == nil {
+		t.Error("Fingerprint accepted a length longer than the hash")
+	}
+}
+
+// openHookFS calls onOpen before opening each file.
+type openHookFS struct {
+	fs.FS
+	onOpen func(name string)
+}
+
+func (o *openHookFS) Open(name string) (fs.File, error) {
+	o.onOpen(name)
+	return o.FS.Open(name)
+}
+
+func TestFingerprint_ResetDuringManifest(t *testing.T) {
+	base := fstest.MapFS{"a.txt": {Data: []byte("a")}, "b.txt": {Data: []byte("b")}}
+	hook := &openHookFS{FS: base, onOpen: func(string) {}}
+	fp, err := Fingerprint(hook, &FingerprintOptions{ManifestName: "manifest.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook.onOpen = func(name string) {
+		if name == "b.txt" {
+			hook.onOpen = func(string) {}
+			fp.Reset()
+		}
+	}
+	if _, err := fp.ReadFile("manifest.json"); err != nil {
+		t.Fatal(err)
+	}
+	if fp.manifest != nil {
+		t.Error("manifest built across a Reset was cached")
+	}
+	if _, err := fp.ReadFile("manifest.json"); err != nil || fp.manifest == nil {
+		t.Errorf("manifest not cached after a quiet rebuild: %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+package gofs
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/absfs/memfs"
+)
+
+// fuzzSeeds are the hostile names every fuzz target starts from.
+var fuzzSeeds = []string{
+	".", "a.txt", "dir", "dir/b.txt", "dir/sub", "ünïcode.txt", "back\\slash",
+	"", "/", "..", "../secret", "dir/../../secret", "/secret", "./a.txt",
+	"dir/", "dir//b.txt", "a.txt/..", "..\\secret", "dir\\..\\..\\secret",
+	"a.txt\x00", "\x00../secret", "日本語/ファイル", "\u202e", "\xff\xfe",
+	"dir/./b.txt", "C:\\secret", "%2e%2e/secret",
+	strings.Repeat("a/", 2000) + "b", strings.Repeat("../", 300) + "secret",
+	strings.Repeat("x", 70000),
+}
+
+// setupFuzzFS returns a memfs-backed FileSystem rooted at /root, with a
+// file outside the root that must never be reached.
+func setupFuzzFS(t *testing.T) FileSystem {
+	t.Helper()
+	mfs, _ := memfs.NewFS()
+	mkdirs(mfs, "/root", "/root/dir", "/root/dir/sub")
+	for name, data := range map[string]string{
+		"/secret":                "secret",
+		"/root/a.txt":            "a",
+		"/root/dir/b.txt":        "b",
+		"/root/ünïcode.txt":      "u",
+		"/root/back\\slash":      "bs",
+		"/root/dir/sub/deep.txt": "deep",
+	} {
+		if err := writeFile(mfs, name, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mfs.Chdir("/root"); err != nil {
+		t.Fatal(err)
+	}
+	gfs, _ := NewFs(mfs)
+	return gfs
+}
+
+// checkFuzzErr fails the test if err is neither nil nor an *fs.PathError.
+func checkFuzzErr(t *testing.T, op, name string, err error) {
+	t.Helper()
+	if err == nil {
+		return
+	}
+	if _, ok := err.(*fs.PathError); !ok {
+		t.Fatalf("%s(%q) error %v has type %T, want *fs.PathError", op, name, err, err)
+	}
+}
+
+// checkFuzzData fails the test if data came from outside the root.
+func checkFuzzData(t *testing.T, op, name string, data []byte) {
+	t.Helper()
+	if string(data) == "secret" {
+		t.Fatalf("%s(%q) read a file outside the root", op, name)
+	}
+}
+
+// checkFuzzEntries fails the test if entries list the parent of the root.
+func checkFuzzEntries(t *testing.T, op, name string, entries []fs.DirEntry) {
+	t.Helper()
+	for _, e := range entries {
+		if e.Name() == "secret" || e.Name() == "root" {
+			t.Fatalf("%s(%q) listed a directory outside the root", op, name)
+		}
+	}
+}
+
+func addFuzzSeeds(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+}
+
+func FuzzOpen(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, name string) {
+		gfs := setupFuzzFS(t)
+		file, err := gfs.Open(name)
+		checkFuzzErr(t, "Open", name, err)
+		if err != nil {
+			return
+		}
+		defer file.Close()
+		if !fs.ValidPath(name) {
+			t.Fatalf("Open(%q) accepted an invalid name", name)
+		}
+		if dir, ok := file.(fs.ReadDirFile); ok {
+			entries, _ := dir.ReadDir(-1)
+			checkFuzzEntries(t, "Open", name, entries)
+		}
+		data := make([]byte, 64)
+		n, _ := file.Read(data)
+		checkFuzzData(t, "Open", name, data[:n])
+	})
+}
+
+func FuzzStat(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, name string) {
+		gfs := setupFuzzFS(t)
+		info, err := gfs.Stat(name)
+		checkFuzzErr(t, "Stat", name, err)
+		if err == nil && (!fs.ValidPath(name) || info.Name() == "secret") {
+			t.Fatalf("Stat(%q) = %q, want an error", name, info.Name())
+		}
+	})
+}
+
+func FuzzReadDir(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, name string) {
+		gfs := setupFuzzFS(t)
+		entries, err := gfs.ReadDir(name)
+		checkFuzzErr(t, "ReadDir", name, err)
+		checkFuzzEntries(t, "ReadDir", name, entries)
+	})
+}
+
+func FuzzReadFile(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, name string) {
+		gfs := setupFuzzFS(t)
+		data, err := gfs.ReadFile(name)
+		checkFuzzErr(t, "ReadFile", name, err)
+		checkFuzzData(t, "ReadFile", name, data)
+	})
+}
+
+func FuzzSub(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed, "b.txt")
+		f.Add("dir", seed)
+	}
+	f.Fuzz(func(t *testing.T, dir, name string) {
+		gfs := setupFuzzFS(t)
+		sub, err := gfs.Sub(dir)
+		checkFuzzErr(t, "Sub", dir, err)
+		if err != nil {
+			return
+		}
+		data, err := fs.ReadFile(sub, name)
+		checkFuzzErr(t, "Sub ReadFile", name, err)
+		checkFuzzData(t, "Sub ReadFile", name, data)
+		entries, err := fs.ReadDir(sub, name)
+		checkFuzzErr(t, "Sub ReadDir", name, err)
+		checkFuzzEntries(t, "Sub ReadDir", name, entries)
+		_, err = fs.Stat(sub, name)
+		checkFuzzErr(t, "Sub Stat", name, err)
+	})
+}
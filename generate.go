@@ -0,0 +1,269 @@
+package gofs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// EmbedFile describes a file or directory of an EmbedFS. Values are
+// normally written by GenerateGo rather than by hand.
+type EmbedFile struct {
+	// Name is the slash-separated path of the file, as in io/fs.
+	Name string
+
+	// Mode is the file's mode, including fs.ModeDir for directories.
+	Mode fs.FileMode
+
+	// ModTime is the file's modification time.
+	ModTime time.Time
+
+	// Size is the uncompressed size of the file.
+	Size int64
+
+	// Data holds the contents, gzip-compressed if Gzip is set.
+	Data string
+	Gzip bool
+}
+
+// EmbedFS is a read-only fs.FS whose contents are compiled into the
+// program, as declared by source written by GenerateGo. It implements
+// fs.FS, fs.StatFS, fs.ReadDirFS and fs.ReadFileFS. Compressed files are
+// decompressed each time they are opened.
+type EmbedFS struct {
+	files map[string]*embedEntry
+}
+
+// embedEntry is a file or directory of an EmbedFS.
+type embedEntry struct {
+	file     EmbedFile
+	children []fs.FileInfo // sorted by name, for directories
+}
+
+// NewEmbedFS returns an EmbedFS holding files. Missing parent directories
+// are created with mode 0555 and the zero modification time.
+func NewEmbedFS(files []EmbedFile) *EmbedFS {
+	e := &EmbedFS{files: make(map[string]*embedEntry)}
+	e.files["."] = &embedEntry{file: EmbedFile{Name: ".", Mode: fs.ModeDir | 0555}}
+	for _, f := range files {
+		e.add(f)
+	}
+	for _, entry := range e.files {
+		sort.Slice(entry.children, func(i, j int) bool {
+			return entry.children[i].Name() < entry.children[j].Name()
+		})
+	}
+	return e
+}
+
+func (e *EmbedFS) add(f EmbedFile) *embedEntry {
+	if entry, ok := e.files[f.Name]; ok {
+		if f.Mode.IsDir() && entry.file.Mode.IsDir() {
+			entry.file = f // an explicit directory replaces a synthesized one
+		}
+		return entry
+	}
+	entry := &embedEntry{file: f}
+	e.files[f.Name] = entry
+	parent := e.files[path.Dir(f.Name)]
+	if parent == nil {
+		parent = e.add(EmbedFile{Name: path.Dir(f.Name), Mode: fs.ModeDir | 0555})
+	}
+	parent.children = append(parent.children, embedInfo{entry})
+	return entry
+}
+
+func (e *EmbedFS) lookup(op, name string) (*embedEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	entry, ok := e.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return entry, nil
+}
+
+// contents returns the uncompressed contents of a file.
+func (entry *embedEntry) contents() ([]byte, error) {
+	if !entry.file.Gzip {
+		return []byte(entry.file.Data), nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader([]byte(entry.file.Data)))
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, 0, entry.file.Size)
+	buf := bytes.NewBuffer(data)
+	if _, err := io.Copy(buf, zr); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Open opens the named file.
+func (e *EmbedFS) Open(name string) (fs.File, error) {
+	entry, err := e.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	info := embedInfo{entry}
+	if entry.file.Mode.IsDir() {
+		return &infoDir{info: info, entries: infoEntries(entry.children)}, nil
+	}
+	data, err := entry.contents()
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &embedOpenFile{Reader: bytes.NewReader(data), info: info}, nil
+}
+
+// Stat returns the FileInfo of the named file.
+func (e *EmbedFS) Stat(name string) (fs.FileInfo, error) {
+	entry, err := e.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return embedInfo{entry}, nil
+}
+
+// ReadDir returns the entries of the named directory, sorted by name.
+func (e *EmbedFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entry, err := e.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !entry.file.Mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	return infoEntries(entry.children), nil
+}
+
+// ReadFile returns the contents of the named file.
+func (e *EmbedFS) ReadFile(name string) ([]byte, error) {
+	entry, err := e.lookup("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	if entry.file.Mode.IsDir() {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: errors.New("is a directory")}
+	}
+	data, err := entry.contents()
+	if err != nil {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: err}
+	}
+	return data, nil
+}
+
+// embedInfo is the FileInfo of an EmbedFS entry.
+type embedInfo struct{ entry *embedEntry }
+
+func (i embedInfo) Name() string       { return path.Base(i.entry.file.Name) }
+func (i embedInfo) Size() int64        { return i.entry.file.Size }
+func (i embedInfo) Mode() fs.FileMode  { return i.entry.file.Mode }
+func (i embedInfo) ModTime() time.Time { return i.entry.file.ModTime }
+func (i embedInfo) IsDir() bool        { return i.entry.file.Mode.IsDir() }
+func (i embedInfo) Sys() any           { return nil }
+
+// embedOpenFile is an open regular file held in memory, such as one of an
+// EmbedFS. It implements io.Seeker and io.ReaderAt.
+type embedOpenFile struct {
+	*bytes.Reader
+	info fs.FileInfo
+}
+
+func (f *embedOpenFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *embedOpenFile) Close() error               { return nil }
+
+// generatedImports lists the package names imported by code written by
+// GenerateGo.
+var generatedImports = []string{"time", "gofs"}
+
+// GenerateGo writes Go source for package pkgName declaring a variable
+// varName, of type *EmbedFS, holding every directory and regular file in
+// fsys with their modes and modification times. File contents are stored
+// gzip-compressed when that makes them smaller. The output is formatted and
+// marked as generated. varName must not be the name of a package the output
+// imports, time or gofs.
+//
+// Generation reads the whole tree into memory and is limited to
+// DefaultCaptureLimit bytes of file contents.
+func GenerateGo(w io.Writer, fsys fs.FS, pkgName, varName string) error {
+	if !token.IsIdentifier(pkgName) || pkgName == "_" {
+		return fmt.Errorf("invalid package name %q", pkgName)
+	}
+	if !token.IsIdentifier(varName) || varName == "_" {
+		return fmt.Errorf("invalid variable name %q", varName)
+	}
+	// The variable shares the file scope with the imports, and init, and
+	// main in package main, can only name functions.
+	if slices.Contains(generatedImports, varName) || varName == "init" || varName == "main" && pkgName == "main" {
+		return fmt.Errorf("variable name %q is reserved in generated code", varName)
+	}
+
+	var body bytes.Buffer
+	err := capture(fsys, ".", nil, func(name string, info fs.FileInfo, data []byte) error {
+		mtime := info.ModTime()
+		fmt.Fprintf(&body, "\t{Name: %s, Mode: %#o, ModTime: time.Unix(%d, %d)",
+			strconv.Quote(name), uint32(info.Mode()), mtime.Unix(), mtime.Nanosecond())
+		if !info.IsDir() {
+			packed, compressed, err := compressEmbed(data)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(&body, ", Size: %d, Gzip: %t, Data: %s", len(data), compressed, strconv.Quote(string(packed)))
+		}
+		body.WriteString("},\n")
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "// Code generated by gofs generate; DO NOT EDIT.\n\npackage %s\n\n", pkgName)
+	if body.Len() > 0 {
+		src.WriteString("import (\n\t\"time\"\n\n\t\"github.com/absfs/gofs\"\n)\n\n")
+	} else {
+		src.WriteString("import \"github.com/absfs/gofs\"\n\n")
+	}
+	fmt.Fprintf(&src, "// %s is a read-only file system generated by gofs.\n", varName)
+	fmt.Fprintf(&src, "var %s = gofs.NewEmbedFS([]gofs.EmbedFile{\n", varName)
+	src.Write(body.Bytes())
+	src.WriteString("})\n")
+
+	out, err := format.Source(src.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// compressEmbed gzips data, returning it unchanged if that does not make it
+// smaller.
+func compressEmbed(data []byte) ([]byte, bool, error) {
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, false, err
+	}
+	zw.Write(data)
+	if err := zw.Close(); err != nil {
+		return nil, false, err
+	}
+	if buf.Len() >= len(data) {
+		return data, false, nil
+	}
+	return buf.Bytes(), true, nil
+}
@@ -0,0 +1,190 @@
+package gofs
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// parseGenerated evaluates the EmbedFile literals in source written by
+// GenerateGo, standing in for compiling it.
+func parseGenerated(t *testing.T, src []byte) (pkg string, files []EmbedFile) {
+	t.Helper()
+	f, err := parser.ParseFile(token.NewFileSet(), "assets.go", src, 0)
+	if err != nil {
+		t.Fatalf("generated source does not parse: %v\n%s", err, src)
+	}
+	ast.Inspect(f, func(n ast.Node) bool {
+		lit, ok := n.(*ast.CompositeLit)
+		if !ok || lit.Type != nil {
+			return true
+		}
+		var ef EmbedFile
+		for _, elt := range lit.Elts {
+			kv := elt.(*ast.KeyValueExpr)
+			switch kv.Key.(*ast.Ident).Name {
+			case "Name":
+				ef.Name, _ = strconv.Unquote(kv.Value.(*ast.BasicLit).Value)
+			case "Data":
+				ef.Data, _ = strconv.Unquote(kv.Value.(*ast.BasicLit).Value)
+			case "Mode":
+				mode, _ := strconv.ParseUint(kv.Value.(*ast.BasicLit).Value, 0, 32)
+				ef.Mode = fs.FileMode(mode)
+			case "Size":
+				ef.Size, _ = strconv.ParseInt(kv.Value.(*ast.BasicLit).Value, 10, 64)
+			case "Gzip":
+				ef.Gzip = kv.Value.(*ast.Ident).Name == "true"
+			case "ModTime":
+				args := kv.Value.(*ast.CallExpr).Args
+				sec, _ := strconv.ParseInt(args[0].(*ast.BasicLit).Value, 10, 64)
+				nsec, _ := strconv.ParseInt(args[1].(*ast.BasicLit).Value, 10, 64)
+				ef.ModTime = time.Unix(sec, nsec)
+			}
+		}
+		files = append(files, ef)
+		return false
+	})
+	return f.Name.Name, files
+}
+
+func TestGenerateGo(t *testing.T) {
+	mfs, gfs := setupTreeFS(t)
+	big := strings.Repeat("compressible ", 100)
+	writeFile(mfs, "/a/big.txt", []byte(big))
+	mtime := time.Unix(1e9, 12345)
+	mfs.Chtimes("/a/one.txt", mtime, mtime)
+	mfs.Chmod("/a/one.txt", 0600)
+
+	var buf bytes.Buffer
+	if err := GenerateGo(&buf, gfs, "assets", "Files"); err != nil {
+		t.Fatal(err)
+	}
+	src := buf.Bytes()
+	if !bytes.HasPrefix(src, []byte("// Code generated by gofs generate; DO NOT EDIT.")) {
+		t.Errorf("missing generated header:\n%s", src)
+	}
+	if !bytes.Contains(src, []byte("var Files = gofs.NewEmbedFS(")) {
+		t.Errorf("missing variable declaration:\n%s", src)
+	}
+	if bytes.Contains(src, []byte("compressible")) {
+		t.Error("compressible file was not compressed")
+	}
+
+	pkg, files := parseGenerated(t, src)
+	if pkg != "assets" {
+		t.Errorf("package = %q, want assets", pkg)
+	}
+	efs := NewEmbedFS(files)
+	if err := fstest.TestFS(efs, "root.txt", "a/one.txt", "a/big.txt", "a/x/deep", "b/two.txt"); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"root.txt": "root", "a/big.txt": big, "a/x/deep": "deep"} {
+		if got, err := fs.ReadFile(efs, name); err != nil || string(got) != want {
+			t.Errorf("ReadFile(%q) = %q, %v", name, got, err)
+		}
+	}
+	info, err := efs.Stat("a/one.txt")
+	if err != nil || info.Mode() != 0600 || !info.ModTime().Equal(mtime) {
+		t.Errorf("Stat(a/one.txt) = %v %v, %v; want 0600 %v", info.Mode(), info.ModTime(), err, mtime)
+	}
+	if info, _ := efs.Stat("a"); !info.IsDir() {
+		t.Errorf("a mode = %v, want directory", info.Mode())
+	}
+}
+
+func TestGenerateGo_Invalid(t *testing.T) {
+	_, gfs := setupTreeFS(t)
+	for _, names := range [][2]string{
+		{"my-pkg", "Files"},
+		{"_", "Files"},
+		{"assets", "1files"},
+		{"assets", "type"},
+		{"assets", "_"},
+		{"assets", "time"},
+		{"assets", "gofs"},
+		{"assets", "init"},
+		{"main", "main"},
+	} {
+		if err := GenerateGo(&bytes.Buffer{}, gfs, names[0], names[1]); err == nil {
+			t.Errorf("GenerateGo(%q, %q) succeeded", names[0], names[1])
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := GenerateGo(&buf, fstest.MapFS{}, "empty", "Files"); err != nil {
+		t.Fatal(err)
+	}
+	if _, files := parseGenerated(t, buf.Bytes()); len(files) != 0 {
+		t.Errorf("empty tree generated %d files", len(files))
+	}
+}
+
+func TestNewEmbedFS_SynthesizedDirs(t *testing.T) {
+	efs := NewEmbedFS([]EmbedFile{{Name: "x/y/z.txt", Mode: 0644, Size: 2, Data: "hi"}})
+	if err := fstest.TestFS(efs, "x/y/z.txt"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestGenerateGo_Compiles builds generated code with names close to the
+// reserved ones in a module that uses this copy of gofs.
+func TestGenerateGo_Compiles(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping go build in short mode")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+	root, err := filepath.Abs(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, err := os.ReadFile("go.sum")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	mod := "module example.com/generated\n\ngo 1.23\n\nrequire github.com/absfs/gofs v0.0.0\n\nreplace github.com/absfs/gofs => " + strconv.Quote(root) + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(mod), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "go.sum"), sum, 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, gfs := setupTreeFS(t)
+	for _, names := range [][2]string{{"time", "embed"}, {"gofs", "Time"}, {"main", "files"}} {
+		var buf bytes.Buffer
+		if err := GenerateGo(&buf, gfs, names[0], names[1]); err != nil {
+			t.Fatalf("GenerateGo(%q, %q) failed: %v", names[0], names[1], err)
+		}
+		if names[0] == "main" {
+			buf.WriteString("\nfunc main() { _ = files }\n")
+		}
+		pkgDir := filepath.Join(dir, names[0]+"_"+names[1])
+		if err := os.Mkdir(pkgDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(pkgDir, "assets.go"), buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cmd := exec.Command(goTool, "build", "./...")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOPROXY=off", "GOWORK=off")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go build failed: %v\n%s", err, out)
+	}
+}
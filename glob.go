@@ -0,0 +1,365 @@
+package gofs
+
+import (
+	"io/fs"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// GlobOptions configures GlobAll.
+type GlobOptions struct {
+	// Exclude lists patterns, in the same syntax as the GlobAll pattern, whose
+	// matches are removed from the result. A directory matching an exclude
+	// pattern is not descended into, so everything below it is excluded too.
+	Exclude []string
+
+	// CaseInsensitive makes every pattern match names regardless of case.
+	CaseInsensitive bool
+}
+
+// Glob returns the names of all files matching pattern, with the same
+// semantics as fs.Glob. It implements the fs.GlobFS interface, so fs.Glob
+// uses it directly instead of reading every directory through ReadDir.
+//
+// Directories are only read when a pattern segment contains wildcards;
+// literal segments are resolved with Stat, and directories that cannot
+// contain a match are never opened.
+func (f FileSystem) Glob(pattern string) ([]string, error) {
+	m, err := compileGlob(pattern, false, false)
+	if err != nil {
+		return nil, err
+	}
+	if !fs.ValidPath(pattern) {
+		// No valid name matches a pattern such as "./a" or "a/".
+		return nil, nil
+	}
+	g := globber{fsys: f, m: m}
+	g.walk(".", m.start())
+	return g.matches, nil
+}
+
+// GlobAll returns the names of all files in fsys matching pattern. Unlike
+// fs.Glob it supports the following extensions to the path.Match syntax:
+//
+//   - A "**" path segment matches zero or more directories, so "**/*.go"
+//     matches Go files at any depth and "docs/**" matches docs and
+//     everything below it.
+//   - Brace expansion: "*.{js,css}" matches the same names as the two
+//     patterns "*.js" and "*.css". Braces may be nested.
+//
+// Exclude patterns and case-insensitive matching are configured with opts,
+// which may be nil. Directories that cannot contain a match are pruned
+// without being read. The result is in lexical order by path segment, the
+// same order fs.Glob and fs.WalkDir use. The only possible returned error is
+// path.ErrBadPattern.
+func GlobAll(fsys fs.FS, pattern string, opts *GlobOptions) ([]string, error) {
+	if opts == nil {
+		opts = &GlobOptions{}
+	}
+	m, err := compileGlob(pattern, true, opts.CaseInsensitive)
+	if err != nil {
+		return nil, err
+	}
+	g := globber{fsys: fsys, m: m}
+	for _, exclude := range opts.Exclude {
+		x, err := compileGlob(exclude, true, opts.CaseInsensitive)
+		if err != nil {
+			return nil, err
+		}
+		g.exclude = append(g.exclude, x)
+	}
+	g.walk(".", m.start())
+	return g.matches, nil
+}
+
+// globMatcher is a compiled set of patterns, one per brace alternative.
+// Each pattern is split into path segments.
+type globMatcher struct {
+	patterns [][]string
+	fold     bool
+}
+
+// globState is a position within a globMatcher: segment seg of pattern p.
+// A state whose seg equals the pattern length has matched completely.
+type globState struct {
+	p, seg int
+}
+
+// compileGlob validates pattern and splits it into segments. When extended
+// is set, braces are expanded and "**" segments match any number of
+// directories; otherwise the pattern has plain path.Match semantics.
+func compileGlob(pattern string, extended, fold bool) (*globMatcher, error) {
+	alternatives := []string{pattern}
+	if extended {
+		var err error
+		if alternatives, err = expandBraces(pattern); err != nil {
+			return nil, err
+		}
+	}
+
+	m := &globMatcher{fold: fold}
+	for _, alt := range alternatives {
+		if fold {
+			alt = strings.ToLower(alt)
+		}
+		segs := strings.Split(alt, "/")
+		for i, seg := range segs {
+			if _, err := path.Match(seg, ""); err != nil {
+				return nil, err
+			}
+			if !extended && seg == "**" {
+				// Without the extension "**" is an ordinary wildcard segment;
+				// "*" is equivalent and keeps the state machine simple.
+				segs[i] = "*"
+			}
+		}
+		m.patterns = append(m.patterns, segs)
+	}
+	return m, nil
+}
+
+// expandBraces returns every alternative described by the brace groups in
+// pattern. Backslash escapes are preserved and escaped braces are literal.
+func expandBraces(pattern string) ([]string, error) {
+	start, depth := -1, 0
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '{':
+			if depth == 0 {
+				start = i
+			}
+			depth++
+		case '}':
+			if depth == 0 {
+				return nil, path.ErrBadPattern
+			}
+			depth--
+			if depth > 0 {
+				continue
+			}
+			var out []string
+			prefix, suffix := pattern[:start], pattern[i+1:]
+			for _, alt := range splitAlternatives(pattern[start+1 : i]) {
+				expanded, err := expandBraces(prefix + alt + suffix)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, expanded...)
+			}
+			return out, nil
+		}
+	}
+	if depth != 0 {
+		return nil, path.ErrBadPattern
+	}
+	return []string{pattern}, nil
+}
+
+// splitAlternatives splits the body of a brace group on top-level commas.
+func splitAlternatives(body string) []string {
+	var alts []string
+	depth, last := 0, 0
+	for i := 0; i < len(body); i++ {
+		switch body[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				alts = append(alts, body[last:i])
+				last = i + 1
+			}
+		}
+	}
+	return append(alts, body[last:])
+}
+
+// start returns the states active before any path segment is consumed.
+func (m *globMatcher) start() []globState {
+	var states []globState
+	for p := range m.patterns {
+		states = m.closure(states, globState{p, 0})
+	}
+	return states
+}
+
+// closure appends s to states, along with the states reachable from s by
+// letting "**" segments match zero directories. States already present are
+// not added again, which keeps the set small for patterns with several "**".
+func (m *globMatcher) closure(states []globState, s globState) []globState {
+	for {
+		if !slices.Contains(states, s) {
+			states = append(states, s)
+		}
+		segs := m.patterns[s.p]
+		if s.seg >= len(segs) || segs[s.seg] != "**" {
+			return states
+		}
+		s.seg++
+	}
+}
+
+// step returns the states that follow from consuming the path segment name
+// in each of states.
+func (m *globMatcher) step(states []globState, name string) []globState {
+	if m.fold {
+		name = strings.ToLower(name)
+	}
+	var next []globState
+	for _, s := range states {
+		segs := m.patterns[s.p]
+		if s.seg >= len(segs) {
+			continue
+		}
+		seg := segs[s.seg]
+		if seg == "**" {
+			next = m.closure(next, s)
+			continue
+		}
+		if ok, _ := path.Match(seg, name); ok {
+			next = m.closure(next, globState{s.p, s.seg + 1})
+		}
+	}
+	return next
+}
+
+// complete reports whether any of states has matched a whole pattern.
+func (m *globMatcher) complete(states []globState) bool {
+	for _, s := range states {
+		if s.seg == len(m.patterns[s.p]) {
+			return true
+		}
+	}
+	return false
+}
+
+// pending reports whether any of states can still match a longer path.
+func (m *globMatcher) pending(states []globState) bool {
+	for _, s := range states {
+		if s.seg < len(m.patterns[s.p]) {
+			return true
+		}
+	}
+	return false
+}
+
+// literals returns the sorted names required by states if every pending
+// state expects a literal segment, which lets the caller Stat those names
+// instead of reading the whole directory.
+func (m *globMatcher) literals(states []globState) ([]string, bool) {
+	if m.fold {
+		return nil, false
+	}
+	seen := make(map[string]bool)
+	for _, s := range states {
+		segs := m.patterns[s.p]
+		if s.seg >= len(segs) {
+			continue
+		}
+		seg := segs[s.seg]
+		if strings.ContainsAny(seg, `*?[\`) {
+			return nil, false
+		}
+		seen[seg] = true
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, true
+}
+
+// match reports whether the whole of name matches m.
+func (m *globMatcher) match(name string) bool {
+	states := m.start()
+	for _, seg := range strings.Split(name, "/") {
+		if states = m.step(states, seg); len(states) == 0 {
+			return false
+		}
+	}
+	return m.complete(states)
+}
+
+// globber walks a filesystem collecting the names that match a globMatcher.
+type globber struct {
+	fsys    fs.FS
+	m       *globMatcher
+	exclude []*globMatcher
+	matches []string
+}
+
+// walk visits the children of dir with the given active states. Errors
+// reading directories are ignored, as they are by fs.Glob.
+func (g *globber) walk(dir string, states []globState) {
+	m := g.m
+	if !m.pending(states) {
+		return
+	}
+
+	// The literal segments are matched by name rather than by the name that
+	// Stat reports, which need not be the last element for names such as ".".
+	var names []string
+	var dirs []bool
+	if literals, ok := m.literals(states); ok {
+		for _, name := range literals {
+			info, err := fs.Stat(g.fsys, joinName(dir, name))
+			if err != nil {
+				continue
+			}
+			names = append(names, name)
+			dirs = append(dirs, info.IsDir())
+		}
+	} else {
+		entries, err := fs.ReadDir(g.fsys, dir)
+		if err != nil {
+			return
+		}
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+			dirs = append(dirs, entry.IsDir())
+		}
+	}
+
+	for i, elem := range names {
+		name := joinName(dir, elem)
+		if g.excluded(name) {
+			continue
+		}
+		next := m.step(states, elem)
+		if len(next) == 0 {
+			continue
+		}
+		if m.complete(next) {
+			g.matches = append(g.matches, name)
+		}
+		if dirs[i] {
+			g.walk(name, next)
+		}
+	}
+}
+
+// excluded reports whether name matches any exclude pattern.
+func (g *globber) excluded(name string) bool {
+	for _, x := range g.exclude {
+		if x.match(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// joinName joins a directory and an entry name in io/fs form.
+func joinName(dir, name string) string {
+	if dir == "." {
+		return name
+	}
+	return dir + "/" + name
+}
@@ -0,0 +1,214 @@
+package gofs
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/absfs/memfs"
+)
+
+func setupGlobFS(t *testing.T) FileSystem {
+	t.Helper()
+	mfs, err := memfs.NewFS()
+	if err != nil {
+		t.Fatalf("Failed to create memfs: %v", err)
+	}
+	for _, dir := range []string{"src", "src/app", "src/app/vendor", "docs", "node_modules", "node_modules/lib"} {
+		if err := mfs.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory %s: %v", dir, err)
+		}
+	}
+	for _, name := range []string{
+		"README.md",
+		"main.go",
+		"src/util.go",
+		"src/style.css",
+		"src/app/app.go",
+		"src/app/App.JS",
+		"src/app/vendor/dep.go",
+		"docs/guide.md",
+		"node_modules/lib/index.js",
+	} {
+		if err := writeFile(mfs, name, []byte(name)); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	gfs, err := NewFs(mfs)
+	if err != nil {
+		t.Fatalf("Failed to create gofs: %v", err)
+	}
+	return gfs
+}
+
+// countingFS records the directories read through it.
+type countingFS struct {
+	fs.FS
+	reads []string
+}
+
+func (c *countingFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	c.reads = append(c.reads, name)
+	return fs.ReadDir(c.FS, name)
+}
+
+func TestFileSystem_Glob(t *testing.T) {
+	gfs := setupGlobFS(t)
+
+	var _ fs.GlobFS = gfs
+
+	for _, pattern := range []string{
+		"*.go",
+		"*/*.go",
+		"src/*/*",
+		"src/app/app.go",
+		"src/[a-u]*",
+		"**",
+		"*",
+		"missing/*",
+		"",
+		".",
+		"src",
+		"./src",
+		"src/./app",
+		"src/../src",
+		"src/",
+	} {
+		got, err := gfs.Glob(pattern)
+		if err != nil {
+			t.Errorf("Glob(%q) failed: %v", pattern, err)
+			continue
+		}
+		// Compare against the generic implementation, which only sees ReadDir.
+		want, err := fs.Glob(struct{ fs.ReadDirFS }{gfs}, pattern)
+		if err != nil {
+			t.Fatalf("fs.Glob(%q) failed: %v", pattern, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Glob(%q) = %v, want %v", pattern, got, want)
+		}
+	}
+
+	t.Run("bad pattern", func(t *testing.T) {
+		if _, err := gfs.Glob("src/[a"); !errors.Is(err, path.ErrBadPattern) {
+			t.Errorf("Glob() error = %v, want path.ErrBadPattern", err)
+		}
+	})
+
+	t.Run("literal segments are not read", func(t *testing.T) {
+		c := &countingFS{FS: gfs}
+		g := globber{fsys: c}
+		g.m, _ = compileGlob("src/app/*.go", false, false)
+		g.walk(".", g.m.start())
+		if !reflect.DeepEqual(c.reads, []string{"src/app"}) {
+			t.Errorf("Glob read directories %v, want [src/app]", c.reads)
+		}
+	})
+}
+
+func TestGlobAll(t *testing.T) {
+	gfs := setupGlobFS(t)
+
+	tests := []struct {
+		name    string
+		pattern string
+		opts    *GlobOptions
+		want    []string
+	}{
+		{
+			name:    "double star any depth",
+			pattern: "**/*.go",
+			want:    []string{"main.go", "src/app/app.go", "src/app/vendor/dep.go", "src/util.go"},
+		},
+		{
+			name:    "double star in the middle",
+			pattern: "src/**/*.go",
+			want:    []string{"src/app/app.go", "src/app/vendor/dep.go", "src/util.go"},
+		},
+		{
+			name:    "trailing double star",
+			pattern: "docs/**",
+			want:    []string{"docs", "docs/guide.md"},
+		},
+		{
+			name:    "braces",
+			pattern: "src/*.{go,css}",
+			want:    []string{"src/style.css", "src/util.go"},
+		},
+		{
+			name:    "nested braces",
+			pattern: "{docs/*.md,src/{util,style}.*}",
+			want:    []string{"docs/guide.md", "src/style.css", "src/util.go"},
+		},
+		{
+			name:    "exclude",
+			pattern: "**/*.go",
+			opts:    &GlobOptions{Exclude: []string{"**/vendor"}},
+			want:    []string{"main.go", "src/app/app.go", "src/util.go"},
+		},
+		{
+			name:    "exclude files",
+			pattern: "**/*.{js,JS}",
+			opts:    &GlobOptions{Exclude: []string{"node_modules/**"}},
+			want:    []string{"src/app/App.JS"},
+		},
+		{
+			name:    "case insensitive",
+			pattern: "**/*.js",
+			opts:    &GlobOptions{CaseInsensitive: true},
+			want:    []string{"node_modules/lib/index.js", "src/app/App.JS"},
+		},
+		{
+			name:    "case insensitive literal",
+			pattern: "readme.MD",
+			opts:    &GlobOptions{CaseInsensitive: true},
+			want:    []string{"README.md"},
+		},
+		{
+			name:    "escaped brace is literal",
+			pattern: `\{a,b\}`,
+			want:    nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GlobAll(gfs, tt.pattern, tt.opts)
+			if err != nil {
+				t.Fatalf("GlobAll(%q) failed: %v", tt.pattern, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GlobAll(%q) = %v, want %v", tt.pattern, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("bad patterns", func(t *testing.T) {
+		for _, pattern := range []string{"{a,b", "a}", "[z-"} {
+			if _, err := GlobAll(gfs, pattern, nil); !errors.Is(err, path.ErrBadPattern) {
+				t.Errorf("GlobAll(%q) error = %v, want path.ErrBadPattern", pattern, err)
+			}
+		}
+		opts := &GlobOptions{Exclude: []string{"[z-"}}
+		if _, err := GlobAll(gfs, "*", opts); !errors.Is(err, path.ErrBadPattern) {
+			t.Errorf("GlobAll() with bad exclude error = %v, want path.ErrBadPattern", err)
+		}
+	})
+
+	t.Run("prunes directories", func(t *testing.T) {
+		c := &countingFS{FS: gfs}
+		if _, err := GlobAll(c, "src/*/*.go", nil); err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"src"}
+		if !reflect.DeepEqual(c.reads[:1], want) {
+			t.Errorf("GlobAll() read %v first, want %v", c.reads, want)
+		}
+		for _, dir := range c.reads {
+			if dir == "." || dir == "docs" || dir == "node_modules" || dir == "src/app/vendor" {
+				t.Errorf("GlobAll() read unrelated directory %q", dir)
+			}
+		}
+	})
+}
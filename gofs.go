@@ -29,19 +29,36 @@
 package gofs
 
 import (
+	"errors"
 	"io"
 	"io/fs"
 	"os"
+	"path"
+	"slices"
+	"strings"
 
 	"github.com/absfs/absfs"
 )
 
 // FileSystem wraps an absfs.Filer to provide compatibility with Go's io/fs interfaces.
 // It implements fs.FS, fs.ReadFileFS, fs.ReadDirFS, and fs.StatFS.
+// Names must satisfy fs.ValidPath, and errors are always *fs.PathError values.
+//
+// When the Filer is an absfs.FileSystem, names are resolved against the
+// working directory it had when NewFs was called, so a later Chdir on the
+// backend does not change what a FileSystem opens.
 //
 // Deprecated: Use absfs.FilerToFS() or Filer.Sub(".") instead.
 type FileSystem struct {
 	Fs absfs.Filer
+
+	// base is the absolute directory of Fs captured by NewFs, or empty if
+	// Fs has no working directory and names are passed through relative.
+	base string
+
+	// root is the directory below base that names are resolved against, as
+	// set by Sub. It is empty for the top of the FileSystem.
+	root string
 }
 
 // File wraps an absfs.File to provide compatibility with io/fs.File.
@@ -59,27 +76,110 @@ type DirEntry struct {
 // The returned FileSystem can be used with any Go standard library function
 // that accepts fs.FS, fs.ReadFileFS, fs.ReadDirFS, or fs.StatFS.
 //
+// If fs is an absfs.FileSystem, the FileSystem is rooted at its current
+// working directory, and an error is returned if that cannot be determined.
+//
 // Deprecated: Use absfs.FilerToFS(filer, ".") or filer.Sub(".") instead.
 func NewFs(fs absfs.Filer) (FileSystem, error) {
-	return FileSystem{fs}, nil
+	f := FileSystem{Fs: fs}
+	if wd, ok := fs.(absfs.FileSystem); ok {
+		dir, err := wd.Getwd()
+		if err != nil {
+			return FileSystem{}, err
+		}
+		// absfs paths are slash-separated on every platform.
+		f.base = path.Join(string(absfs.Separator), dir)
+	}
+	return f, nil
+}
+
+// Root returns the directory, relative to the root captured by NewFs, that
+// f resolves names against: "." for a FileSystem returned by NewFs, or the
+// directory given to Sub.
+func (f FileSystem) Root() string {
+	if f.root == "" {
+		return "."
+	}
+	return f.root
+}
+
+// resolve returns the name in the Filer of the io/fs name name, or an
+// *fs.PathError if it is not a valid io/fs name, so that names such as
+// "../x" and "/x" cannot reach the Filer.
+func (f FileSystem) resolve(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if f.base == "" && f.root == "" {
+		return name, nil
+	}
+	return path.Join(f.base, f.root, name), nil
+}
+
+// pathError returns err as an *fs.PathError for name, wrapping it if the
+// Filer returned some other error type, so that errors report names as they
+// were given to f.
+func pathError(op, name string, err error) error {
+	if pe, ok := err.(*fs.PathError); ok {
+		err = pe.Err
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
 }
 
 // Open opens the named file for reading and returns it as an fs.File.
 // This implements the fs.FS interface.
 func (f FileSystem) Open(name string) (fs.File, error) {
-	file, err := f.Fs.OpenFile(name, absfs.O_RDONLY, 0)
+	p, err := f.resolve("open", name)
 	if err != nil {
 		return nil, err
 	}
+	file, err := f.Fs.OpenFile(p, absfs.O_RDONLY, 0)
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
 	return File{file}, nil
 }
 
-// ReadDir reads the directory named by name and returns a list of directory entries.
+// notImplemented reports whether err means that a Filer does not implement
+// an operation, so that a fallback should be used.
+func notImplemented(err error) bool {
+	return errors.Is(err, absfs.ErrNotImplemented) || errors.Is(err, errors.ErrUnsupported)
+}
+
+// ReadDir reads the directory named by name and returns a list of directory
+// entries sorted by name. It uses the Filer's own ReadDir, falling back to
+// reading an open directory if the Filer does not implement it.
 // This implements the fs.ReadDirFS interface.
-func (f FileSystem) ReadDir(name string) (dirs []fs.DirEntry, err error) {
-	var file absfs.File
+func (f FileSystem) ReadDir(name string) ([]fs.DirEntry, error) {
+	p, err := f.resolve("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := f.Fs.ReadDir(p)
+	if notImplemented(err) {
+		entries, err = f.readDir(p)
+	}
+	if err != nil {
+		return nil, pathError("readdir", name, err)
+	}
+
+	// Filter into a new slice, since the Filer may return one it still uses.
+	dirs := make([]fs.DirEntry, 0, len(entries))
+	for _, entry := range entries {
+		// Skip . and .. entries - io/fs interface doesn't include them
+		if entry.Name() == "." || entry.Name() == ".." {
+			continue
+		}
+		dirs = append(dirs, entry)
+	}
+	slices.SortFunc(dirs, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return dirs, nil
+}
 
-	file, err = f.Fs.OpenFile(name, absfs.O_RDONLY, 0)
+// readDir reads the directory p of the Filer through File.Readdir.
+func (f FileSystem) readDir(p string) (dirs []fs.DirEntry, err error) {
+	var file absfs.File
+	file, err = f.Fs.OpenFile(p, absfs.O_RDONLY, 0)
 	if err != nil {
 		return nil, err
 	}
@@ -99,20 +199,34 @@ func (f FileSystem) ReadDir(name string) (dirs []fs.DirEntry, err error) {
 
 	dirs = make([]fs.DirEntry, 0, len(list))
 	for _, info := range list {
-		// Skip . and .. entries - io/fs interface doesn't include them
-		if info.Name() == "." || info.Name() == ".." {
-			continue
-		}
 		dirs = append(dirs, DirEntry{info})
 	}
 	return dirs, nil
 }
 
-// ReadFile reads the named file and returns its contents.
+// ReadFile reads the named file and returns its contents. It uses the
+// Filer's own ReadFile, falling back to reading an open file, into a
+// buffer sized from its Stat, if the Filer does not implement it.
 // This implements the fs.ReadFileFS interface.
-func (f FileSystem) ReadFile(name string) (data []byte, err error) {
+func (f FileSystem) ReadFile(name string) ([]byte, error) {
+	p, err := f.resolve("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := f.Fs.ReadFile(p)
+	if notImplemented(err) {
+		data, err = f.readFile(p)
+	}
+	if err != nil {
+		return nil, pathError("readfile", name, err)
+	}
+	return data, nil
+}
+
+// readFile reads the file p of the Filer through File.Read.
+func (f FileSystem) readFile(p string) (data []byte, err error) {
 	var file absfs.File
-	file, err = f.Fs.OpenFile(name, absfs.O_RDONLY, 0)
+	file, err = f.Fs.OpenFile(p, absfs.O_RDONLY, 0)
 	if err != nil {
 		return nil, err
 	}
@@ -124,19 +238,65 @@ func (f FileSystem) ReadFile(name string) (data []byte, err error) {
 		err = file.Close()
 	}()
 
-	return io.ReadAll(file)
+	// As in os.ReadFile, allocate one byte more than the size so that the
+	// final Read reports io.EOF without growing the buffer.
+	var size int
+	if info, err := file.Stat(); err == nil && info.Size() > 0 && int64(int(info.Size())) == info.Size() {
+		size = int(info.Size())
+	}
+	data = make([]byte, 0, max(size+1, 512))
+	for {
+		n, rerr := file.Read(data[len(data):cap(data)])
+		data = data[:len(data)+n]
+		if rerr == io.EOF {
+			return data, nil
+		}
+		if rerr != nil {
+			return nil, rerr
+		}
+		if len(data) == cap(data) {
+			data = append(data, 0)[:len(data)]
+		}
+	}
 }
 
 // Stat returns file information for the named file.
 // This implements the fs.StatFS interface.
 func (f FileSystem) Stat(name string) (fs.FileInfo, error) {
-	return f.Fs.Stat(name)
+	p, err := f.resolve("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Fs.Stat(p)
+	if err != nil {
+		return nil, pathError("stat", name, err)
+	}
+	return info, nil
 }
 
-// Sub returns an fs.FS corresponding to the subtree rooted at dir.
+// Sub returns a FileSystem, as an fs.FS, for the subtree rooted at dir.
+// The result is a copy of f, sharing its Filer and every other setting,
+// that resolves names below dir; Sub may be applied to it again, and Root
+// reports the combined directory. dir must be a valid io/fs name of an
+// existing directory.
 // This implements the fs.SubFS interface.
 func (f FileSystem) Sub(dir string) (fs.FS, error) {
-	return absfs.FilerToFS(f.Fs, dir)
+	if _, err := f.resolve("sub", dir); err != nil {
+		return nil, err
+	}
+	if dir == "." {
+		return f, nil
+	}
+	info, err := f.Stat(dir)
+	if err != nil {
+		return nil, pathError("sub", dir, err)
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "sub", Path: dir, Err: errors.New("not a directory")}
+	}
+	sub := f
+	sub.root = path.Join(f.root, dir)
+	return sub, nil
 }
 
 // Stat returns file information for this file.
@@ -151,6 +311,18 @@ func (f File) Read(data []byte) (int, error) {
 	return f.F.Read(data)
 }
 
+// Seek sets the offset for the next Read on the file.
+// This implements the io.Seeker interface.
+func (f File) Seek(offset int64, whence int) (int64, error) {
+	return f.F.Seek(offset, whence)
+}
+
+// ReadAt reads len(data) bytes from the file starting at byte offset off.
+// This implements the io.ReaderAt interface.
+func (f File) ReadAt(data []byte, off int64) (int, error) {
+	return f.F.ReadAt(data, off)
+}
+
 // ReadDir reads the contents of the directory associated with the file f
 // and returns a slice of DirEntry values in directory order.
 // If n > 0, ReadDir returns at most n DirEntry structures.
@@ -179,8 +351,9 @@ func (f File) ReadDir(n int) (dirs []fs.DirEntry, err error) {
 	// n > 0: read until we have n valid entries (excluding . and ..)
 	dirs = make([]fs.DirEntry, 0, n)
 	for len(dirs) < n {
-		// Read one entry at a time to ensure we get exactly n valid entries
-		list, err := f.F.Readdir(1)
+		// Ask only for the entries still missing, so that skipping . and
+		// .. never reads past the n entries returned
+		list, err := f.F.Readdir(n - len(dirs))
 		if err != nil {
 			if err == io.EOF && len(dirs) > 0 {
 				// Return what we have so far
@@ -193,9 +366,11 @@ func (f File) ReadDir(n int) (dirs []fs.DirEntry, err error) {
 			break
 		}
 
-		// Skip . and .. entries
-		if list[0].Name() != "." && list[0].Name() != ".." {
-			dirs = append(dirs, DirEntry{list[0]})
+		for _, info := range list {
+			// Skip . and .. entries
+			if info.Name() != "." && info.Name() != ".." {
+				dirs = append(dirs, DirEntry{info})
+			}
 		}
 	}
 
@@ -4,8 +4,10 @@ import (
 	"errors"
 	"io"
 	"io/fs"
+	"os"
 	"testing"
 
+	"github.com/absfs/absfs"
 	"github.com/absfs/memfs"
 )
 
@@ -271,6 +273,17 @@ func TestFile_Read(t *testing.T) {
 	}
 }
 
+// readdirCountingFile counts the calls to Readdir.
+type readdirCountingFile struct {
+	absfs.File
+	calls int
+}
+
+func (f *readdirCountingFile) Readdir(n int) ([]os.FileInfo, error) {
+	f.calls++
+	return f.File.Readdir(n)
+}
+
 func TestFile_ReadDir(t *testing.T) {
 	gfs := setupTestFS(t)
 
@@ -327,6 +340,23 @@ func TestFile_ReadDir(t *testing.T) {
 		}
 	})
 
+	t.Run("reads n entries per call", func(t *testing.T) {
+		file, err := gfs.Open("testdir")
+		if err != nil {
+			t.Fatalf("Open() failed: %v", err)
+		}
+		defer file.Close()
+
+		counted := &readdirCountingFile{File: file.(File).F}
+		entries, err := File{F: counted}.ReadDir(3)
+		if err != nil {
+			t.Fatalf("File.ReadDir(3) failed: %v", err)
+		}
+		if len(entries) != 3 || counted.calls != 1 {
+			t.Errorf("File.ReadDir(3) returned %d entries in %d Readdir calls, want 3 in 1", len(entries), counted.calls)
+		}
+	})
+
 	t.Run("read negative n returns all entries", func(t *testing.T) {
 		file, err := gfs.Open("testdir")
 		if err != nil {
@@ -625,3 +655,127 @@ func TestFile_MultipleReads(t *testing.T) {
 		t.Errorf("Third Read() returned %d bytes, want 0", n3)
 	}
 }
+
+func TestFile_SeekReadAt(t *testing.T) {
+	gfs := setupTestFS(t)
+
+	file, err := gfs.Open("testfile.txt")
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	defer file.Close()
+
+	f := file.(File)
+	if pos, err := f.Seek(7, io.SeekStart); err != nil || pos != 7 {
+		t.Fatalf("Seek() = %d, %v; want 7, nil", pos, err)
+	}
+	rest, err := io.ReadAll(f)
+	if err != nil || string(rest) != "World!" {
+		t.Errorf("Read after Seek() = %q, %v; want \"World!\"", rest, err)
+	}
+
+	buf := make([]byte, 5)
+	if n, err := f.ReadAt(buf, 0); err != nil || string(buf[:n]) != "Hello" {
+		t.Errorf("ReadAt() = %q, %v; want \"Hello\"", buf[:n], err)
+	}
+}
+
+func TestFileSystem_Sub(t *testing.T) {
+	_, gfs := setupTreeFS(t)
+
+	sub, err := gfs.Sub("a")
+	if err != nil {
+		t.Fatalf("Sub(a) failed: %v", err)
+	}
+	a, ok := sub.(FileSystem)
+	if !ok {
+		t.Fatalf("Sub(a) returned %T, want FileSystem", sub)
+	}
+	if a.Root() != "a" || gfs.Root() != "." {
+		t.Errorf("Root() = %q, %q; want a and .", a.Root(), gfs.Root())
+	}
+	entries, err := fs.ReadDir(a, ".")
+	if err != nil || len(entries) != 2 || entries[0].Name() != "one.txt" || entries[1].Name() != "x" {
+		t.Errorf("ReadDir(.) = %v, %v; want one.txt and x", entries, err)
+	}
+	matches, err := fs.Glob(a, "*/deep")
+	if err != nil || len(matches) != 1 || matches[0] != "x/deep" {
+		t.Errorf("Glob(*/deep) = %v, %v; want x/deep", matches, err)
+	}
+
+	nested, err := a.Sub("x")
+	if err != nil {
+		t.Fatalf("Sub(x) failed: %v", err)
+	}
+	x := nested.(FileSystem)
+	if x.Root() != "a/x" {
+		t.Errorf("nested Root() = %q, want a/x", x.Root())
+	}
+	if data, err := x.ReadFile("deep"); err != nil || string(data) != "deep" {
+		t.Errorf("nested ReadFile(deep) = %q, %v", data, err)
+	}
+	if same, _ := x.Sub("."); same.(FileSystem).Root() != "a/x" {
+		t.Errorf("Sub(.) changed the root to %q", same.(FileSystem).Root())
+	}
+
+	// Errors name files relative to the subtree.
+	_, err = a.Open("missing")
+	var pe *fs.PathError
+	if !errors.As(err, &pe) || pe.Path != "missing" || !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Open(missing) error = %v, want a PathError for missing", err)
+	}
+
+	for _, dir := range []string{"../b", "/a", "a/", "", "one.txt", "nope"} {
+		if _, err := a.Sub(dir); err == nil {
+			t.Errorf("Sub(%q) succeeded", dir)
+		}
+	}
+	if _, err := a.Open("../root.txt"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("Open(../root.txt) error = %v, want fs.ErrInvalid", err)
+	}
+}
+
+func TestFileSystem_FixedRoot(t *testing.T) {
+	mfs, gfs := setupTreeFS(t)
+
+	if info, err := gfs.Stat("."); err != nil || !info.IsDir() {
+		t.Fatalf("Stat(.) = %v, %v; want the root directory", info, err)
+	}
+
+	// Changing the backend's directory mid-use does not move the root.
+	if err := mfs.Chdir("/a"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := gfs.ReadFile("root.txt"); err != nil || string(data) != "root" {
+		t.Errorf("after Chdir, ReadFile(root.txt) = %q, %v", data, err)
+	}
+	if _, err := gfs.Stat("one.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("after Chdir, Stat(one.txt) error = %v, want fs.ErrNotExist", err)
+	}
+	entries, err := gfs.ReadDir(".")
+	if err != nil || len(entries) != 3 {
+		t.Errorf("after Chdir, ReadDir(.) = %v, %v; want a, b and root.txt", entries, err)
+	}
+	sub, err := gfs.Sub("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mfs.Chdir("/a/x"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := fs.ReadFile(sub, "two.txt"); err != nil || string(data) != "two" {
+		t.Errorf("after second Chdir, Sub(b) ReadFile(two.txt) = %q, %v", data, err)
+	}
+
+	// A new FileSystem is rooted at the directory current when it is made.
+	at, err := NewFs(mfs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := at.ReadFile("deep"); err != nil || string(data) != "deep" {
+		t.Errorf("NewFs after Chdir: ReadFile(deep) = %q, %v", data, err)
+	}
+	if at.Root() != "." {
+		t.Errorf("Root() = %q, want .", at.Root())
+	}
+}
@@ -0,0 +1,157 @@
+// Package gofstest provides test helpers for filesystems built with the gofs
+// package. They live apart from gofs so that importing gofs never pulls the
+// testing and flag packages into a program.
+package gofstest
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/absfs/gofs"
+)
+
+// Golden compares the regular files in fsys against the txtar archive in
+// the host file golden, reporting every difference as a test error. When
+// the test binary is run with -update it writes the archive instead:
+//
+//	var _ = flag.Bool("update", false, "update golden files")
+//
+//	func TestBuild(t *testing.T) {
+//		gofstest.Golden(t, output, "testdata/build.txtar")
+//	}
+//
+// Golden looks the flag up by name rather than defining it, so that it never
+// collides with an -update flag the tests already declare; a test package
+// without one must declare it as above.
+func Golden(t testing.TB, fsys fs.FS, golden string) {
+	t.Helper()
+	CompareGolden(t, fsys, golden, updateFlag())
+}
+
+// updateFlag reports whether the boolean flag named update is set.
+func updateFlag() bool {
+	f := flag.Lookup("update")
+	if f == nil {
+		return false
+	}
+	getter, ok := f.Value.(flag.Getter)
+	if !ok {
+		return false
+	}
+	update, _ := getter.Get().(bool)
+	return update
+}
+
+// CompareGolden is like Golden, but writes the archive if update is set
+// instead of consulting the -update flag.
+func CompareGolden(t testing.TB, fsys fs.FS, golden string, update bool) {
+	t.Helper()
+	got, err := gofs.ToTxtar(fsys, ".")
+	if err != nil {
+		t.Fatalf("golden %s: %v", golden, err)
+	}
+	if update {
+		if err := os.MkdirAll(filepath.Dir(golden), 0755); err != nil {
+			t.Fatalf("golden %s: %v", golden, err)
+		}
+		if err := os.WriteFile(golden, got, 0644); err != nil {
+			t.Fatalf("golden %s: %v", golden, err)
+		}
+		return
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("golden %s: %v (update it to create it)", golden, err)
+	}
+	wantFiles, err := txtarFiles(want)
+	if err != nil {
+		t.Fatalf("golden %s: %v", golden, err)
+	}
+	gotFiles, err := txtarFiles(got)
+	if err != nil {
+		t.Fatalf("golden %s: %v", golden, err)
+	}
+	for _, diff := range diffFiles(wantFiles, gotFiles) {
+		t.Errorf("golden %s: %s", golden, diff)
+	}
+}
+
+// txtarFiles returns the contents of the files in a txtar archive, keyed by
+// name.
+func txtarFiles(archive []byte) (files map[string][]byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	fsys := gofs.FromTxtar(archive)
+	files = make(map[string][]byte)
+	err = fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		files[name], err = fs.ReadFile(fsys, name)
+		return err
+	})
+	return files, err
+}
+
+// diffFiles describes the differences between two sets of files, in name
+// order.
+func diffFiles(want, got map[string][]byte) []string {
+	var diffs []string
+	for _, name := range sortedNames(want) {
+		if _, ok := got[name]; !ok {
+			diffs = append(diffs, fmt.Sprintf("missing file %s", name))
+		}
+	}
+	for _, name := range sortedNames(got) {
+		w, ok := want[name]
+		switch {
+		case !ok:
+			diffs = append(diffs, fmt.Sprintf("unexpected file %s", name))
+		case !bytes.Equal(w, got[name]):
+			diffs = append(diffs, fmt.Sprintf("%s differs: %s", name, firstLineDiff(w, got[name])))
+		}
+	}
+	return diffs
+}
+
+func sortedNames(files map[string][]byte) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// firstLineDiff describes the first line at which want and got differ. They
+// must not be equal.
+func firstLineDiff(want, got []byte) string {
+	wl := strings.Split(strings.TrimSuffix(string(want), "\n"), "\n")
+	gl := strings.Split(strings.TrimSuffix(string(got), "\n"), "\n")
+	for i := 0; ; i++ {
+		switch {
+		case i >= len(wl) && i >= len(gl):
+			// The lines agree, so only the final newline differs.
+			if bytes.HasSuffix(got, []byte("\n")) {
+				return "unexpected trailing newline"
+			}
+			return "missing trailing newline"
+		case i >= len(wl):
+			return fmt.Sprintf("line %d: unexpected %q", i+1, gl[i])
+		case i >= len(gl):
+			return fmt.Sprintf("line %d: missing %q", i+1, wl[i])
+		case wl[i] != gl[i]:
+			return fmt.Sprintf("line %d: got %q, want %q", i+1, gl[i], wl[i])
+		}
+	}
+}
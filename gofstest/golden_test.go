@@ -0,0 +1,88 @@
+package gofstest
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/absfs/gofs"
+)
+
+// recordingTB records the errors reported through it.
+type recordingTB struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recordingTB) Helper() {}
+
+func (r *recordingTB) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+var _ = flag.Bool("update", false, "update golden files")
+
+func TestGolden(t *testing.T) {
+	golden := filepath.Join(t.TempDir(), "testdata", "expected.txtar")
+	fsys := gofs.FromTxtar([]byte("-- a.txt --\nalpha\n-- b.txt --\nbeta\n"))
+
+	CompareGolden(t, fsys, golden, true)
+	if data, err := os.ReadFile(golden); err != nil || string(data) != "-- a.txt --\nalpha\n-- b.txt --\nbeta\n" {
+		t.Fatalf("updated golden = %q, %v", data, err)
+	}
+
+	CompareGolden(t, fsys, golden, false)
+
+	changed := gofs.FromTxtar([]byte("-- a.txt --\nalpha\nextra\n-- c.txt --\ngamma\n"))
+	rec := &recordingTB{TB: t}
+	CompareGolden(rec, changed, golden, false)
+	want := []string{
+		"golden " + golden + ": missing file b.txt",
+		"golden " + golden + `: a.txt differs: line 2: unexpected "extra"`,
+		"golden " + golden + ": unexpected file c.txt",
+	}
+	if !reflect.DeepEqual(rec.errors, want) {
+		t.Errorf("Golden errors = %q\nwant %q", rec.errors, want)
+	}
+}
+
+func TestGolden_UpdateFlag(t *testing.T) {
+	golden := filepath.Join(t.TempDir(), "expected.txtar")
+	fsys := gofs.FromTxtar([]byte("-- a.txt --\nalpha\n"))
+
+	if err := flag.Set("update", "true"); err != nil {
+		t.Fatal(err)
+	}
+	defer flag.Set("update", "false")
+	Golden(t, fsys, golden)
+	if data, err := os.ReadFile(golden); err != nil || string(data) != "-- a.txt --\nalpha\n" {
+		t.Fatalf("updated golden = %q, %v", data, err)
+	}
+
+	flag.Set("update", "false")
+	rec := &recordingTB{TB: t}
+	Golden(rec, gofs.FromTxtar([]byte("-- a.txt --\nbeta\n")), golden)
+	want := []string{"golden " + golden + `: a.txt differs: line 1: got "beta", want "alpha"`}
+	if !reflect.DeepEqual(rec.errors, want) {
+		t.Errorf("Golden errors = %q\nwant %q", rec.errors, want)
+	}
+}
+
+func TestFirstLineDiff(t *testing.T) {
+	for _, tt := range []struct {
+		want, got, diff string
+	}{
+		{"a\nb\n", "a\nc\n", `line 2: got "c", want "b"`},
+		{"a\n", "a\nb\n", `line 2: unexpected "b"`},
+		{"a\nb\n", "a\n", `line 2: missing "b"`},
+		{"", "\n", "unexpected trailing newline"},
+		{"a\n", "a", "missing trailing newline"},
+	} {
+		if diff := firstLineDiff([]byte(tt.want), []byte(tt.got)); diff != tt.diff {
+			t.Errorf("firstLineDiff(%q, %q) = %q, want %q", tt.want, tt.got, diff, tt.diff)
+		}
+	}
+}
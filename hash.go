@@ -0,0 +1,321 @@
+package gofs
+
+import (
+	"crypto"
+	_ "crypto/md5"    // register crypto.MD5
+	_ "crypto/sha1"   // register crypto.SHA1
+	_ "crypto/sha256" // register crypto.SHA224 and crypto.SHA256
+	_ "crypto/sha512" // register crypto.SHA384 and crypto.SHA512 variants
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"runtime"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// ErrHashUnavailable is returned when the requested crypto.Hash is not linked
+// into the binary. The standard library SHA-1, SHA-2 and MD5 families are
+// always available; other algorithms such as crypto.BLAKE2b_256 become
+// available once their implementation package is imported by the program.
+var ErrHashUnavailable = errors.New("hash function unavailable")
+
+// HashFile returns the digest of the contents of the named file using algo.
+func HashFile(fsys fs.FS, name string, algo crypto.Hash) ([]byte, error) {
+	if !algo.Available() {
+		return nil, &fs.PathError{Op: "hash", Path: name, Err: ErrHashUnavailable}
+	}
+	return hashFile(fsys, name, algo)
+}
+
+func hashFile(fsys fs.FS, name string, algo crypto.Hash) ([]byte, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := algo.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, &fs.PathError{Op: "hash", Path: name, Err: err}
+	}
+	return h.Sum(nil), nil
+}
+
+// Tree holds the Merkle digests computed by TreeDigest.
+//
+// Every path is relative to the fs.FS that was hashed, in the same form
+// accepted by fs.FS.Open. The root directory passed to TreeDigest is stored
+// under its own name, so Dirs[dir] always equals Root.
+type Tree struct {
+	// Algo is the hash function used to compute every digest in the tree.
+	Algo crypto.Hash
+
+	// Dir is the directory that was passed to TreeDigest.
+	Dir string
+
+	// Root is the digest of the directory passed to TreeDigest.
+	Root []byte
+
+	// Dirs maps each directory path to the digest of its subtree.
+	Dirs map[string][]byte
+
+	// Files maps each regular file path to the digest of its contents.
+	Files map[string][]byte
+
+	// Modes maps the path of every entry below Dir, of any type, to its
+	// fs.FileMode.
+	Modes map[string]fs.FileMode
+
+	// children maps each directory path to the sorted paths of its direct
+	// children in Dirs, Files and Modes. It is built by TreeDigest; Changed builds
+	// it on demand for trees assembled by hand.
+	children map[string][]string
+}
+
+// Changed returns the paths whose digest or mode differs between t and old,
+// including paths present in only one of the two trees. Subtrees whose directory digest
+// is unchanged are skipped without being inspected, so comparing two large
+// trees that differ in a single file only visits the directories on the path
+// to that file. The result is sorted.
+func (t *Tree) Changed(old *Tree) []string {
+	newIndex, oldIndex := t.childIndex(), old.childIndex()
+	var changed []string
+	var visit func(dir string)
+	visit = func(dir string) {
+		if digestEqual(t.Dirs[dir], old.Dirs[dir]) {
+			return
+		}
+		changed = append(changed, dir)
+		for _, name := range mergeNames(newIndex[dir], oldIndex[dir]) {
+			_, newDir := t.Dirs[name]
+			_, oldDir := old.Dirs[name]
+			modeChanged := t.Modes[name] != old.Modes[name]
+			if newDir && oldDir {
+				if modeChanged && digestEqual(t.Dirs[name], old.Dirs[name]) {
+					changed = append(changed, name)
+				}
+				visit(name)
+				continue
+			}
+			if newDir != oldDir || modeChanged || !digestEqual(t.Files[name], old.Files[name]) {
+				changed = append(changed, name)
+			}
+		}
+	}
+
+	if t.Dir != old.Dir {
+		// Trees of different roots share nothing worth pruning.
+		changed = append(changed, t.Dir, old.Dir)
+	} else {
+		visit(t.Dir)
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// childIndex returns t.children, or an equivalent index built from Dirs,
+// Files and Modes if t was not created by TreeDigest.
+func (t *Tree) childIndex() map[string][]string {
+	if t.children != nil {
+		return t.children
+	}
+	index := make(map[string][]string)
+	add := func(name string) {
+		if name != t.Dir {
+			dir := path.Dir(name)
+			index[dir] = append(index[dir], name)
+		}
+	}
+	for _, m := range []map[string][]byte{t.Dirs, t.Files} {
+		for name := range m {
+			add(name)
+		}
+	}
+	for name := range t.Modes {
+		add(name)
+	}
+	for dir, names := range index {
+		sort.Strings(names)
+		index[dir] = slices.Compact(names)
+	}
+	return index
+}
+
+// mergeNames returns the sorted union of the sorted slices a and b.
+func mergeNames(a, b []string) []string {
+	names := make([]string, 0, len(a)+len(b))
+	for len(a) > 0 && len(b) > 0 {
+		switch {
+		case a[0] < b[0]:
+			names, a = append(names, a[0]), a[1:]
+		case a[0] > b[0]:
+			names, b = append(names, b[0]), b[1:]
+		default:
+			names, a, b = append(names, a[0]), a[1:], b[1:]
+		}
+	}
+	names = append(names, a...)
+	return append(names, b...)
+}
+
+func digestEqual(a, b []byte) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return string(a) == string(b)
+}
+
+// treeNode is a directory entry discovered while building a Tree.
+type treeNode struct {
+	path     string
+	name     string
+	mode     fs.FileMode
+	children []*treeNode
+	digest   []byte
+}
+
+// TreeDigest computes a deterministic Merkle digest over the directory tree
+// rooted at dir.
+//
+// Each regular file is hashed by its contents. Each directory is hashed over
+// its entries in lexical order, where every entry contributes its name, its
+// fs.FileMode and its own digest; renaming a file, changing its permissions
+// or editing its contents therefore changes the digest of every directory
+// above it. Entries that are neither regular files nor directories contribute
+// their name and mode only.
+//
+// File contents are hashed concurrently using up to runtime.GOMAXPROCS(0)
+// workers. The returned Tree records the digest of every directory and file
+// so that Tree.Changed can locate the subtrees that differ between two runs.
+func TreeDigest(fsys fs.FS, dir string, algo crypto.Hash) (*Tree, error) {
+	if !algo.Available() {
+		return nil, &fs.PathError{Op: "hash", Path: dir, Err: ErrHashUnavailable}
+	}
+
+	root := &treeNode{path: dir, name: path.Base(dir), mode: fs.ModeDir}
+
+	var files []*treeNode
+	if err := buildTree(fsys, root, &files); err != nil {
+		return nil, err
+	}
+	if err := hashFiles(fsys, files, algo); err != nil {
+		return nil, err
+	}
+
+	tree := &Tree{
+		Algo:  algo,
+		Dir:   dir,
+		Dirs:  make(map[string][]byte),
+		Files: make(map[string][]byte, len(files)),
+		Modes: make(map[string]fs.FileMode),
+
+		children: make(map[string][]string),
+	}
+	tree.Root = digestDir(root, algo, tree)
+	return tree, nil
+}
+
+// buildTree reads the directory n recursively, appending every regular file
+// to files.
+func buildTree(fsys fs.FS, n *treeNode, files *[]*treeNode) error {
+	entries, err := fs.ReadDir(fsys, n.path)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		child := &treeNode{
+			path: path.Join(n.path, entry.Name()),
+			name: entry.Name(),
+			mode: info.Mode(),
+		}
+		n.children = append(n.children, child)
+		switch {
+		case child.mode.IsDir():
+			if err := buildTree(fsys, child, files); err != nil {
+				return err
+			}
+		case child.mode.IsRegular():
+			*files = append(*files, child)
+		}
+	}
+	return nil
+}
+
+// hashFiles fills in the digest of every node in files using a bounded pool
+// of workers. It returns the first error encountered.
+func hashFiles(fsys fs.FS, files []*treeNode, algo crypto.Hash) error {
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(files) {
+		workers = len(files)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+		work     = make(chan *treeNode)
+		done     = make(chan struct{})
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range work {
+				digest, err := hashFile(fsys, n.path, algo)
+				if err != nil {
+					once.Do(func() {
+						firstErr = err
+						close(done)
+					})
+					continue
+				}
+				n.digest = digest
+			}
+		}()
+	}
+
+feed:
+	for _, n := range files {
+		select {
+		case work <- n:
+		case <-done:
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+	return firstErr
+}
+
+// digestDir computes the digest of n from the digests of its children,
+// recording every directory and file digest in tree.
+func digestDir(n *treeNode, algo crypto.Hash, tree *Tree) []byte {
+	h := algo.New()
+	var mode [4]byte
+	for _, child := range n.children {
+		switch {
+		case child.mode.IsDir():
+			child.digest = digestDir(child, algo, tree)
+		case child.mode.IsRegular():
+			tree.Files[child.path] = child.digest
+		}
+		tree.Modes[child.path] = child.mode
+		tree.children[n.path] = append(tree.children[n.path], child.path)
+		io.WriteString(h, child.name)
+		h.Write([]byte{0})
+		binary.BigEndian.PutUint32(mode[:], uint32(child.mode))
+		h.Write(mode[:])
+		h.Write(child.digest)
+	}
+	n.digest = h.Sum(nil)
+	tree.Dirs[n.path] = n.digest
+	return n.digest
+}
@@ -0,0 +1,224 @@
+package gofs
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"errors"
+	"io/fs"
+	"reflect"
+	"testing"
+
+	"github.com/absfs/memfs"
+)
+
+func setupTreeFS(t *testing.T) (*memfs.FileSystem, FileSystem) {
+	t.Helper()
+	mfs, err := memfs.NewFS()
+	if err != nil {
+		t.Fatalf("Failed to create memfs: %v", err)
+	}
+	for _, dir := range []string{"a", "a/x", "b"} {
+		if err := mfs.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory %s: %v", dir, err)
+		}
+	}
+	files := map[string]string{
+		"root.txt":  "root",
+		"a/one.txt": "one",
+		"a/x/deep":  "deep",
+		"b/two.txt": "two",
+	}
+	for name, content := range files {
+		if err := writeFile(mfs, name, []byte(content)); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	gfs, err := NewFs(mfs)
+	if err != nil {
+		t.Fatalf("Failed to create gofs: %v", err)
+	}
+	return mfs, gfs
+}
+
+func TestHashFile(t *testing.T) {
+	gfs := setupTestFS(t)
+
+	t.Run("sha256", func(t *testing.T) {
+		got, err := HashFile(gfs, "testfile.txt", crypto.SHA256)
+		if err != nil {
+			t.Fatalf("HashFile() failed: %v", err)
+		}
+		want := sha256.Sum256([]byte("Hello, World!"))
+		if !bytes.Equal(got, want[:]) {
+			t.Errorf("HashFile() = %x, want %x", got, want)
+		}
+	})
+
+	t.Run("non-existent file", func(t *testing.T) {
+		if _, err := HashFile(gfs, "nonexistent.txt", crypto.SHA256); err == nil {
+			t.Error("HashFile() should return error for non-existent file")
+		}
+	})
+
+	t.Run("unavailable algorithm", func(t *testing.T) {
+		_, err := HashFile(gfs, "testfile.txt", crypto.BLAKE2b_256)
+		if !errors.Is(err, ErrHashUnavailable) {
+			t.Errorf("HashFile() error = %v, want ErrHashUnavailable", err)
+		}
+	})
+}
+
+func TestTreeDigest(t *testing.T) {
+	t.Run("deterministic", func(t *testing.T) {
+		_, gfs1 := setupTreeFS(t)
+		_, gfs2 := setupTreeFS(t)
+
+		t1, err := TreeDigest(gfs1, ".", crypto.SHA256)
+		if err != nil {
+			t.Fatalf("TreeDigest() failed: %v", err)
+		}
+		t2, err := TreeDigest(gfs2, ".", crypto.SHA256)
+		if err != nil {
+			t.Fatalf("TreeDigest() failed: %v", err)
+		}
+		if !bytes.Equal(t1.Root, t2.Root) {
+			t.Errorf("TreeDigest() roots differ for identical trees: %x != %x", t1.Root, t2.Root)
+		}
+		if !bytes.Equal(t1.Dirs["."], t1.Root) {
+			t.Error("Dirs[\".\"] does not equal Root")
+		}
+		if len(t1.Files) != 4 {
+			t.Errorf("TreeDigest() recorded %d files, want 4", len(t1.Files))
+		}
+		want := sha256.Sum256([]byte("deep"))
+		if !bytes.Equal(t1.Files["a/x/deep"], want[:]) {
+			t.Errorf("Files[a/x/deep] = %x, want %x", t1.Files["a/x/deep"], want)
+		}
+		if changed := t1.Changed(t2); len(changed) != 0 {
+			t.Errorf("Changed() = %v, want none", changed)
+		}
+	})
+
+	t.Run("content change", func(t *testing.T) {
+		mfs, gfs := setupTreeFS(t)
+		before, err := TreeDigest(gfs, ".", crypto.SHA256)
+		if err != nil {
+			t.Fatalf("TreeDigest() failed: %v", err)
+		}
+		if err := writeFile(mfs, "a/x/deep", []byte("changed")); err != nil {
+			t.Fatal(err)
+		}
+		after, err := TreeDigest(gfs, ".", crypto.SHA256)
+		if err != nil {
+			t.Fatalf("TreeDigest() failed: %v", err)
+		}
+		if bytes.Equal(before.Root, after.Root) {
+			t.Error("Root digest unchanged after content change")
+		}
+		if !bytes.Equal(before.Dirs["b"], after.Dirs["b"]) {
+			t.Error("Digest of untouched subtree b changed")
+		}
+		want := []string{".", "a", "a/x", "a/x/deep"}
+		if got := after.Changed(before); !reflect.DeepEqual(got, want) {
+			t.Errorf("Changed() = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("mode change", func(t *testing.T) {
+		mfs, gfs := setupTreeFS(t)
+		before, err := TreeDigest(gfs, ".", crypto.SHA256)
+		if err != nil {
+			t.Fatalf("TreeDigest() failed: %v", err)
+		}
+		if err := mfs.Chmod("b/two.txt", 0600); err != nil {
+			t.Fatal(err)
+		}
+		after, err := TreeDigest(gfs, ".", crypto.SHA256)
+		if err != nil {
+			t.Fatalf("TreeDigest() failed: %v", err)
+		}
+		if !bytes.Equal(before.Files["b/two.txt"], after.Files["b/two.txt"]) {
+			t.Error("File digest changed although contents did not")
+		}
+		if bytes.Equal(before.Dirs["b"], after.Dirs["b"]) {
+			t.Error("Directory digest unchanged after mode change")
+		}
+		want := []string{".", "b", "b/two.txt"}
+		if got := after.Changed(before); !reflect.DeepEqual(got, want) {
+			t.Errorf("Changed() = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("directory mode change", func(t *testing.T) {
+		mfs, gfs := setupTreeFS(t)
+		before, err := TreeDigest(gfs, ".", crypto.SHA256)
+		if err != nil {
+			t.Fatalf("TreeDigest() failed: %v", err)
+		}
+		if err := mfs.Chmod("a/x", fs.ModeDir|0700); err != nil {
+			t.Fatal(err)
+		}
+		after, err := TreeDigest(gfs, ".", crypto.SHA256)
+		if err != nil {
+			t.Fatalf("TreeDigest() failed: %v", err)
+		}
+		if !bytes.Equal(before.Dirs["a/x"], after.Dirs["a/x"]) {
+			t.Error("Digest of a/x changed although its entries did not")
+		}
+		want := []string{".", "a", "a/x"}
+		if got := after.Changed(before); !reflect.DeepEqual(got, want) {
+			t.Errorf("Changed() = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("added and removed", func(t *testing.T) {
+		mfs, gfs := setupTreeFS(t)
+		before, err := TreeDigest(gfs, ".", crypto.SHA256)
+		if err != nil {
+			t.Fatalf("TreeDigest() failed: %v", err)
+		}
+		if err := mfs.Remove("b/two.txt"); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeFile(mfs, "b/three.txt", []byte("three")); err != nil {
+			t.Fatal(err)
+		}
+		after, err := TreeDigest(gfs, ".", crypto.SHA256)
+		if err != nil {
+			t.Fatalf("TreeDigest() failed: %v", err)
+		}
+		want := []string{".", "b", "b/three.txt", "b/two.txt"}
+		if got := after.Changed(before); !reflect.DeepEqual(got, want) {
+			t.Errorf("Changed() = %v, want %v", got, want)
+		}
+
+		// A Tree assembled from its exported fields compares the same way.
+		copied := &Tree{Algo: before.Algo, Dir: before.Dir, Root: before.Root, Dirs: before.Dirs, Files: before.Files, Modes: before.Modes}
+		if got := after.Changed(copied); !reflect.DeepEqual(got, want) {
+			t.Errorf("Changed(copied) = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("subdirectory root", func(t *testing.T) {
+		_, gfs := setupTreeFS(t)
+		full, err := TreeDigest(gfs, ".", crypto.SHA256)
+		if err != nil {
+			t.Fatalf("TreeDigest() failed: %v", err)
+		}
+		sub, err := TreeDigest(gfs, "a", crypto.SHA256)
+		if err != nil {
+			t.Fatalf("TreeDigest() failed: %v", err)
+		}
+		if !bytes.Equal(sub.Root, full.Dirs["a"]) {
+			t.Errorf("TreeDigest(a) = %x, want %x", sub.Root, full.Dirs["a"])
+		}
+	})
+
+	t.Run("not a directory", func(t *testing.T) {
+		_, gfs := setupTreeFS(t)
+		if _, err := TreeDigest(gfs, "root.txt", crypto.SHA256); err == nil {
+			t.Error("TreeDigest() should return error for a regular file")
+		}
+	})
+}
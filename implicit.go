@@ -0,0 +1,233 @@
+package gofs
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// A PrefixLister enumerates the files of a flat-key store, such as an
+// object store, whose names begin with a prefix.
+type PrefixLister interface {
+	// ListPrefix lists the keys, as io/fs names, that begin with prefix,
+	// which is empty or ends in "/", the way object stores list with the
+	// delimiter "/": files holds the keys with no further "/" after prefix,
+	// and dirs holds, once each, the common prefixes up to and including
+	// the next "/" of the other keys. If limit > 0, at most limit names are
+	// returned in all. Names need not be sorted.
+	ListPrefix(prefix string, limit int) (files, dirs []string, err error)
+}
+
+// ImplicitDirFS is a read-only view of an fs.FS holding flat keys, such as
+// "a/b/c.txt", without directory objects. Directories are inferred from
+// the key prefixes: Stat reports a directory, with mode fs.ModeDir|0555 and
+// the zero modification time, for every prefix of a key, and ReadDir lists
+// the files and inferred directories below it, so fs.WalkDir works. It
+// implements fs.FS, fs.StatFS, fs.ReadDirFS and fs.ReadFileFS.
+//
+// Keys are enumerated with Lister when it is set. Otherwise the names of
+// the wrapped filesystem are found once, by reading its directories
+// recursively from the root, and cached until Reset is called; listings of
+// the root of a flat-key store may name files with slashes in them.
+// Directories that the wrapped filesystem does have are merged with the
+// inferred ones.
+type ImplicitDirFS struct {
+	// FS is the wrapped filesystem.
+	FS fs.FS
+
+	// Lister, if set, enumerates the keys of FS by prefix.
+	Lister PrefixLister
+
+	mu   sync.Mutex
+	keys []string // sorted, when Lister is nil
+}
+
+// ImplicitDirs returns an ImplicitDirFS over fsys, using fsys as the Lister
+// if it implements PrefixLister.
+func ImplicitDirs(fsys fs.FS) *ImplicitDirFS {
+	lister, _ := fsys.(PrefixLister)
+	return &ImplicitDirFS{FS: fsys, Lister: lister}
+}
+
+// Reset discards the cached keys.
+func (d *ImplicitDirFS) Reset() {
+	d.mu.Lock()
+	d.keys = nil
+	d.mu.Unlock()
+}
+
+// list lists the keys beginning with prefix as PrefixLister.ListPrefix
+// does.
+func (d *ImplicitDirFS) list(prefix string, limit int) (files, dirs []string, err error) {
+	if d.Lister != nil {
+		return d.Lister.ListPrefix(prefix, limit)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.keys == nil {
+		keys := []string{}
+		if err := d.scan(".", &keys); err != nil {
+			return nil, nil, err
+		}
+		slices.Sort(keys)
+		d.keys = keys
+	}
+	i, _ := slices.BinarySearch(d.keys, prefix)
+	for i < len(d.keys) && strings.HasPrefix(d.keys[i], prefix) {
+		if limit > 0 && len(files)+len(dirs) == limit {
+			break
+		}
+		child, _, isDir := strings.Cut(d.keys[i][len(prefix):], "/")
+		if !isDir {
+			files = append(files, d.keys[i])
+			i++
+			continue
+		}
+		dir := prefix + child + "/"
+		dirs = append(dirs, dir)
+		// Skip the other keys below dir, which sort together.
+		i, _ = slices.BinarySearch(d.keys, prefix+child+"0") // '0' follows '/'
+	}
+	return files, dirs, nil
+}
+
+// scan adds the files below the directory dir of the wrapped filesystem to
+// keys.
+func (d *ImplicitDirFS) scan(dir string, keys *[]string) error {
+	entries, err := fs.ReadDir(d.FS, dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		name := joinName(dir, e.Name())
+		if e.IsDir() {
+			if err := d.scan(name, keys); err != nil {
+				return err
+			}
+		} else if fs.ValidPath(name) {
+			*keys = append(*keys, name)
+		}
+	}
+	return nil
+}
+
+// dirPrefix returns the prefix of the keys below the directory name.
+func dirPrefix(name string) string {
+	if name == "." {
+		return ""
+	}
+	return name + "/"
+}
+
+// implicit reports whether name is a directory inferred from the keys.
+func (d *ImplicitDirFS) implicit(name string) (bool, error) {
+	if name == "." {
+		return true, nil
+	}
+	files, dirs, err := d.list(dirPrefix(name), 1)
+	return len(files)+len(dirs) > 0, err
+}
+
+// Stat returns the FileInfo of the named file, or of the inferred directory
+// name.
+func (d *ImplicitDirFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	info, err := fs.Stat(d.FS, name)
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		return info, err
+	}
+	if ok, lerr := d.implicit(name); lerr != nil {
+		return nil, pathError("stat", name, lerr)
+	} else if !ok {
+		return nil, err
+	}
+	return &frozenInfo{name: path.Base(name), mode: fs.ModeDir | 0555}, nil
+}
+
+// ReadDir reads the named directory, listing the files and inferred
+// directories below it.
+func (d *ImplicitDirFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	info, err := d.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+
+	byName := make(map[string]fs.DirEntry)
+	// Entries of a real directory are kept, except flat keys in it, which
+	// are listed with the others below.
+	if entries, err := fs.ReadDir(d.FS, name); err == nil {
+		for _, e := range entries {
+			if !strings.Contains(e.Name(), "/") {
+				byName[e.Name()] = e
+			}
+		}
+	}
+	prefix := dirPrefix(name)
+	files, dirs, err := d.list(prefix, 0)
+	if err != nil {
+		return nil, pathError("readdir", name, err)
+	}
+	for _, key := range files {
+		child := strings.TrimPrefix(key, prefix)
+		if _, ok := byName[child]; !ok && child != "" {
+			byName[child] = &implicitEntry{fsys: d.FS, key: key}
+		}
+	}
+	for _, dir := range dirs {
+		child := strings.TrimSuffix(strings.TrimPrefix(dir, prefix), "/")
+		if _, ok := byName[child]; !ok && child != "" {
+			byName[child] = fs.FileInfoToDirEntry(&frozenInfo{name: child, mode: fs.ModeDir | 0555})
+		}
+	}
+
+	entries := make([]fs.DirEntry, 0, len(byName))
+	for _, e := range byName {
+		entries = append(entries, e)
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return entries, nil
+}
+
+// Open opens the named file, or the inferred directory name.
+func (d *ImplicitDirFS) Open(name string) (fs.File, error) {
+	info, err := d.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return d.FS.Open(name)
+	}
+	entries, err := d.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	return &infoDir{info: info, entries: entries}, nil
+}
+
+// ReadFile reads the named file.
+func (d *ImplicitDirFS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+	return fs.ReadFile(d.FS, name)
+}
+
+// implicitEntry is a directory entry for a key, statted when its Info is
+// needed.
+type implicitEntry struct {
+	fsys fs.FS
+	key  string
+}
+
+func (e *implicitEntry) Name() string               { return path.Base(e.key) }
+func (e *implicitEntry) IsDir() bool                { return false }
+func (e *implicitEntry) Type() fs.FileMode          { return 0 }
+func (e *implicitEntry) Info() (fs.FileInfo, error) { return fs.Stat(e.fsys, e.key) }
@@ -0,0 +1,127 @@
+package gofs
+
+import (
+	"errors"
+	"io/fs"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// flatKeys is a flat-key store: only the keys themselves can be opened,
+// and the root lists every key, slashes and all.
+type flatKeys map[string]string
+
+func (f flatKeys) Open(name string) (fs.File, error) {
+	data, ok := f[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return fstest.MapFS{name: {Data: []byte(data), Mode: 0644}}.Open(name)
+}
+
+func (f flatKeys) ReadDir(name string) ([]fs.DirEntry, error) {
+	if name != "." {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	var entries []fs.DirEntry
+	for key, data := range f {
+		entries = append(entries, fs.FileInfoToDirEntry(&frozenInfo{name: key, size: int64(len(data)), mode: 0644}))
+	}
+	return entries, nil
+}
+
+// listedKeys is a flatKeys that can list keys by prefix, counting calls
+// and the names returned.
+type listedKeys struct {
+	flatKeys
+	calls, names *int
+}
+
+func (l listedKeys) ListPrefix(prefix string, limit int) (files, dirs []string, err error) {
+	*l.calls++
+	seen := make(map[string]bool)
+	for _, key := range slices.Sorted(maps.Keys(l.flatKeys)) {
+		if limit > 0 && len(files)+len(dirs) == limit {
+			break
+		}
+		rest, ok := strings.CutPrefix(key, prefix)
+		if !ok {
+			continue
+		}
+		if child, _, isDir := strings.Cut(rest, "/"); !isDir {
+			files = append(files, key)
+		} else if dir := prefix + child + "/"; !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	*l.names += len(files) + len(dirs)
+	return files, dirs, nil
+}
+
+func TestImplicitDirs(t *testing.T) {
+	keys := flatKeys{
+		"index.html":         "index",
+		"a/b/c.txt":          "c",
+		"a/b/d.txt":          "d",
+		"a/e.txt":            "e",
+		"assets/css/app.css": "css",
+	}
+	if _, err := fs.Stat(keys, "a"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("flat store Stat(a) error = %v, want ErrNotExist", err)
+	}
+
+	calls, names := 0, 0
+	for name, fsys := range map[string]*ImplicitDirFS{
+		"scan":   ImplicitDirs(keys),
+		"lister": ImplicitDirs(listedKeys{keys, &calls, &names}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			info, err := fsys.Stat("a/b")
+			if err != nil || !info.IsDir() || info.Mode() != fs.ModeDir|0555 || info.Name() != "b" {
+				t.Errorf("Stat(a/b) = %v, %v; want a synthetic directory", info, err)
+			}
+			if _, err := fsys.Stat("a/b/c"); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("Stat(a/b/c) error = %v, want ErrNotExist", err)
+			}
+			if _, err := fsys.Stat("a/b/c.txt/x"); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("Stat(a/b/c.txt/x) error = %v, want ErrNotExist", err)
+			}
+			checkWalk(t, fsys, ". a a/b a/b/c.txt a/b/d.txt a/e.txt assets assets/css assets/css/app.css index.html")
+			if err := fstest.TestFS(fsys, "a/b/c.txt", "assets/css/app.css", "index.html"); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	if calls == 0 {
+		t.Error("ListPrefix was not used")
+	}
+
+	// Stat needs one name, and ReadDir only the direct children.
+	calls, names = 0, 0
+	lister := ImplicitDirs(listedKeys{keys, &calls, &names})
+	if _, err := lister.Stat("a"); err != nil || names != 1 {
+		t.Errorf("Stat(a) = %v after listing %d names, want 1", err, names)
+	}
+	names = 0
+	entries, err := lister.ReadDir(".")
+	if err != nil || len(entries) != 3 || names != 3 {
+		t.Errorf("ReadDir(.) = %d entries, %v after listing %d names, want 3 and 3", len(entries), err, names)
+	}
+
+	scan := ImplicitDirs(keys)
+	if files, dirs, err := scan.list("a/", 0); err != nil || !slices.Equal(files, []string{"a/e.txt"}) || !slices.Equal(dirs, []string{"a/b/"}) {
+		t.Errorf(`list("a/") = %v, %v, %v; want [a/e.txt] [a/b/]`, files, dirs, err)
+	}
+	if files, dirs, err := scan.list("", 2); err != nil || len(files)+len(dirs) != 2 {
+		t.Errorf(`list("", 2) = %v, %v, %v; want 2 names`, files, dirs, err)
+	}
+}
+
+func TestImplicitDirs_RealDirs(t *testing.T) {
+	_, gfs := setupTreeFS(t)
+	checkWalk(t, ImplicitDirs(gfs), ". a a/one.txt a/x a/x/deep b b/two.txt root.txt")
+}
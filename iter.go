@@ -0,0 +1,181 @@
+package gofs
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/fs"
+	"iter"
+	"path"
+	"strings"
+)
+
+// entriesPageSize is the number of directory entries requested from the
+// backend at a time by Entries and Walk.
+const entriesPageSize = 64
+
+// Entries returns an iterator over the entries of the directory dir. Entries
+// are read from the backend a page at a time through File.ReadDir, so large
+// directories are never held in memory all at once, and breaking out of the
+// loop closes the directory immediately.
+//
+// Entries are yielded in directory order with a nil error. If the directory
+// cannot be opened or read, the iterator yields a single nil entry with the
+// error and stops.
+func (f FileSystem) Entries(dir string) iter.Seq2[fs.DirEntry, error] {
+	return func(yield func(fs.DirEntry, error) bool) {
+		file, err := f.Open(dir)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer file.Close()
+
+		rd, ok := file.(fs.ReadDirFile)
+		if !ok {
+			yield(nil, &fs.PathError{Op: "readdir", Path: dir, Err: errors.New("not a directory")})
+			return
+		}
+		for {
+			page, err := rd.ReadDir(entriesPageSize)
+			for _, entry := range page {
+				if !yield(entry, nil) {
+					return
+				}
+			}
+			if err != nil {
+				if !errors.Is(err, io.EOF) {
+					yield(nil, err)
+				}
+				return
+			}
+			if len(page) == 0 {
+				return
+			}
+		}
+	}
+}
+
+// Walk returns an iterator over the file tree rooted at root, yielding the
+// path and fs.DirEntry of root and of every file and directory below it.
+// Like fs.WalkDir it visits each directory before its contents, but entries
+// are visited in directory order rather than sorted, since sorting would
+// require reading whole directories. Directories are read a page at a time
+// and at most one handle is open per level of the tree; breaking out of the
+// loop closes every handle the iterator has open before the loop statement
+// completes.
+//
+// Walk reports no errors: a root that cannot be opened yields nothing, and
+// directories that cannot be read are yielded but not descended into. Use
+// fs.WalkDir when errors must be handled.
+func Walk(fsys fs.FS, root string) iter.Seq2[string, fs.DirEntry] {
+	return func(yield func(string, fs.DirEntry) bool) {
+		f, err := fsys.Open(root)
+		if err != nil {
+			return
+		}
+		defer f.Close()
+
+		info, err := f.Stat()
+		if err != nil {
+			return
+		}
+		d := fs.FileInfoToDirEntry(info)
+		if !yield(root, d) || !d.IsDir() {
+			return
+		}
+		walkDir(fsys, root, f, yield)
+	}
+}
+
+// walkDir yields the entries below the open directory f, named dir. It
+// returns false once yield has asked to stop.
+func walkDir(fsys fs.FS, dir string, f fs.File, yield func(string, fs.DirEntry) bool) bool {
+	rd, ok := f.(fs.ReadDirFile)
+	if !ok {
+		return true
+	}
+	for {
+		page, err := rd.ReadDir(entriesPageSize)
+		for _, entry := range page {
+			name := path.Join(dir, entry.Name())
+			if !yield(name, entry) {
+				return false
+			}
+			if entry.IsDir() && !walkSubdir(fsys, name, yield) {
+				return false
+			}
+		}
+		if err != nil || len(page) == 0 {
+			return true
+		}
+	}
+}
+
+// walkSubdir opens the directory name and walks it, closing it afterwards.
+func walkSubdir(fsys fs.FS, name string, yield func(string, fs.DirEntry) bool) bool {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return true
+	}
+	defer f.Close()
+	return walkDir(fsys, name, f, yield)
+}
+
+// Lines returns an iterator over the lines read from the file's current
+// offset. Each line is yielded without its trailing "\n" or "\r\n". Lines of
+// any length are supported. Because reads are buffered, the file offset
+// after breaking out of the loop may be past the last line yielded.
+//
+// A read error other than io.EOF is yielded once with an empty line, after
+// which iteration stops.
+func (f File) Lines() iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		r := bufio.NewReader(f.F)
+		for {
+			line, err := r.ReadString('\n')
+			if len(line) > 0 {
+				line = strings.TrimSuffix(line, "\n")
+				line = strings.TrimSuffix(line, "\r")
+				if !yield(line, nil) {
+					return
+				}
+			}
+			if err != nil {
+				if !errors.Is(err, io.EOF) {
+					yield("", err)
+				}
+				return
+			}
+		}
+	}
+}
+
+// Chunks returns an iterator over the contents of the file from its current
+// offset in chunks of size bytes; the final chunk may be shorter. The yielded
+// slice is reused between iterations and is only valid until the loop body
+// returns, so callers that keep data must copy it. Chunks panics if size is
+// not positive.
+//
+// A read error other than io.EOF is yielded once with a nil chunk, after
+// which iteration stops.
+func (f File) Chunks(size int) iter.Seq2[[]byte, error] {
+	if size <= 0 {
+		panic("gofs: Chunks size must be positive")
+	}
+	return func(yield func([]byte, error) bool) {
+		buf := make([]byte, size)
+		for {
+			n, err := io.ReadFull(f.F, buf)
+			if n > 0 && !yield(buf[:n], nil) {
+				return
+			}
+			if err != nil {
+				if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+					yield(nil, err)
+				}
+				return
+			}
+		}
+	}
+}
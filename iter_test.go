@@ -0,0 +1,265 @@
+package gofs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/absfs/memfs"
+)
+
+// handleCountingFS tracks the number of files opened through it that have
+// not yet been closed.
+type handleCountingFS struct {
+	fs.FS
+
+	mu   sync.Mutex
+	open int
+}
+
+func (h *handleCountingFS) Open(name string) (fs.File, error) {
+	f, err := h.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	h.mu.Lock()
+	h.open++
+	h.mu.Unlock()
+	return &countedFile{ReadDirFile: f.(fs.ReadDirFile), fsys: h}, nil
+}
+
+// openCount returns the number of files currently open.
+func (h *handleCountingFS) openCount() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.open
+}
+
+type countedFile struct {
+	fs.ReadDirFile
+	fsys *handleCountingFS
+}
+
+func (c *countedFile) Close() error {
+	c.fsys.mu.Lock()
+	c.fsys.open--
+	c.fsys.mu.Unlock()
+	return c.ReadDirFile.Close()
+}
+
+func TestFileSystem_Entries(t *testing.T) {
+	mfs, err := memfs.NewFS()
+	if err != nil {
+		t.Fatalf("Failed to create memfs: %v", err)
+	}
+	if err := mfs.Mkdir("big", 0755); err != nil {
+		t.Fatal(err)
+	}
+	// More entries than fit in a single page.
+	const n = entriesPageSize*2 + 5
+	var want []string
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("f%03d", i)
+		want = append(want, name)
+		if err := writeFile(mfs, "big/"+name, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gfs, _ := NewFs(mfs)
+
+	t.Run("all entries", func(t *testing.T) {
+		var got []string
+		for entry, err := range gfs.Entries("big") {
+			if err != nil {
+				t.Fatalf("Entries() yielded error: %v", err)
+			}
+			got = append(got, entry.Name())
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Entries() yielded %d entries, want %d", len(got), len(want))
+		}
+	})
+
+	t.Run("early break", func(t *testing.T) {
+		count := 0
+		for _, err := range gfs.Entries("big") {
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count++; count == 3 {
+				break
+			}
+		}
+		if count != 3 {
+			t.Errorf("loop ran %d times, want 3", count)
+		}
+	})
+
+	t.Run("missing directory", func(t *testing.T) {
+		var errs int
+		for entry, err := range gfs.Entries("missing") {
+			if err == nil || entry != nil {
+				t.Errorf("Entries() yielded %v, %v; want nil entry and error", entry, err)
+			}
+			errs++
+		}
+		if errs != 1 {
+			t.Errorf("Entries() yielded %d errors, want 1", errs)
+		}
+	})
+}
+
+func TestWalk(t *testing.T) {
+	gfs := setupWalkFS(t, 2, 2)
+
+	t.Run("visits every path", func(t *testing.T) {
+		var got []string
+		for name := range Walk(gfs, "root") {
+			got = append(got, name)
+		}
+		want := collectWalk(t, gfs, "root", func(string, fs.DirEntry, error) error { return nil })
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Walk() =\n%v\nwant\n%v", got, want)
+		}
+	})
+
+	t.Run("parents before children", func(t *testing.T) {
+		seen := map[string]bool{}
+		for name, d := range Walk(gfs, "root") {
+			if name != "root" {
+				parent := name[:strings.LastIndex(name, "/")]
+				if !seen[parent] {
+					t.Errorf("Walk() yielded %q before its parent", name)
+				}
+			}
+			if d.IsDir() {
+				seen[name] = true
+			}
+		}
+	})
+
+	t.Run("early break closes handles", func(t *testing.T) {
+		h := &handleCountingFS{FS: gfs}
+		for name := range Walk(h, "root") {
+			if strings.Count(name, "/") == 3 {
+				// Deepest level: a handle is open for each of the three
+				// ancestor directories.
+				if h.openCount() != 3 {
+					t.Errorf("open handles at %q = %d, want 3", name, h.openCount())
+				}
+				break
+			}
+		}
+		if open := h.openCount(); open != 0 {
+			t.Errorf("open handles after break = %d, want 0", open)
+		}
+	})
+
+	t.Run("complete walk closes handles", func(t *testing.T) {
+		h := &handleCountingFS{FS: gfs}
+		for range Walk(h, "root") {
+		}
+		if open := h.openCount(); open != 0 {
+			t.Errorf("open handles after walk = %d, want 0", open)
+		}
+	})
+
+	t.Run("file root", func(t *testing.T) {
+		var got []string
+		for name := range Walk(gfs, "root/file.txt") {
+			got = append(got, name)
+		}
+		if !reflect.DeepEqual(got, []string{"root/file.txt"}) {
+			t.Errorf("Walk() = %v, want [root/file.txt]", got)
+		}
+	})
+
+	t.Run("missing root", func(t *testing.T) {
+		for name := range Walk(gfs, "missing") {
+			t.Errorf("Walk() yielded %q for missing root", name)
+		}
+	})
+}
+
+func TestFile_Lines(t *testing.T) {
+	mfs, _ := memfs.NewFS()
+	long := strings.Repeat("x", 100000)
+	content := "first\r\nsecond\n\n" + long + "\nlast"
+	if err := writeFile(mfs, "lines.txt", []byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	gfs, _ := NewFs(mfs)
+
+	f, err := gfs.Open("lines.txt")
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	defer f.Close()
+
+	var got []string
+	for line, err := range f.(File).Lines() {
+		if err != nil {
+			t.Fatalf("Lines() yielded error: %v", err)
+		}
+		got = append(got, line)
+	}
+	want := []string{"first", "second", "", long, "last"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Lines() yielded %d lines, want %d", len(got), len(want))
+	}
+}
+
+func TestFile_Chunks(t *testing.T) {
+	gfs := setupTestFS(t)
+
+	t.Run("chunks", func(t *testing.T) {
+		f, err := gfs.Open("testfile.txt")
+		if err != nil {
+			t.Fatalf("Open() failed: %v", err)
+		}
+		defer f.Close()
+
+		var got []string
+		for chunk, err := range f.(File).Chunks(5) {
+			if err != nil {
+				t.Fatalf("Chunks() yielded error: %v", err)
+			}
+			got = append(got, string(chunk))
+		}
+		want := []string{"Hello", ", Wor", "ld!"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Chunks(5) = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("read error", func(t *testing.T) {
+		f, err := gfs.Open("testdir")
+		if err != nil {
+			t.Fatalf("Open() failed: %v", err)
+		}
+		defer f.Close()
+
+		var gotErr error
+		for _, err := range f.(File).Chunks(5) {
+			gotErr = err
+		}
+		if gotErr == nil || errors.Is(gotErr, fs.ErrNotExist) {
+			t.Errorf("Chunks() on directory yielded error %v, want read error", gotErr)
+		}
+	})
+
+	t.Run("invalid size", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Error("Chunks(0) did not panic")
+			}
+		}()
+		File{}.Chunks(0)
+	})
+}
@@ -0,0 +1,311 @@
+package gofs
+
+import (
+	"fmt"
+	"io/fs"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Lint rule names, as reported in LintIssue.Rule.
+const (
+	LintCaseCollision    = "case-collision"
+	LintUnicodeCollision = "unicode-collision"
+	LintReservedName     = "reserved-name"
+	LintTrailingDotSpace = "trailing-dot-space"
+	LintForbiddenChar    = "forbidden-char"
+	LintLongPath         = "long-path"
+	LintInvalidUTF8      = "invalid-utf8"
+)
+
+// DefaultMaxPathLength is the longest path, in UTF-16 code units, that
+// Lint accepts by default: the Windows MAX_PATH of 260 less room for a
+// drive, separator and terminator.
+const DefaultMaxPathLength = 260 - len(`C:\`) - 1
+
+// LintRules selects the checks made by Lint. A nil *LintRules enables them
+// all with the default limits.
+type LintRules struct {
+	// CaseCollisions reports names in one directory that differ only in
+	// case, which collide on case-insensitive file systems such as the
+	// Windows and macOS defaults.
+	CaseCollisions bool
+
+	// UnicodeCollisions reports names in one directory that differ only in
+	// Unicode normalization, such as "é" written as one code point (NFC) or
+	// as "e" and a combining accent (NFD), which collide on file systems
+	// that normalize names, such as macOS's. Names are compared using the
+	// Unicode 14.0.0 canonical decompositions.
+	UnicodeCollisions bool
+
+	// ReservedNames reports the device names Windows reserves in every
+	// directory, such as CON, NUL and COM1, with or without an extension.
+	ReservedNames bool
+
+	// TrailingDotsSpaces reports names ending in a dot or space, which
+	// Windows strips.
+	TrailingDotsSpaces bool
+
+	// ForbiddenChars reports names containing characters Windows does not
+	// allow: control characters and < > : " \ | ? *.
+	ForbiddenChars bool
+
+	// MaxPathLength, if positive, reports paths relative to the linted
+	// root longer than this many UTF-16 code units.
+	MaxPathLength int
+
+	// InvalidUTF8 reports names that are not valid UTF-8, which cannot be
+	// represented on Windows or macOS.
+	InvalidUTF8 bool
+}
+
+// DefaultLintRules returns LintRules with every check enabled and
+// MaxPathLength set to DefaultMaxPathLength.
+func DefaultLintRules() *LintRules {
+	return &LintRules{
+		CaseCollisions:     true,
+		UnicodeCollisions:  true,
+		ReservedNames:      true,
+		TrailingDotsSpaces: true,
+		ForbiddenChars:     true,
+		MaxPathLength:      DefaultMaxPathLength,
+		InvalidUTF8:        true,
+	}
+}
+
+// LintIssue is a portability problem found by Lint.
+type LintIssue struct {
+	// Path is the offending file, relative to the linted root.
+	Path string `json:"path"`
+
+	// Rule is the name of the failed check, such as LintReservedName.
+	Rule string `json:"rule"`
+
+	// Message describes the problem.
+	Message string `json:"message"`
+
+	// Other is the file Path collides with, for collision rules.
+	Other string `json:"other,omitempty"`
+}
+
+// Lint checks the names of every file and directory below root in fsys for
+// problems that would break the tree on other operating systems, returning
+// the issues found sorted by path. Collisions are reported once, on the
+// later of the two names. An error is returned only if the tree cannot be
+// read.
+func Lint(fsys fs.FS, root string, rules *LintRules) ([]LintIssue, error) {
+	if rules == nil {
+		rules = DefaultLintRules()
+	}
+	l := &linter{fsys: fsys, rules: rules}
+	if err := l.dir(root, "."); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(l.issues, func(i, j int) bool { return l.issues[i].Path < l.issues[j].Path })
+	return l.issues, nil
+}
+
+type linter struct {
+	fsys   fs.FS
+	rules  *LintRules
+	issues []LintIssue
+}
+
+func (l *linter) report(p, rule, msg, other string) {
+	l.issues = append(l.issues, LintIssue{Path: p, Rule: rule, Message: msg, Other: other})
+}
+
+// dir lints the entries of the directory name, whose path relative to the
+// root is rel.
+func (l *linter) dir(name, rel string) error {
+	entries, err := fs.ReadDir(l.fsys, name)
+	if err != nil {
+		return err
+	}
+	byNorm := make(map[string]string, len(entries))
+	byCase := make(map[string]string, len(entries))
+	for _, e := range entries {
+		p := joinName(rel, e.Name())
+		l.name(p, e.Name())
+
+		norm := decomposeName(e.Name())
+		folded := norm
+		if utf8.ValidString(norm) {
+			folded = foldName(norm)
+		}
+		if other, ok := byNorm[norm]; ok && l.rules.UnicodeCollisions {
+			l.report(p, LintUnicodeCollision, "differs from "+other+" only in Unicode normalization", joinName(rel, other))
+		} else if other, ok := byCase[folded]; ok && l.rules.CaseCollisions {
+			l.report(p, LintCaseCollision, "differs from "+other+" only in case", joinName(rel, other))
+		}
+		if _, ok := byNorm[norm]; !ok {
+			byNorm[norm] = e.Name()
+		}
+		if _, ok := byCase[folded]; !ok {
+			byCase[folded] = e.Name()
+		}
+
+		if e.IsDir() {
+			if err := l.dir(joinName(name, e.Name()), p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// windowsReserved lists the device names Windows reserves.
+// Windows also treats the superscript digits ¹, ² and ³ as port numbers.
+var windowsReserved = []string{
+	"CON", "PRN", "AUX", "NUL", "CONIN$", "CONOUT$",
+	"COM0", "COM1", "COM2", "COM3", "COM4", "COM5", "COM6", "COM7", "COM8", "COM9",
+	"COM¹", "COM²", "COM³",
+	"LPT0", "LPT1", "LPT2", "LPT3", "LPT4", "LPT5", "LPT6", "LPT7", "LPT8", "LPT9",
+	"LPT¹", "LPT²", "LPT³",
+}
+
+// name lints a single name, whose path relative to the root is p.
+func (l *linter) name(p, name string) {
+	r := l.rules
+	if r.InvalidUTF8 && !utf8.ValidString(name) {
+		l.report(p, LintInvalidUTF8, "name is not valid UTF-8", "")
+	}
+	if r.ReservedNames {
+		stem, _, _ := strings.Cut(name, ".")
+		stem = strings.TrimRight(stem, " ")
+		if i := slices.IndexFunc(windowsReserved, func(s string) bool { return strings.EqualFold(s, stem) }); i >= 0 {
+			l.report(p, LintReservedName, windowsReserved[i]+" is a reserved device name on Windows", "")
+		}
+	}
+	if r.TrailingDotsSpaces && (strings.HasSuffix(name, ".") || strings.HasSuffix(name, " ")) {
+		l.report(p, LintTrailingDotSpace, "name ends with a dot or space", "")
+	}
+	if r.ForbiddenChars {
+		if i := strings.IndexFunc(name, func(c rune) bool { return c < 0x20 || strings.ContainsRune(`<>:"\|?*`, c) }); i >= 0 {
+			c, _ := utf8.DecodeRuneInString(name[i:])
+			l.report(p, LintForbiddenChar, fmt.Sprintf("name contains %q, which Windows forbids", c), "")
+		}
+	}
+	if r.MaxPathLength > 0 {
+		if n := len(utf16.Encode([]rune(p))); n > r.MaxPathLength {
+			l.report(p, LintLongPath, fmt.Sprintf("path is %d UTF-16 code units long, more than %d", n, r.MaxPathLength), "")
+		}
+	}
+}
+
+//go:generate go run mknorm.go -version 14.0.0
+
+// Hangul syllables decompose algorithmically rather than through
+// canonicalDecompositions; see the Unicode Standard, section 3.12.
+const (
+	hangulBase   = 0xAC00
+	hangulLBase  = 0x1100
+	hangulVBase  = 0x1161
+	hangulTBase  = 0x11A7
+	hangulTCount = 28
+	hangulNCount = 21 * hangulTCount
+	hangulCount  = 19 * hangulNCount
+)
+
+// decomposition gives the full canonical decomposition of a rune.
+type decomposition struct {
+	r rune
+	d string
+}
+
+// canonicalDecomposition returns the full canonical decomposition of r, if
+// it has one other than the algorithmic one of the Hangul syllables.
+func canonicalDecomposition(r rune) (string, bool) {
+	i := sort.Search(len(canonicalDecompositions), func(i int) bool { return canonicalDecompositions[i].r >= r })
+	if i < len(canonicalDecompositions) && canonicalDecompositions[i].r == r {
+		return canonicalDecompositions[i].d, true
+	}
+	return "", false
+}
+
+// combiningRange gives the canonical combining class of the runes lo
+// through hi.
+type combiningRange struct {
+	lo, hi rune
+	class  uint8
+}
+
+// combiningClass returns the canonical combining class of r.
+func combiningClass(r rune) uint8 {
+	i := sort.Search(len(combiningClasses), func(i int) bool { return combiningClasses[i].hi >= r })
+	if i < len(combiningClasses) && combiningClasses[i].lo <= r {
+		return combiningClasses[i].class
+	}
+	return 0
+}
+
+// decomposeName returns the canonical decomposition (NFD) of name, so that
+// names that are canonically equivalent decompose identically. Invalid
+// UTF-8 is kept as it is.
+func decomposeName(name string) string {
+	if isASCII(name) {
+		return name
+	}
+	var out []rune
+	for i := 0; i < len(name); {
+		r, size := utf8.DecodeRuneInString(name[i:])
+		if r == utf8.RuneError && size == 1 {
+			// Keep the invalid byte distinct from a real U+FFFD.
+			out = append(out, rune(0x110000+int(name[i])))
+			i++
+			continue
+		}
+		i += size
+		switch s := r - hangulBase; {
+		case s >= 0 && s < hangulCount:
+			out = append(out, hangulLBase+s/hangulNCount, hangulVBase+s%hangulNCount/hangulTCount)
+			if t := s % hangulTCount; t != 0 {
+				out = append(out, hangulTBase+t)
+			}
+		default:
+			if d, ok := canonicalDecomposition(r); ok {
+				out = append(out, []rune(d)...)
+			} else {
+				out = append(out, r)
+			}
+		}
+	}
+
+	// Put each run of combining marks in canonical order.
+	for i := 0; i < len(out); {
+		if combiningClass(out[i]) == 0 {
+			i++
+			continue
+		}
+		j := i
+		for j < len(out) && combiningClass(out[j]) != 0 {
+			j++
+		}
+		slices.SortStableFunc(out[i:j], func(a, b rune) int {
+			return int(combiningClass(a)) - int(combiningClass(b))
+		})
+		i = j
+	}
+
+	var b strings.Builder
+	for _, r := range out {
+		if r >= 0x110000 {
+			b.WriteByte(byte(r - 0x110000))
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,119 @@
+package gofs
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLint(t *testing.T) {
+	const (
+		nfc      = "caf\u00e9.txt"
+		nfd      = "cafe\u0301.txt"
+		upperNFD = "CAFE\u0301.TXT"
+	)
+	long := "deep/" + strings.Repeat("d", 300)
+	file := &fstest.MapFile{Data: []byte("x")}
+	fsys := fstest.MapFS{
+		"docs/Readme.md":   file,
+		"docs/README.md":   file,
+		"docs/" + nfc:      file,
+		"docs/" + nfd:      file,
+		"docs/" + upperNFD: file,
+		"src/con.go":       file,
+		"src/Aux":          file,
+		"src/console.go":   file,
+		"src/notes.":       file,
+		"src/draft ":       file,
+		"src/a:b.txt":      file,
+		"src/tab\there":    file,
+		"src/bad\xffname":  file,
+		"src/ok.go":        file,
+		long:               file,
+	}
+
+	issues, err := Lint(fsys, ".", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, is := range issues {
+		got = append(got, is.Path+" "+is.Rule+" "+is.Other)
+	}
+	want := []string{
+		long + " long-path ",
+		"docs/Readme.md case-collision docs/README.md",
+		"docs/" + nfd + " case-collision docs/" + upperNFD,
+		"docs/" + nfc + " unicode-collision docs/" + nfd,
+		"src/Aux reserved-name ",
+		"src/a:b.txt forbidden-char ",
+		"src/bad\xffname invalid-utf8 ",
+		"src/con.go reserved-name ",
+		"src/draft  trailing-dot-space ",
+		"src/notes. trailing-dot-space ",
+		"src/tab\there forbidden-char ",
+	}
+	slices.Sort(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Lint issues:\n%q\nwant:\n%q", got, want)
+	}
+
+	issues, err = Lint(fsys, "src", &LintRules{ReservedNames: true})
+	if err != nil || len(issues) != 2 || issues[0].Path != "Aux" || issues[1].Path != "con.go" {
+		t.Errorf("Lint(src, reserved names only) = %+v, %v", issues, err)
+	}
+	if _, err := Lint(fsys, "missing", nil); err == nil {
+		t.Error("Lint of a missing root succeeded")
+	}
+}
+
+func TestLint_ReservedNames(t *testing.T) {
+	file := &fstest.MapFile{Data: []byte("x")}
+	fsys := fstest.MapFS{}
+	reserved := []string{"COM0", "lpt0.txt", "COM\u00b9", "lpt\u00b2.log", "LPT\u00b3", "CONIN$", "conout$.txt"}
+	for _, name := range append(reserved, "COM10", "LPT\u2074", "CONIN") {
+		fsys[name] = file
+	}
+	issues, err := Lint(fsys, ".", &LintRules{ReservedNames: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, is := range issues {
+		got = append(got, is.Path)
+	}
+	slices.Sort(got)
+	slices.Sort(reserved)
+	if !reflect.DeepEqual(got, reserved) {
+		t.Errorf("reserved names = %q, want %q", got, reserved)
+	}
+}
+
+func TestDecomposeName(t *testing.T) {
+	for in, want := range map[string]string{
+		"plain":         "plain",
+		"\u00e9":        "e\u0301",
+		"\u1e69":        "s\u0323\u0307", // dot below sorts before dot above
+		"s\u0307\u0323": "s\u0323\u0307",
+		"\ud55c":        "\u1112\u1161\u11ab", // Hangul syllable
+		"\u212b":        "A\u030a",            // angstrom sign
+		"\U0002fa1d":    "\U0002a600",         // last table entry
+		"bad\xff":       "bad\xff",
+		"\ufffd":        "\ufffd",
+	} {
+		if got := decomposeName(in); got != want {
+			t.Errorf("decomposeName(%+q) = %+q, want %+q", in, got, want)
+		}
+	}
+}
+
+func TestNormTablesSorted(t *testing.T) {
+	if !slices.IsSortedFunc(canonicalDecompositions, func(a, b decomposition) int { return int(a.r - b.r) }) {
+		t.Error("canonicalDecompositions is not sorted")
+	}
+	if !slices.IsSortedFunc(combiningClasses, func(a, b combiningRange) int { return int(a.lo - b.lo) }) {
+		t.Error("combiningClasses is not sorted")
+	}
+}
@@ -0,0 +1,193 @@
+package gofs
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Report describes the outcome of VerifyManifest. Every list is sorted and
+// holds cleaned, slash-separated paths relative to the verified filesystem.
+type Report struct {
+	// Matched lists files whose contents match their manifest checksum.
+	Matched []string
+
+	// Mismatched lists files whose contents differ from their manifest checksum.
+	Mismatched []string
+
+	// Missing lists files named in the manifest that do not exist.
+	Missing []string
+
+	// Extra lists regular files in the filesystem that the manifest does not name.
+	Extra []string
+}
+
+// OK reports whether every file in the manifest matched and the filesystem
+// holds no files beyond those listed.
+func (r Report) OK() bool {
+	return len(r.Mismatched) == 0 && len(r.Missing) == 0 && len(r.Extra) == 0
+}
+
+// WriteManifest writes a SHA-256 checksum for every regular file below dir to
+// w, in the format produced by the coreutils sha256sum command. Paths are
+// written relative to dir in lexical order, so the output matches running
+// "sha256sum" from inside dir and can be verified with "sha256sum --check".
+// Names containing a backslash, newline or carriage return are escaped the
+// same way sha256sum escapes them.
+func WriteManifest(w io.Writer, fsys fs.FS, dir string) error {
+	tree, err := TreeDigest(fsys, dir, crypto.SHA256)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(tree.Files))
+	for name := range tree.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		rel := name
+		if dir != "." {
+			rel = strings.TrimPrefix(name, dir+"/")
+		}
+		prefix, escaped := escapeManifestName(rel)
+		fmt.Fprintf(bw, "%s%x  %s\n", prefix, tree.Files[name], escaped)
+	}
+	return bw.Flush()
+}
+
+// VerifyManifest checks the regular files in fsys against a manifest in the
+// coreutils sha256sum format, such as one written by WriteManifest. Paths in
+// the manifest are resolved relative to the root of fsys; use fs.Sub to verify
+// a manifest that was written for a subdirectory.
+//
+// A non-nil error is returned only when the manifest is malformed or fsys
+// cannot be read; checksum mismatches and missing or extra files are recorded
+// in the Report.
+func VerifyManifest(fsys fs.FS, manifest io.Reader) (Report, error) {
+	var report Report
+
+	expected := make(map[string][]byte)
+	scanner := bufio.NewScanner(manifest)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		name, sum, err := parseManifestLine(text)
+		if err != nil {
+			return report, fmt.Errorf("manifest line %d: %w", line, err)
+		}
+		expected[path.Clean(name)] = sum
+	}
+	if err := scanner.Err(); err != nil {
+		return report, err
+	}
+
+	// Only the listed files are hashed; the walk merely finds the extras.
+	var listed []*treeNode
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		if _, ok := expected[name]; ok {
+			listed = append(listed, &treeNode{path: name, name: d.Name()})
+		} else {
+			report.Extra = append(report.Extra, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+	if err := hashFiles(fsys, listed, crypto.SHA256); err != nil {
+		return report, err
+	}
+	for _, n := range listed {
+		if bytes.Equal(n.digest, expected[n.path]) {
+			report.Matched = append(report.Matched, n.path)
+		} else {
+			report.Mismatched = append(report.Mismatched, n.path)
+		}
+		delete(expected, n.path)
+	}
+	for name := range expected {
+		report.Missing = append(report.Missing, name)
+	}
+
+	sort.Strings(report.Matched)
+	sort.Strings(report.Mismatched)
+	sort.Strings(report.Missing)
+	sort.Strings(report.Extra)
+	return report, nil
+}
+
+// parseManifestLine parses a single "<hex>  <name>" or "<hex> *<name>" line.
+func parseManifestLine(line string) (name string, sum []byte, err error) {
+	escaped := strings.HasPrefix(line, "\\")
+	if escaped {
+		line = line[1:]
+	}
+
+	hexSum, rest, ok := strings.Cut(line, " ")
+	if !ok || len(rest) < 2 || (rest[0] != ' ' && rest[0] != '*') {
+		return "", nil, fmt.Errorf("improperly formatted checksum line %q", line)
+	}
+	sum, err = hex.DecodeString(hexSum)
+	if err != nil || len(sum) != crypto.SHA256.Size() {
+		return "", nil, fmt.Errorf("invalid SHA-256 checksum %q", hexSum)
+	}
+
+	name = rest[1:]
+	if escaped {
+		name, err = unescapeManifestName(name)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	return name, sum, nil
+}
+
+// escapeManifestName applies sha256sum's filename escaping. It returns the
+// line prefix ("\" when escaping was needed) and the escaped name.
+func escapeManifestName(name string) (prefix, escaped string) {
+	if !strings.ContainsAny(name, "\\\n\r") {
+		return "", name
+	}
+	r := strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\r", "\\r")
+	return "\\", r.Replace(name)
+}
+
+func unescapeManifestName(name string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] != '\\' {
+			b.WriteByte(name[i])
+			continue
+		}
+		i++
+		if i == len(name) {
+			return "", fmt.Errorf("invalid escape at end of name %q", name)
+		}
+		switch name[i] {
+		case '\\':
+			b.WriteByte('\\')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		default:
+			return "", fmt.Errorf("invalid escape \\%c in name %q", name[i], name)
+		}
+	}
+	return b.String(), nil
+}
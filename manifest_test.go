@@ -0,0 +1,206 @@
+package gofs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// openLogFS records the names opened through it.
+type openLogFS struct {
+	fs.FS
+	opened []string
+}
+
+func (o *openLogFS) Open(name string) (fs.File, error) {
+	o.opened = append(o.opened, name)
+	return o.FS.Open(name)
+}
+
+func TestWriteManifest(t *testing.T) {
+	_, gfs := setupTreeFS(t)
+
+	t.Run("whole tree", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := WriteManifest(&buf, gfs, "."); err != nil {
+			t.Fatalf("WriteManifest() failed: %v", err)
+		}
+
+		var want strings.Builder
+		for _, f := range []struct{ name, content string }{
+			{"a/one.txt", "one"},
+			{"a/x/deep", "deep"},
+			{"b/two.txt", "two"},
+			{"root.txt", "root"},
+		} {
+			fmt.Fprintf(&want, "%x  %s\n", sha256.Sum256([]byte(f.content)), f.name)
+		}
+		if buf.String() != want.String() {
+			t.Errorf("WriteManifest() =\n%s\nwant\n%s", buf.String(), want.String())
+		}
+	})
+
+	t.Run("relative to subdirectory", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := WriteManifest(&buf, gfs, "a"); err != nil {
+			t.Fatalf("WriteManifest() failed: %v", err)
+		}
+		want := fmt.Sprintf("%x  one.txt\n%x  x/deep\n",
+			sha256.Sum256([]byte("one")), sha256.Sum256([]byte("deep")))
+		if buf.String() != want {
+			t.Errorf("WriteManifest() =\n%s\nwant\n%s", buf.String(), want)
+		}
+	})
+}
+
+func TestVerifyManifest(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		_, gfs := setupTreeFS(t)
+		var buf bytes.Buffer
+		if err := WriteManifest(&buf, gfs, "."); err != nil {
+			t.Fatalf("WriteManifest() failed: %v", err)
+		}
+		report, err := VerifyManifest(gfs, &buf)
+		if err != nil {
+			t.Fatalf("VerifyManifest() failed: %v", err)
+		}
+		if !report.OK() {
+			t.Errorf("VerifyManifest() report not OK: %+v", report)
+		}
+		if len(report.Matched) != 4 {
+			t.Errorf("VerifyManifest() matched %d files, want 4", len(report.Matched))
+		}
+	})
+
+	t.Run("mismatched missing and extra", func(t *testing.T) {
+		mfs, gfs := setupTreeFS(t)
+		var buf bytes.Buffer
+		if err := WriteManifest(&buf, gfs, "."); err != nil {
+			t.Fatalf("WriteManifest() failed: %v", err)
+		}
+		if err := writeFile(mfs, "a/one.txt", []byte("uno")); err != nil {
+			t.Fatal(err)
+		}
+		if err := mfs.Remove("b/two.txt"); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeFile(mfs, "new.txt", []byte("new")); err != nil {
+			t.Fatal(err)
+		}
+
+		report, err := VerifyManifest(gfs, &buf)
+		if err != nil {
+			t.Fatalf("VerifyManifest() failed: %v", err)
+		}
+		want := Report{
+			Matched:    []string{"a/x/deep", "root.txt"},
+			Mismatched: []string{"a/one.txt"},
+			Missing:    []string{"b/two.txt"},
+			Extra:      []string{"new.txt"},
+		}
+		if !reflect.DeepEqual(report, want) {
+			t.Errorf("VerifyManifest() = %+v, want %+v", report, want)
+		}
+		if report.OK() {
+			t.Error("Report.OK() = true, want false")
+		}
+	})
+
+	t.Run("subdirectory via fs.Sub", func(t *testing.T) {
+		_, gfs := setupTreeFS(t)
+		var buf bytes.Buffer
+		if err := WriteManifest(&buf, gfs, "a"); err != nil {
+			t.Fatalf("WriteManifest() failed: %v", err)
+		}
+		sub, err := fs.Sub(gfs, "a")
+		if err != nil {
+			t.Fatalf("fs.Sub() failed: %v", err)
+		}
+		report, err := VerifyManifest(sub, &buf)
+		if err != nil {
+			t.Fatalf("VerifyManifest() failed: %v", err)
+		}
+		if !report.OK() {
+			t.Errorf("VerifyManifest() report not OK: %+v", report)
+		}
+	})
+
+	t.Run("binary marker and blank lines", func(t *testing.T) {
+		_, gfs := setupTreeFS(t)
+		manifest := fmt.Sprintf("\n%x *root.txt\n\n", sha256.Sum256([]byte("root")))
+		report, err := VerifyManifest(gfs, strings.NewReader(manifest))
+		if err != nil {
+			t.Fatalf("VerifyManifest() failed: %v", err)
+		}
+		if !reflect.DeepEqual(report.Matched, []string{"root.txt"}) {
+			t.Errorf("Matched = %v, want [root.txt]", report.Matched)
+		}
+	})
+
+	t.Run("unlisted files are not read", func(t *testing.T) {
+		fsys := &openLogFS{FS: fstest.MapFS{
+			"listed.txt":   {Data: []byte("listed")},
+			"unlisted.bin": {Data: []byte("unlisted")},
+		}}
+		manifest := fmt.Sprintf("%x  listed.txt\n", sha256.Sum256([]byte("listed")))
+		report, err := VerifyManifest(fsys, strings.NewReader(manifest))
+		if err != nil {
+			t.Fatalf("VerifyManifest() failed: %v", err)
+		}
+		want := Report{Matched: []string{"listed.txt"}, Extra: []string{"unlisted.bin"}}
+		if !reflect.DeepEqual(report, want) {
+			t.Errorf("VerifyManifest() = %+v, want %+v", report, want)
+		}
+		if slices.Contains(fsys.opened, "unlisted.bin") {
+			t.Error("VerifyManifest() opened the unlisted file")
+		}
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		_, gfs := setupTreeFS(t)
+		for _, manifest := range []string{
+			"not a checksum line\n",
+			"abcd  short.txt\n",
+			fmt.Sprintf("%x root.txt\n", sha256.Sum256(nil)),
+			fmt.Sprintf("\\%x  bad\\qescape\n", sha256.Sum256(nil)),
+		} {
+			if _, err := VerifyManifest(gfs, strings.NewReader(manifest)); err == nil {
+				t.Errorf("VerifyManifest(%q) should return error", manifest)
+			}
+		}
+	})
+}
+
+func TestManifestNameEscaping(t *testing.T) {
+	tests := []struct {
+		name, prefix, escaped string
+	}{
+		{"plain.txt", "", "plain.txt"},
+		{"back\\slash", "\\", "back\\\\slash"},
+		{"new\nline", "\\", "new\\nline"},
+		{"carriage\rreturn", "\\", "carriage\\rreturn"},
+	}
+	for _, tt := range tests {
+		prefix, escaped := escapeManifestName(tt.name)
+		if prefix != tt.prefix || escaped != tt.escaped {
+			t.Errorf("escapeManifestName(%q) = %q, %q, want %q, %q",
+				tt.name, prefix, escaped, tt.prefix, tt.escaped)
+		}
+
+		line := fmt.Sprintf("%s%x  %s", prefix, sha256.Sum256(nil), escaped)
+		name, _, err := parseManifestLine(line)
+		if err != nil {
+			t.Errorf("parseManifestLine(%q) failed: %v", line, err)
+			continue
+		}
+		if name != tt.name {
+			t.Errorf("parseManifestLine(%q) name = %q, want %q", line, name, tt.name)
+		}
+	}
+}
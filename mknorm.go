@@ -0,0 +1,155 @@
+//go:build ignore
+
+// mknorm generates normtables.go, the canonical decomposition and combining
+// class tables used by Lint to compare names under Unicode normalization,
+// from the Unicode Character Database's UnicodeData.txt for the given
+// Unicode version:
+//
+//	go run mknorm.go -version 14.0.0 [UnicodeData.txt]
+//
+// Without a file argument the data is downloaded from unicode.org. The
+// version is recorded in the generated file, so a file given on the command
+// line must be the UnicodeData.txt of that version.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var version = flag.String("version", "", "Unicode version of the data, such as 14.0.0")
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("mknorm: ")
+	flag.Parse()
+	if *version == "" || flag.NArg() > 1 {
+		log.Fatal("usage: go run mknorm.go -version X.Y.Z [UnicodeData.txt]")
+	}
+	var r io.Reader
+	if flag.NArg() == 1 {
+		f, err := os.Open(flag.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		r = f
+	} else {
+		url := "https://www.unicode.org/Public/" + *version + "/ucd/UnicodeData.txt"
+		resp, err := http.Get(url)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			log.Fatalf("%s: %s", url, resp.Status)
+		}
+		r = resp.Body
+	}
+
+	decomp := make(map[rune][]rune)
+	ccc := make(map[rune]uint8)
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		fields := strings.Split(sc.Text(), ";")
+		if len(fields) < 6 {
+			continue
+		}
+		r := parseRune(fields[0])
+		if c, _ := strconv.Atoi(fields[3]); c != 0 {
+			ccc[r] = uint8(c)
+		}
+		// Compatibility decompositions are tagged, as in "<font> 0041".
+		if fields[5] == "" || strings.HasPrefix(fields[5], "<") {
+			continue
+		}
+		for _, s := range strings.Fields(fields[5]) {
+			decomp[r] = append(decomp[r], parseRune(s))
+		}
+	}
+	if err := sc.Err(); err != nil {
+		log.Fatal(err)
+	}
+
+	var full func(r rune) []rune
+	full = func(r rune) []rune {
+		d, ok := decomp[r]
+		if !ok {
+			return []rune{r}
+		}
+		var out []rune
+		for _, c := range d {
+			out = append(out, full(c)...)
+		}
+		return out
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by mknorm.go; DO NOT EDIT.\n\npackage gofs\n\n")
+	fmt.Fprintf(&buf, "// normUnicodeVersion is the version of the Unicode Character Database\n")
+	fmt.Fprintf(&buf, "// from which these tables were generated.\n")
+	fmt.Fprintf(&buf, "const normUnicodeVersion = %q\n\n", *version)
+	fmt.Fprintf(&buf, "// canonicalDecompositions lists each rune with a canonical decomposition,\n")
+	fmt.Fprintf(&buf, "// other than the Hangul syllables, with its full decomposition, sorted by\n")
+	fmt.Fprintf(&buf, "// rune.\n")
+	fmt.Fprintf(&buf, "var canonicalDecompositions = []decomposition{\n")
+	for i, r := range sortedKeys(decomp) {
+		sep := " "
+		if i%4 == 3 {
+			sep = "\n"
+		}
+		fmt.Fprintf(&buf, "{%#04x, %+q},%s", r, string(full(r)), sep)
+	}
+	fmt.Fprintf(&buf, "\n}\n\n")
+
+	// Combining classes are stored as ranges of consecutive runes sharing a
+	// class.
+	fmt.Fprintf(&buf, "// combiningClasses lists the runes with a non-zero canonical combining\n")
+	fmt.Fprintf(&buf, "// class, as sorted ranges of consecutive runes sharing a class.\n")
+	fmt.Fprintf(&buf, "var combiningClasses = []combiningRange{\n")
+	runes := sortedKeys(ccc)
+	for i := 0; i < len(runes); {
+		j := i + 1
+		for j < len(runes) && runes[j] == runes[j-1]+1 && ccc[runes[j]] == ccc[runes[i]] {
+			j++
+		}
+		fmt.Fprintf(&buf, "\t{%#04x, %#04x, %d},\n", runes[i], runes[j-1], ccc[runes[i]])
+		i = j
+	}
+	fmt.Fprintf(&buf, "}\n")
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile("normtables.go", src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func parseRune(s string) rune {
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		log.Fatalf("bad code point %q", s)
+	}
+	return rune(v)
+}
+
+func sortedKeys[V any](m map[rune]V) []rune {
+	keys := make([]rune, 0, len(m))
+	for r := range m {
+		keys = append(keys, r)
+	}
+	slices.Sort(keys)
+	return keys
+}
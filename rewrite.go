@@ -0,0 +1,395 @@
+package gofs
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// A PathMapper translates names between the view presented by a RewriteFS
+// and the filesystem it wraps. Names on both sides are io/fs names.
+type PathMapper interface {
+	// ToBackend returns the backend names that the view name may refer to,
+	// most preferred first. The first that exists, and that FromBackend
+	// maps back to the view name, is used.
+	ToBackend(name string) []string
+
+	// FromBackend returns the view name of the backend file name, a
+	// directory if isDir is set, or false to hide the file.
+	FromBackend(name string, isDir bool) (string, bool)
+}
+
+// A MountMapper is a PathMapper that moves backend directories to view
+// directories elsewhere in the tree. Mounts returns those view directories,
+// so that RewriteFS can list them in their parents and synthesize their
+// parents if they do not exist.
+type MountMapper interface {
+	PathMapper
+	Mounts() []string
+}
+
+// RewriteFS is a read-only view of an fs.FS whose names are translated by a
+// PathMapper. It implements fs.FS, fs.StatFS, fs.ReadDirFS and
+// fs.ReadFileFS.
+//
+// Every name is mapped in both directions: a view name resolves to a
+// backend file only if the Mapper maps that file back to the same name, so
+// each file is reachable under exactly the name it is listed as, and backend
+// names moved elsewhere by the Mapper are hidden at their original place.
+// Directory listings are read from the backend directory and show the view
+// names of its entries that remain in that directory. Stat reports view
+// names, and directories are listed when they are opened.
+type RewriteFS struct {
+	// FS is the wrapped filesystem.
+	FS fs.FS
+
+	// Mapper translates names.
+	Mapper PathMapper
+}
+
+// Rewrite returns a RewriteFS over fsys that translates names with mapper.
+func Rewrite(fsys fs.FS, mapper PathMapper) *RewriteFS {
+	return &RewriteFS{FS: fsys, Mapper: mapper}
+}
+
+// resolve returns the backend name of name and its FileInfo, named as in
+// the view. If dirOnly is set, only directories are considered.
+func (r *RewriteFS) resolve(op, name string, dirOnly bool) (string, fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return "", nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	for _, under := range r.Mapper.ToBackend(name) {
+		if !fs.ValidPath(under) {
+			continue
+		}
+		info, err := fs.Stat(r.FS, under)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", nil, pathError(op, name, err)
+		}
+		if dirOnly && !info.IsDir() {
+			continue
+		}
+		if back, ok := r.Mapper.FromBackend(under, info.IsDir()); ok && back == name {
+			return under, renamedInfo(info, path.Base(name)), nil
+		}
+	}
+	if r.mountParent(name) {
+		return "", &frozenInfo{name: path.Base(name), mode: fs.ModeDir | 0555}, nil
+	}
+	return "", nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+}
+
+// mountParent reports whether name is a directory containing a mount point.
+func (r *RewriteFS) mountParent(name string) bool {
+	m, ok := r.Mapper.(MountMapper)
+	if !ok {
+		return false
+	}
+	for _, mount := range m.Mounts() {
+		if name == "." || strings.HasPrefix(mount, name+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// renamedInfo returns info under the name name.
+func renamedInfo(info fs.FileInfo, name string) fs.FileInfo {
+	if info.Name() == name {
+		return info
+	}
+	return &frozenInfo{name, info.Size(), info.Mode(), info.ModTime(), info.Sys()}
+}
+
+// dirInfos returns the FileInfos of the entries of the view directory
+// name, sorted by name.
+func (r *RewriteFS) dirInfos(op, name string) ([]fs.FileInfo, error) {
+	under, _, err := r.resolve(op, name, true)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]fs.FileInfo)
+	if under != "" {
+		entries, err := fs.ReadDir(r.FS, under)
+		if err != nil {
+			return nil, pathError(op, name, err)
+		}
+		for _, e := range entries {
+			v, ok := r.Mapper.FromBackend(joinName(under, e.Name()), e.IsDir())
+			if !ok || v == "." || path.Dir(v) != name {
+				continue
+			}
+			if _, dup := byName[v]; dup {
+				// Several backend files map to v; the one resolve chose is
+				// already listed.
+				continue
+			}
+			_, info, err := r.resolve(op, v, false)
+			if err != nil {
+				continue
+			}
+			byName[v] = info
+		}
+	}
+	if m, ok := r.Mapper.(MountMapper); ok {
+		for _, mount := range m.Mounts() {
+			// List the mount, or the directory leading to it, found in name.
+			for v := mount; v != "." && v != name; v = path.Dir(v) {
+				if path.Dir(v) != name || byName[v] != nil {
+					continue
+				}
+				if _, info, err := r.resolve(op, v, false); err == nil {
+					byName[v] = info
+				}
+			}
+		}
+	}
+	infos := make([]fs.FileInfo, 0, len(byName))
+	for _, info := range byName {
+		infos = append(infos, info)
+	}
+	slices.SortFunc(infos, func(a, b fs.FileInfo) int { return strings.Compare(a.Name(), b.Name()) })
+	return infos, nil
+}
+
+// Open opens the named file.
+func (r *RewriteFS) Open(name string) (fs.File, error) {
+	under, info, err := r.resolve("open", name, false)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		infos, err := r.dirInfos("open", name)
+		if err != nil {
+			return nil, err
+		}
+		return &infoDir{info: info, entries: infoEntries(infos)}, nil
+	}
+	f, err := r.FS.Open(under)
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+	return &renamedFile{File: f, info: info}, nil
+}
+
+// Stat returns the FileInfo of the named file.
+func (r *RewriteFS) Stat(name string) (fs.FileInfo, error) {
+	_, info, err := r.resolve("stat", name, false)
+	return info, err
+}
+
+// ReadDir reads the named directory, returning view names sorted by name.
+func (r *RewriteFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	infos, err := r.dirInfos("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	return infoEntries(infos), nil
+}
+
+// ReadFile reads the named file.
+func (r *RewriteFS) ReadFile(name string) ([]byte, error) {
+	under, info, err := r.resolve("readfile", name, false)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: errors.New("is a directory")}
+	}
+	data, err := fs.ReadFile(r.FS, under)
+	if err != nil {
+		return nil, pathError("readfile", name, err)
+	}
+	return data, nil
+}
+
+// renamedFile is an open file reported under another name, such as its
+// name in a RewriteFS.
+type renamedFile struct {
+	fs.File
+	info fs.FileInfo
+}
+
+func (f *renamedFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+// hasPathPrefix reports whether name is prefix or below it.
+func hasPathPrefix(name, prefix string) bool {
+	return prefix == "." || name == prefix || strings.HasPrefix(name, prefix+"/")
+}
+
+// replacePathPrefix replaces the leading prefix of name with repl.
+func replacePathPrefix(name, prefix, repl string) string {
+	rest := name
+	if prefix != "." {
+		rest = strings.TrimPrefix(strings.TrimPrefix(name, prefix), "/")
+	}
+	if rest == "" || rest == "." {
+		return repl
+	}
+	return joinName(repl, rest)
+}
+
+type prefixMapper struct{ view, backend string }
+
+// PrefixMapper returns a MountMapper that presents the backend directory
+// backend, and everything below it, at the view directory view, as
+// PrefixMapper("assets", "dist/js") serves "assets/app.js" from
+// "dist/js/app.js". Other names are unchanged.
+func PrefixMapper(view, backend string) MountMapper {
+	return &prefixMapper{path.Clean(view), path.Clean(backend)}
+}
+
+func (m *prefixMapper) ToBackend(name string) []string {
+	if hasPathPrefix(name, m.view) {
+		return []string{replacePathPrefix(name, m.view, m.backend)}
+	}
+	return []string{name}
+}
+
+func (m *prefixMapper) FromBackend(name string, isDir bool) (string, bool) {
+	if hasPathPrefix(name, m.backend) {
+		return replacePathPrefix(name, m.backend, m.view), true
+	}
+	return name, true
+}
+
+func (m *prefixMapper) Mounts() []string { return []string{m.view} }
+
+type stripExtMapper struct{ ext string }
+
+// StripExtMapper returns a PathMapper that presents files with the
+// extension ext without it, as StripExtMapper(".html") serves "about" from
+// "about.html". A file and a directory whose names collide in the view are
+// resolved to the file.
+func StripExtMapper(ext string) PathMapper {
+	return stripExtMapper{ext}
+}
+
+func (m stripExtMapper) ToBackend(name string) []string {
+	return []string{name + m.ext, name}
+}
+
+func (m stripExtMapper) FromBackend(name string, isDir bool) (string, bool) {
+	if !isDir && strings.HasSuffix(name, m.ext) && len(path.Base(name)) > len(m.ext) {
+		return strings.TrimSuffix(name, m.ext), true
+	}
+	return name, true
+}
+
+type addExtMapper struct{ ext string }
+
+// AddExtMapper returns a PathMapper that presents every file with the
+// extension ext appended, as AddExtMapper(".txt") serves "README.txt" from
+// "README". Directory names are unchanged.
+func AddExtMapper(ext string) PathMapper {
+	return addExtMapper{ext}
+}
+
+func (m addExtMapper) ToBackend(name string) []string {
+	if trimmed, ok := strings.CutSuffix(name, m.ext); ok && path.Base(trimmed) != "." {
+		return []string{trimmed, name}
+	}
+	return []string{name}
+}
+
+func (m addExtMapper) FromBackend(name string, isDir bool) (string, bool) {
+	if isDir {
+		return name, true
+	}
+	return name + m.ext, true
+}
+
+// RegexpRule rewrites names matching Pattern to Replacement, which may
+// refer to submatches as regexp.Regexp.Expand does, such as "$1".
+type RegexpRule struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// applyRegexpRules rewrites name with the first matching rule, reporting whether one
+// matched.
+func applyRegexpRules(rules []RegexpRule, name string) (string, bool) {
+	for _, rule := range rules {
+		if rule.Pattern.MatchString(name) {
+			return rule.Pattern.ReplaceAllString(name, rule.Replacement), true
+		}
+	}
+	return name, false
+}
+
+type regexpMapper struct{ toBackend, fromBackend []RegexpRule }
+
+// RegexpMapper returns a PathMapper that rewrites view names with the first
+// matching rule of toBackend, and backend names with the first matching
+// rule of fromBackend. Names no rule matches are unchanged. The two sets of
+// rules should be inverses of each other; names for which they are not are
+// hidden.
+func RegexpMapper(toBackend, fromBackend []RegexpRule) PathMapper {
+	return &regexpMapper{toBackend, fromBackend}
+}
+
+func (m *regexpMapper) ToBackend(name string) []string {
+	under, _ := applyRegexpRules(m.toBackend, name)
+	return []string{under}
+}
+
+func (m *regexpMapper) FromBackend(name string, isDir bool) (string, bool) {
+	v, _ := applyRegexpRules(m.fromBackend, name)
+	return v, fs.ValidPath(v)
+}
+
+type chainMapper []PathMapper
+
+// ChainMappers returns a PathMapper applying mappers in turn: view names
+// are translated by the first mapper, its results by the second, and so on
+// to the backend, and backend names in the reverse order. Mounts of any of
+// the mappers are kept.
+func ChainMappers(mappers ...PathMapper) MountMapper {
+	return chainMapper(mappers)
+}
+
+func (c chainMapper) ToBackend(name string) []string {
+	names := []string{name}
+	for _, m := range c {
+		var next []string
+		for _, n := range names {
+			next = append(next, m.ToBackend(n)...)
+		}
+		names = next
+	}
+	return names
+}
+
+func (c chainMapper) FromBackend(name string, isDir bool) (string, bool) {
+	for i := len(c) - 1; i >= 0; i-- {
+		var ok bool
+		if name, ok = c[i].FromBackend(name, isDir); !ok {
+			return "", false
+		}
+	}
+	return name, true
+}
+
+func (c chainMapper) Mounts() []string {
+	var mounts []string
+	for i, m := range c {
+		mm, ok := m.(MountMapper)
+		if !ok {
+			continue
+		}
+		for _, mount := range mm.Mounts() {
+			// Mounts are named in the view of m; translate them to the
+			// view of the chain through the mappers before it.
+			if v, ok := c[:i].FromBackend(mount, true); ok {
+				mounts = append(mounts, v)
+			}
+		}
+	}
+	return mounts
+}
@@ -0,0 +1,117 @@
+package gofs
+
+import (
+	"errors"
+	"io/fs"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/absfs/memfs"
+)
+
+func TestRewrite(t *testing.T) {
+	mfs, _ := memfs.NewFS()
+	mkdirs(mfs, "/dist", "/dist/js", "/pages", "/pages/docs")
+	for name, data := range map[string]string{
+		"/dist/js/app.js":        "app",
+		"/dist/js/vendor.js":     "vendor",
+		"/dist/index.html":       "index",
+		"/pages/about.html":      "about",
+		"/pages/docs.html":       "docs page",
+		"/pages/docs/intro.html": "intro",
+		"/pages/docs/raw.txt":    "raw",
+		"/pages/docs/intro":      "shadowed by intro.html",
+	} {
+		writeFile(mfs, name, []byte(data))
+	}
+	gfs, _ := NewFs(mfs)
+
+	t.Run("prefix", func(t *testing.T) {
+		r := Rewrite(gfs, PrefixMapper("static/assets", "dist/js"))
+		if data, err := r.ReadFile("static/assets/app.js"); err != nil || string(data) != "app" {
+			t.Errorf("ReadFile(static/assets/app.js) = %q, %v", data, err)
+		}
+		if _, err := r.Stat("dist/js/app.js"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Stat(dist/js/app.js) error = %v, want ErrNotExist", err)
+		}
+		info, err := r.Stat("static")
+		if err != nil || !info.IsDir() {
+			t.Errorf("Stat(static) = %v, %v; want a synthesized directory", info, err)
+		}
+		if err := fstest.TestFS(r, "static/assets/app.js", "dist/index.html"); err != nil {
+			t.Error(err)
+		}
+		checkWalk(t, r, ". dist dist/index.html pages pages/about.html pages/docs pages/docs/intro pages/docs/intro.html pages/docs/raw.txt pages/docs.html static static/assets static/assets/app.js static/assets/vendor.js")
+	})
+
+	t.Run("strip extension", func(t *testing.T) {
+		r := Rewrite(gfs, ChainMappers(PrefixMapper(".", "pages"), StripExtMapper(".html")))
+		for name, want := range map[string]string{"about": "about", "docs": "docs page", "docs/intro": "intro", "docs/raw.txt": "raw"} {
+			if data, err := r.ReadFile(name); err != nil || string(data) != want {
+				t.Errorf("ReadFile(%q) = %q, %v; want %q", name, data, err, want)
+			}
+		}
+		for _, name := range []string{"about.html", "docs/intro.html", "pages/about.html"} {
+			if _, err := r.Stat(name); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("Stat(%q) error = %v, want ErrNotExist", name, err)
+			}
+		}
+		f, err := r.Open("about")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info, _ := f.Stat(); info.Name() != "about" {
+			t.Errorf("opened file name = %q, want about", info.Name())
+		}
+		f.Close()
+		if entries, err := r.ReadDir("docs"); err != nil || len(entries) != 2 {
+			t.Errorf("ReadDir(docs) = %v, %v; want intro and raw.txt", entries, err)
+		}
+	})
+
+	t.Run("add extension", func(t *testing.T) {
+		r := Rewrite(gfs, ChainMappers(PrefixMapper(".", "pages/docs"), AddExtMapper(".bak")))
+		checkWalk(t, r, ". intro.bak intro.html.bak raw.txt.bak")
+		if data, err := r.ReadFile("intro.html.bak"); err != nil || string(data) != "intro" {
+			t.Errorf("ReadFile(intro.html.bak) = %q, %v", data, err)
+		}
+	})
+
+	t.Run("regexp", func(t *testing.T) {
+		r := Rewrite(gfs, RegexpMapper(
+			[]RegexpRule{{regexp.MustCompile(`^js/(.*)\.min\.js$`), "dist/js/$1.js"}},
+			[]RegexpRule{{regexp.MustCompile(`^dist/js/(.*)\.js$`), "js/$1.min.js"}},
+		))
+		if data, err := r.ReadFile("js/vendor.min.js"); err != nil || string(data) != "vendor" {
+			t.Errorf("ReadFile(js/vendor.min.js) = %q, %v", data, err)
+		}
+		if _, err := r.Stat("dist/js/vendor.js"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Stat(dist/js/vendor.js) error = %v, want ErrNotExist", err)
+		}
+		if entries, err := r.ReadDir("dist/js"); err != nil || len(entries) != 0 {
+			t.Errorf("ReadDir(dist/js) = %v, %v; want no entries", entries, err)
+		}
+	})
+}
+
+// checkWalk fails the test if walking fsys does not visit exactly the
+// space-separated names in want.
+func checkWalk(t *testing.T, fsys fs.FS, want string) {
+	t.Helper()
+	var got []string
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		got = append(got, name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, " ") != want {
+		t.Errorf("walk = %v\nwant   %v", got, want)
+	}
+}
@@ -0,0 +1,852 @@
+package gofs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/absfs/absfs"
+	"github.com/absfs/memfs"
+)
+
+// ErrStale is returned when a file's contents are needed from the base of
+// a snapshot, but the file has changed there since the snapshot was taken.
+var ErrStale = errors.New("file changed since snapshot")
+
+// SnapshotFS is a read-only, point-in-time view of an absfs.FileSystem
+// returned by Snapshot. It implements fs.FS, fs.StatFS, fs.ReadDirFS and
+// fs.ReadFileFS.
+//
+// Taking a snapshot records only the tree and the metadata of every file,
+// so it is cheap; contents are read from the base on demand. Directory
+// listings and Stat always reflect the moment the snapshot was taken, but
+// the contents of a file that has since been modified in the base, as
+// detected by a change in size, modification time or mode, are no longer
+// available and reading them fails with ErrStale.
+type SnapshotFS struct {
+	base  absfs.FileSystem
+	nodes map[string]*snapNode // keyed by absolute path
+}
+
+// snapNode is a recorded file or directory.
+type snapNode struct {
+	info     fs.FileInfo
+	children []string // sorted entry names, for directories
+}
+
+// Snapshot records the current state of fsys.
+func Snapshot(fsys absfs.FileSystem) (*SnapshotFS, error) {
+	s := &SnapshotFS{base: fsys, nodes: make(map[string]*snapNode)}
+	info, err := fsys.Stat("/")
+	if err != nil {
+		return nil, err
+	}
+	if err := s.record("/", info); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// frozenInfo is a copy of a FileInfo. Some backends, memfs among them,
+// return FileInfos that reflect later changes to the file.
+type frozenInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+	sys     any
+}
+
+func freeze(info fs.FileInfo) *frozenInfo {
+	return &frozenInfo{info.Name(), info.Size(), info.Mode(), info.ModTime(), info.Sys()}
+}
+
+func (i *frozenInfo) Name() string       { return i.name }
+func (i *frozenInfo) Size() int64        { return i.size }
+func (i *frozenInfo) Mode() fs.FileMode  { return i.mode }
+func (i *frozenInfo) ModTime() time.Time { return i.modTime }
+func (i *frozenInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i *frozenInfo) Sys() any           { return i.sys }
+
+// record adds p and, if it is a directory, everything below it.
+func (s *SnapshotFS) record(p string, info fs.FileInfo) error {
+	node := &snapNode{info: freeze(info)}
+	s.nodes[p] = node
+	if !info.IsDir() {
+		return nil
+	}
+	entries, err := s.base.ReadDir(p)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		node.children = append(node.children, entry.Name())
+		if err := s.record(path.Join(p, entry.Name()), info); err != nil {
+			return err
+		}
+	}
+	sort.Strings(node.children)
+	return nil
+}
+
+// snapPath converts an io/fs name to the absolute path used as a key.
+func snapPath(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return path.Join("/", name), nil
+}
+
+// sameInfo reports whether a file is unchanged between two observations.
+// Directories are compared by type only, since their modification time
+// changes whenever an entry is added or removed.
+func sameInfo(a, b fs.FileInfo) bool {
+	if a.IsDir() || b.IsDir() {
+		return a.IsDir() == b.IsDir()
+	}
+	return a.Size() == b.Size() && a.Mode() == b.Mode() && a.ModTime().Equal(b.ModTime())
+}
+
+// openFile opens the recorded regular file p from the base, failing with
+// ErrStale if it has changed.
+func (s *SnapshotFS) openFile(p string, node *snapNode) (absfs.File, error) {
+	f, err := s.base.OpenFile(p, os.O_RDONLY, 0)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			err = &fs.PathError{Op: "open", Path: p, Err: ErrStale}
+		}
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil || !sameInfo(info, node.info) {
+		f.Close()
+		return nil, &fs.PathError{Op: "open", Path: p, Err: ErrStale}
+	}
+	return f, nil
+}
+
+// entries returns the FileInfos of the children of a recorded directory.
+func (s *SnapshotFS) entries(p string, node *snapNode) []fs.FileInfo {
+	infos := make([]fs.FileInfo, len(node.children))
+	for i, name := range node.children {
+		infos[i] = s.nodes[path.Join(p, name)].info
+	}
+	return infos
+}
+
+// Open opens the named file or directory as it was when the snapshot was
+// taken.
+func (s *SnapshotFS) Open(name string) (fs.File, error) {
+	p, err := snapPath("open", name)
+	if err != nil {
+		return nil, err
+	}
+	node, ok := s.nodes[p]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if node.info.IsDir() {
+		return &infoDir{info: node.info, entries: infoEntries(s.entries(p, node))}, nil
+	}
+	return s.openFile(p, node)
+}
+
+// Stat returns the recorded FileInfo for the named file.
+func (s *SnapshotFS) Stat(name string) (fs.FileInfo, error) {
+	p, err := snapPath("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	node, ok := s.nodes[p]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return node.info, nil
+}
+
+// ReadDir returns the recorded entries of the named directory, sorted by
+// name.
+func (s *SnapshotFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	p, err := snapPath("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	node, ok := s.nodes[p]
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	if !node.info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	return infoEntries(s.entries(p, node)), nil
+}
+
+// ReadFile reads the named file from the base, failing with ErrStale if it
+// has changed since the snapshot was taken.
+func (s *SnapshotFS) ReadFile(name string) ([]byte, error) {
+	p, err := snapPath("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	node, ok := s.nodes[p]
+	if !ok {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrNotExist}
+	}
+	f, err := s.openFile(p, node)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+func infoEntries(infos []fs.FileInfo) []fs.DirEntry {
+	entries := make([]fs.DirEntry, len(infos))
+	for i, info := range infos {
+		entries[i] = fs.FileInfoToDirEntry(info)
+	}
+	return entries
+}
+
+// infoDir is an open directory whose entries are known in advance.
+type infoDir struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	off     int
+}
+
+func (d *infoDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *infoDir) Close() error               { return nil }
+
+func (d *infoDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name(), Err: errors.New("is a directory")}
+}
+
+// ReadDir returns up to n of the remaining entries, or all of them if n <= 0.
+func (d *infoDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.off:]
+	if n <= 0 {
+		d.off = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	rest = rest[:min(n, len(rest))]
+	d.off += len(rest)
+	return rest, nil
+}
+
+// Fork returns a writable copy-on-write view of the snapshot.
+func (s *SnapshotFS) Fork() (*Fork, error) {
+	upper, err := memfs.NewFS()
+	if err != nil {
+		return nil, err
+	}
+	return &Fork{snap: s, upper: upper, changed: make(map[string]bool), removed: make(map[string]bool)}, nil
+}
+
+// Fork is a writable view of a SnapshotFS. Modifications are recorded in
+// memory, in a memfs, and unmodified files are read from the snapshot's
+// base, so files modified in the base since the snapshot can only be read
+// through the Fork once they have been overwritten in it. Fork implements
+// absfs.Filer; wrap it with NewFs for the io/fs interfaces.
+//
+// All names are resolved from the root, relative names included. Changing
+// a file's metadata or opening it for writing copies the whole file into
+// memory. Symbolic links in the base cannot be modified.
+//
+// A Fork is not safe for concurrent use.
+type Fork struct {
+	snap    *SnapshotFS
+	upper   *memfs.FileSystem
+	changed map[string]bool // paths written or changed in upper
+	removed map[string]bool // snapshot paths removed, hiding their subtrees
+}
+
+var _ absfs.Filer = (*Fork)(nil)
+
+func forkPath(name string) string {
+	return path.Join("/", name)
+}
+
+// hidden reports whether the snapshot's version of p has been removed.
+func (f *Fork) hidden(p string) bool {
+	for q := p; ; q = path.Dir(q) {
+		if f.removed[q] {
+			return true
+		}
+		if q == "/" {
+			return false
+		}
+	}
+}
+
+// fromSnapshot returns the snapshot's node for p if it is still visible.
+func (f *Fork) fromSnapshot(p string) *snapNode {
+	if f.hidden(p) {
+		return nil
+	}
+	return f.snap.nodes[p]
+}
+
+// lookup returns the FileInfo of p as seen through the Fork.
+func (f *Fork) lookup(op, p string) (fs.FileInfo, error) {
+	if info, err := f.upper.Stat(p); err == nil {
+		return info, nil
+	}
+	if node := f.fromSnapshot(p); node != nil {
+		return node.info, nil
+	}
+	return nil, &os.PathError{Op: op, Path: p, Err: fs.ErrNotExist}
+}
+
+// list returns the merged entries of directory p, sorted by name.
+func (f *Fork) list(p string) ([]fs.FileInfo, error) {
+	info, err := f.lookup("readdir", p)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &os.PathError{Op: "readdir", Path: p, Err: errors.New("not a directory")}
+	}
+	merged := make(map[string]fs.FileInfo)
+	if node := f.fromSnapshot(p); node != nil && node.info.IsDir() {
+		for _, name := range node.children {
+			child := path.Join(p, name)
+			if !f.removed[child] {
+				merged[name] = f.snap.nodes[child].info
+			}
+		}
+	}
+	if upper, err := f.upper.ReadDir(p); err == nil {
+		for _, entry := range upper {
+			if info, err := entry.Info(); err == nil {
+				merged[entry.Name()] = info
+			}
+		}
+	}
+	infos := make([]fs.FileInfo, 0, len(merged))
+	for _, info := range merged {
+		infos = append(infos, info)
+	}
+	slices.SortFunc(infos, func(a, b fs.FileInfo) int { return strings.Compare(a.Name(), b.Name()) })
+	return infos, nil
+}
+
+// copyUp makes sure p and its parents exist in upper, copying them from the
+// snapshot if necessary.
+func (f *Fork) copyUp(p string) error {
+	if _, err := f.upper.Stat(p); err == nil {
+		return nil
+	}
+	node := f.fromSnapshot(p)
+	if node == nil {
+		return &os.PathError{Op: "open", Path: p, Err: fs.ErrNotExist}
+	}
+	if err := f.copyUp(path.Dir(p)); err != nil {
+		return err
+	}
+	mode := node.info.Mode()
+	switch {
+	case mode.IsDir():
+		if err := f.upper.Mkdir(p, mode.Perm()); err != nil {
+			return err
+		}
+	case mode.IsRegular():
+		src, err := f.snap.openFile(p, node)
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(src)
+		src.Close()
+		if err != nil {
+			return err
+		}
+		if err := f.writeUpper(p, data, mode.Perm()); err != nil {
+			return err
+		}
+	default:
+		return &os.PathError{Op: "open", Path: p, Err: absfs.ErrNotImplemented}
+	}
+	return f.upper.Chtimes(p, node.info.ModTime(), node.info.ModTime())
+}
+
+// writeUpper creates the file p in upper with the given contents.
+func (f *Fork) writeUpper(p string, data []byte, perm os.FileMode) error {
+	file, err := f.upper.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// copyUpParent makes sure the parent of p is a directory in upper.
+func (f *Fork) copyUpParent(op, p string) error {
+	dir := path.Dir(p)
+	info, err := f.lookup(op, dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return &os.PathError{Op: op, Path: p, Err: errors.New("not a directory")}
+	}
+	return f.copyUp(dir)
+}
+
+// OpenFile opens the named file. Opening a file for writing copies it into
+// the Fork, unless it is truncated.
+func (f *Fork) OpenFile(name string, flag int, perm os.FileMode) (absfs.File, error) {
+	p := forkPath(name)
+	info, err := f.lookup("open", p)
+	exists := err == nil
+	if exists && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	}
+	if !exists && flag&os.O_CREATE == 0 {
+		return nil, err
+	}
+
+	if exists && flag&absfs.O_ACCESS == os.O_RDONLY {
+		if info.IsDir() {
+			entries, err := f.list(p)
+			if err != nil {
+				return nil, err
+			}
+			if err := f.copyUp(p); err != nil {
+				return nil, err
+			}
+			dir, err := f.upper.OpenFile(p, os.O_RDONLY, 0)
+			if err != nil {
+				return nil, err
+			}
+			return &forkDir{File: dir, infoDir: infoDir{info: info, entries: infoEntries(entries)}}, nil
+		}
+		if _, err := f.upper.Stat(p); err == nil {
+			return f.upper.OpenFile(p, flag, perm)
+		}
+		return f.snap.openFile(p, f.fromSnapshot(p))
+	}
+
+	if exists && info.IsDir() {
+		return nil, &os.PathError{Op: "open", Path: name, Err: errors.New("is a directory")}
+	}
+	switch {
+	case exists && flag&os.O_TRUNC == 0:
+		err = f.copyUp(p)
+	case exists:
+		perm = info.Mode().Perm()
+		err = f.copyUpParent("open", p)
+	default:
+		err = f.copyUpParent("open", p)
+	}
+	if err != nil {
+		return nil, err
+	}
+	file, err := f.upper.OpenFile(p, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	f.changed[p] = true
+	return file, nil
+}
+
+// Mkdir creates a directory in the Fork.
+func (f *Fork) Mkdir(name string, perm os.FileMode) error {
+	p := forkPath(name)
+	if _, err := f.lookup("mkdir", p); err == nil {
+		return &os.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+	if err := f.copyUpParent("mkdir", p); err != nil {
+		return err
+	}
+	if err := f.upper.Mkdir(p, perm); err != nil {
+		return err
+	}
+	f.changed[p] = true
+	return nil
+}
+
+// Remove removes the named file or empty directory from the Fork.
+func (f *Fork) Remove(name string) error {
+	p := forkPath(name)
+	info, err := f.lookup("remove", p)
+	if err != nil {
+		return err
+	}
+	if p == "/" {
+		return &os.PathError{Op: "remove", Path: name, Err: fs.ErrPermission}
+	}
+	if info.IsDir() {
+		entries, err := f.list(p)
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			return &os.PathError{Op: "remove", Path: name, Err: errors.New("directory not empty")}
+		}
+	}
+	inSnapshot := f.fromSnapshot(p) != nil
+	if _, err := f.upper.Stat(p); err == nil {
+		if err := f.upper.Remove(p); err != nil {
+			return err
+		}
+	}
+	if inSnapshot {
+		f.removed[p] = true
+	}
+	delete(f.changed, p)
+	return nil
+}
+
+// Rename moves a file or directory within the Fork, replacing newpath if
+// it is a file. Renaming a directory copies its whole subtree into memory.
+func (f *Fork) Rename(oldpath, newpath string) error {
+	src, dst := forkPath(oldpath), forkPath(newpath)
+	info, err := f.lookup("rename", src)
+	if err != nil {
+		return err
+	}
+	if src == dst {
+		return nil
+	}
+	if src == "/" || strings.HasPrefix(dst, src+"/") {
+		return &os.PathError{Op: "rename", Path: oldpath, Err: fs.ErrInvalid}
+	}
+	if existing, err := f.lookup("rename", dst); err == nil {
+		if existing.IsDir() {
+			return &os.PathError{Op: "rename", Path: newpath, Err: fs.ErrExist}
+		}
+		if err := f.Remove(dst); err != nil {
+			return err
+		}
+	}
+	if err := f.copyUpParent("rename", dst); err != nil {
+		return err
+	}
+	if err := f.copyTree(src, dst, info); err != nil {
+		return err
+	}
+	return f.removeTree(src, info)
+}
+
+// copyTree copies src, as seen through the Fork, to dst in upper.
+func (f *Fork) copyTree(src, dst string, info fs.FileInfo) error {
+	if info.IsDir() {
+		if err := f.upper.Mkdir(dst, info.Mode().Perm()); err != nil {
+			return err
+		}
+		entries, err := f.list(src)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := f.copyTree(path.Join(src, entry.Name()), path.Join(dst, entry.Name()), entry); err != nil {
+				return err
+			}
+		}
+	} else {
+		data, err := f.ReadFile(src)
+		if err != nil {
+			return err
+		}
+		if err := f.writeUpper(dst, data, info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	f.changed[dst] = true
+	return f.upper.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+// removeTree removes p and everything below it from the Fork.
+func (f *Fork) removeTree(p string, info fs.FileInfo) error {
+	if info.IsDir() {
+		entries, err := f.list(p)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := f.removeTree(path.Join(p, entry.Name()), entry); err != nil {
+				return err
+			}
+		}
+	}
+	return f.Remove(p)
+}
+
+// Stat returns the FileInfo of the named file as seen through the Fork.
+func (f *Fork) Stat(name string) (os.FileInfo, error) {
+	return f.lookup("stat", forkPath(name))
+}
+
+// Chmod changes the mode of the named file, copying it into the Fork.
+func (f *Fork) Chmod(name string, mode os.FileMode) error {
+	return f.modify(name, func(p string) error { return f.upper.Chmod(p, mode) })
+}
+
+// Chtimes changes the times of the named file, copying it into the Fork.
+func (f *Fork) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return f.modify(name, func(p string) error { return f.upper.Chtimes(p, atime, mtime) })
+}
+
+// Chown changes the owner of the named file, copying it into the Fork.
+// Commit does not propagate ownership.
+func (f *Fork) Chown(name string, uid, gid int) error {
+	return f.modify(name, func(p string) error { return f.upper.Chown(p, uid, gid) })
+}
+
+func (f *Fork) modify(name string, fn func(p string) error) error {
+	p := forkPath(name)
+	if err := f.copyUp(p); err != nil {
+		return err
+	}
+	if err := fn(p); err != nil {
+		return err
+	}
+	f.changed[p] = true
+	return nil
+}
+
+// ReadDir returns the entries of the named directory, sorted by name.
+func (f *Fork) ReadDir(name string) ([]fs.DirEntry, error) {
+	infos, err := f.list(forkPath(name))
+	if err != nil {
+		return nil, err
+	}
+	return infoEntries(infos), nil
+}
+
+// ReadFile reads the named file as seen through the Fork.
+func (f *Fork) ReadFile(name string) ([]byte, error) {
+	file, err := f.OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// Sub returns an fs.FS for the subtree of the Fork rooted at dir.
+func (f *Fork) Sub(dir string) (fs.FS, error) {
+	return absfs.FilerToFS(f, dir)
+}
+
+// Diff returns the differences between the Fork and its snapshot, sorted by
+// path: a Create for every path that was added, a Remove for every path
+// that was removed, and a Modify for every path whose contents or metadata
+// were changed. A path whose type changed is reported as a Remove followed
+// by a Create. Paths are relative to the root, as in io/fs.
+func (f *Fork) Diff() ([]Event, error) {
+	var events []Event
+	for p, node := range f.snap.nodes {
+		if p == "/" {
+			continue
+		}
+		info, err := f.lookup("diff", p)
+		switch {
+		case err != nil:
+			events = append(events, Event{Op: Remove, Path: p[1:]})
+		case info.IsDir() != node.info.IsDir():
+			events = append(events, Event{Op: Remove, Path: p[1:]}, Event{Op: Create, Path: p[1:]})
+		case f.changed[p] || f.hidden(p):
+			events = append(events, Event{Op: Modify, Path: p[1:]})
+		}
+	}
+	if err := f.diffCreated("/", &events); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Path < events[j].Path })
+	return events, nil
+}
+
+// diffCreated appends a Create for every path below dir that is not in the
+// snapshot.
+func (f *Fork) diffCreated(dir string, events *[]Event) error {
+	entries, err := f.list(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		p := path.Join(dir, entry.Name())
+		if f.snap.nodes[p] == nil {
+			*events = append(*events, Event{Op: Create, Path: p[1:]})
+		}
+		if entry.IsDir() {
+			if err := f.diffCreated(p, events); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Commit applies the Fork's changes to the snapshot's base and resets the
+// Fork to a fresh snapshot of it.
+//
+// Commit fails with ErrStale, without changing anything, if a path it would
+// modify or remove has changed in the base since the snapshot was taken.
+// Otherwise new directories are created first, then every file is written
+// or removed in a single Tx, then removed directories are deleted and
+// finally modes and modification times are set. The file changes are
+// all-or-nothing; if a directory step fails, Commit stops and returns the
+// error, leaving the changes applied so far in place.
+func (f *Fork) Commit() error {
+	events, err := f.Diff()
+	if err != nil {
+		return err
+	}
+	base := f.snap.base
+
+	for _, ev := range events {
+		p := "/" + ev.Path
+		node := f.snap.nodes[p]
+		if ev.Op == Create && node == nil {
+			continue
+		}
+		info, err := base.Stat(p)
+		if err != nil || !sameInfo(info, node.info) {
+			return &fs.PathError{Op: "commit", Path: ev.Path, Err: ErrStale}
+		}
+	}
+
+	// Classify the changes. A type change appears as a Remove and a Create
+	// of the same path.
+	var mkdirs, rmdirs, replaceDirs []string
+	var setMeta []string
+	tx := Begin(base)
+	removing := make(map[string]bool)
+	for _, ev := range events {
+		p := "/" + ev.Path
+		if ev.Op == Remove {
+			removing[p] = true
+			if f.snap.nodes[p].info.IsDir() {
+				rmdirs = append(rmdirs, p)
+			} else {
+				tx.Remove(p)
+			}
+			continue
+		}
+		setMeta = append(setMeta, p)
+		info, err := f.lookup("commit", p)
+		if err != nil {
+			return err
+		}
+		switch {
+		case info.IsDir():
+			if ev.Op == Create {
+				mkdirs = append(mkdirs, p)
+			}
+		case removing[p] && f.snap.nodes[p].info.IsDir():
+			// A directory replaced by a file is written once the directory
+			// is gone.
+			replaceDirs = append(replaceDirs, p)
+		default:
+			data, err := f.upper.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			tx.WriteFile(p, data, info.Mode().Perm())
+		}
+	}
+
+	for _, p := range mkdirs {
+		if removing[p] {
+			// A file replaced by a directory.
+			if err := base.Remove(p); err != nil {
+				return err
+			}
+			tx.ops = slices.DeleteFunc(tx.ops, func(op *txOp) bool { return op.name == p })
+		}
+		info, _ := f.upper.Stat(p)
+		if err := base.Mkdir(p, info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for i := len(rmdirs) - 1; i >= 0; i-- {
+		if err := base.Remove(rmdirs[i]); err != nil {
+			return err
+		}
+	}
+	for _, p := range replaceDirs {
+		info, _ := f.upper.Stat(p)
+		data, err := f.upper.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if err := WriteFileAtomic(base, p, data, info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	for i := len(setMeta) - 1; i >= 0; i-- {
+		p := setMeta[i]
+		info, err := f.upper.Stat(p)
+		if err != nil {
+			return err
+		}
+		if err := base.Chmod(p, info.Mode().Perm()); err != nil {
+			return err
+		}
+		if err := base.Chtimes(p, info.ModTime(), info.ModTime()); err != nil {
+			return err
+		}
+	}
+
+	snap, err := Snapshot(base)
+	if err != nil {
+		return err
+	}
+	fresh, err := snap.Fork()
+	if err != nil {
+		return err
+	}
+	*f = *fresh
+	return nil
+}
+
+// forkDir is a directory opened through a Fork, listing the merged entries.
+type forkDir struct {
+	absfs.File
+	infoDir
+}
+
+func (d *forkDir) Stat() (os.FileInfo, error) { return d.info, nil }
+func (d *forkDir) Read(p []byte) (int, error) { return d.infoDir.Read(p) }
+func (d *forkDir) Close() error               { return d.File.Close() }
+
+func (d *forkDir) ReadDir(n int) ([]fs.DirEntry, error) { return d.infoDir.ReadDir(n) }
+
+func (d *forkDir) Readdir(n int) ([]os.FileInfo, error) {
+	entries, err := d.infoDir.ReadDir(n)
+	infos := make([]os.FileInfo, len(entries))
+	for i, e := range entries {
+		// The entries were made from FileInfos, so Info cannot fail.
+		infos[i], _ = e.Info()
+	}
+	return infos, err
+}
+
+func (d *forkDir) Readdirnames(n int) ([]string, error) {
+	entries, err := d.infoDir.ReadDir(n)
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name()
+	}
+	return names, err
+}
@@ -0,0 +1,235 @@
+package gofs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/absfs/absfs"
+	"github.com/absfs/memfs"
+)
+
+func setupSnapshotFS(t *testing.T) *memfs.FileSystem {
+	t.Helper()
+	mfs, err := memfs.NewFS()
+	if err != nil {
+		t.Fatalf("Failed to create memfs: %v", err)
+	}
+	mkdirs(mfs, "/docs", "/docs/old", "/src")
+	for name, data := range map[string]string{
+		"/readme.md":        "readme",
+		"/docs/guide.md":    "guide",
+		"/docs/old/v1.md":   "v1",
+		"/src/main.go":      "package main",
+		"/src/main_test.go": "package main_test",
+	} {
+		if err := writeFile(mfs, name, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return mfs
+}
+
+// putFile writes a file through any Filer.
+func putFile(fsys absfs.Filer, name string, data []byte) error {
+	f, err := fsys.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func TestSnapshot(t *testing.T) {
+	mfs := setupSnapshotFS(t)
+	snap, err := Snapshot(mfs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(snap, "readme.md", "docs/guide.md", "docs/old/v1.md", "src/main.go"); err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(mfs, "/readme.md", []byte("changed readme"))
+	writeFile(mfs, "/new.txt", []byte("new"))
+	mfs.Remove("/src/main_test.go")
+
+	if _, err := snap.Stat("new.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat(new.txt) = %v, want ErrNotExist", err)
+	}
+	if info, err := snap.Stat("readme.md"); err != nil || info.Size() != int64(len("readme")) {
+		t.Errorf("Stat(readme.md) = %v, %v; want recorded size", info, err)
+	}
+	if _, err := snap.ReadFile("readme.md"); !errors.Is(err, ErrStale) {
+		t.Errorf("ReadFile(readme.md) = %v, want ErrStale", err)
+	}
+	if _, err := snap.ReadFile("src/main_test.go"); !errors.Is(err, ErrStale) {
+		t.Errorf("ReadFile(src/main_test.go) = %v, want ErrStale", err)
+	}
+	if data, err := snap.ReadFile("docs/guide.md"); err != nil || string(data) != "guide" {
+		t.Errorf("ReadFile(docs/guide.md) = %q, %v", data, err)
+	}
+	entries, _ := snap.ReadDir("src")
+	if len(entries) != 2 {
+		t.Errorf("ReadDir(src) = %d entries, want 2", len(entries))
+	}
+}
+
+func TestFork(t *testing.T) {
+	mfs := setupSnapshotFS(t)
+	snap, _ := Snapshot(mfs)
+	fork, err := snap.Fork()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mtime := time.Unix(1e9, 0)
+	if err := putFile(fork, "/readme.md", []byte("new readme")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fork.Mkdir("/docs/new", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := putFile(fork, "/docs/new/v2.md", []byte("v2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fork.Chtimes("/docs/new/v2.md", mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	if err := fork.Remove("/docs/old/v1.md"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fork.Remove("/docs/old"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fork.Rename("/src/main_test.go", "/src/util_test.go"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fork.Remove("/src"); err == nil {
+		t.Error("removing a non-empty directory succeeded")
+	}
+
+	gfs, _ := NewFs(fork)
+	want := map[string]string{
+		"readme.md":        "new readme",
+		"docs/guide.md":    "guide",
+		"docs/new/v2.md":   "v2",
+		"src/main.go":      "package main",
+		"src/util_test.go": "package main_test",
+	}
+	var names []string
+	for name, data := range want {
+		names = append(names, name)
+		got, err := fs.ReadFile(gfs, name)
+		if err != nil || string(got) != data {
+			t.Errorf("fork ReadFile(%q) = %q, %v; want %q", name, got, err, data)
+		}
+	}
+	// FileSystem's DirEntry.Type reports permission bits as well as the
+	// type, which fstest rejects, so the tree is checked through absfs.
+	sub, _ := fork.Sub("/")
+	if err := fstest.TestFS(sub, names...); err != nil {
+		t.Error(err)
+	}
+
+	// The base is untouched until Commit.
+	if data, _ := mfs.ReadFile("/readme.md"); string(data) != "readme" {
+		t.Errorf("base readme.md = %q before commit", data)
+	}
+
+	diff, err := fork.Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantDiff := []Event{
+		{Op: Create, Path: "docs/new"},
+		{Op: Create, Path: "docs/new/v2.md"},
+		{Op: Remove, Path: "docs/old"},
+		{Op: Remove, Path: "docs/old/v1.md"},
+		{Op: Modify, Path: "readme.md"},
+		{Op: Remove, Path: "src/main_test.go"},
+		{Op: Create, Path: "src/util_test.go"},
+	}
+	if !reflect.DeepEqual(diff, wantDiff) {
+		t.Errorf("Diff = %v\nwant %v", diff, wantDiff)
+	}
+
+	if err := fork.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	base, _ := NewFs(mfs)
+	for name, data := range want {
+		got, err := fs.ReadFile(base, name)
+		if err != nil || string(got) != data {
+			t.Errorf("base ReadFile(%q) = %q, %v; want %q", name, got, err, data)
+		}
+	}
+	if _, err := mfs.Stat("/docs/old"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("docs/old still exists in base: %v", err)
+	}
+	if info, err := mfs.Stat("/docs/new/v2.md"); err != nil || !info.ModTime().Equal(mtime) {
+		t.Errorf("v2.md mtime = %v, %v; want %v", info.ModTime(), err, mtime)
+	}
+	if diff, _ := fork.Diff(); len(diff) != 0 {
+		t.Errorf("Diff after Commit = %v, want none", diff)
+	}
+}
+
+func TestFork_TypeChange(t *testing.T) {
+	mfs := setupSnapshotFS(t)
+	snap, _ := Snapshot(mfs)
+	fork, _ := snap.Fork()
+
+	fork.Remove("/readme.md")
+	fork.Mkdir("/readme.md", 0755)
+	putFile(fork, "/readme.md/index.md", []byte("index"))
+	fork.Remove("/docs/old/v1.md")
+	fork.Remove("/docs/old")
+	putFile(fork, "/docs/old", []byte("gone"))
+
+	if err := fork.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := mfs.ReadFile("/readme.md/index.md"); err != nil || string(data) != "index" {
+		t.Errorf("readme.md/index.md = %q, %v", data, err)
+	}
+	if data, err := mfs.ReadFile("/docs/old"); err != nil || string(data) != "gone" {
+		t.Errorf("docs/old = %q, %v", data, err)
+	}
+}
+
+func TestFork_Stale(t *testing.T) {
+	mfs := setupSnapshotFS(t)
+	snap, _ := Snapshot(mfs)
+	fork, _ := snap.Fork()
+
+	putFile(fork, "/docs/guide.md", []byte("fork edit"))
+	putFile(fork, "/added.txt", []byte("added"))
+	writeFile(mfs, "/docs/guide.md", []byte("base edit"))
+
+	if err := fork.Commit(); !errors.Is(err, ErrStale) {
+		t.Fatalf("Commit = %v, want ErrStale", err)
+	}
+	if data, _ := mfs.ReadFile("/docs/guide.md"); string(data) != "base edit" {
+		t.Errorf("base guide.md = %q after failed commit", data)
+	}
+	if _, err := mfs.Stat("/added.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("added.txt created by failed commit: %v", err)
+	}
+
+	// Unmodified files changed in the base are unreadable through the fork.
+	writeFile(mfs, "/readme.md", []byte("base readme"))
+	if _, err := fork.ReadFile("/readme.md"); !errors.Is(err, ErrStale) {
+		t.Errorf("ReadFile(readme.md) = %v, want ErrStale", err)
+	}
+	if _, err := fork.OpenFile("/readme.md", os.O_WRONLY, 0); !errors.Is(err, ErrStale) {
+		t.Errorf("OpenFile(readme.md, O_WRONLY) = %v, want ErrStale", err)
+	}
+}
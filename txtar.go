@@ -0,0 +1,142 @@
+package gofs
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/absfs/memfs"
+)
+
+// The txtar format, as used by the Go project's own tests, is a comment
+// followed by files, each introduced by a marker line of the form
+// "-- name --". See golang.org/x/tools/txtar.
+
+var (
+	txtarMarker    = []byte("-- ")
+	txtarMarkerEnd = []byte(" --")
+	txtarNewline   = []byte("\n")
+)
+
+// txtarFile is a file in a txtar archive.
+type txtarFile struct {
+	name string
+	data []byte
+}
+
+// parseTxtar parses a txtar archive, discarding its comment.
+func parseTxtar(data []byte) []txtarFile {
+	var files []txtarFile
+	_, name, data := findTxtarMarker(data)
+	for name != "" {
+		f := txtarFile{name: name}
+		f.data, name, data = findTxtarMarker(data)
+		files = append(files, f)
+	}
+	return files
+}
+
+// findTxtarMarker finds the next marker line in data. It returns the data
+// before the marker, the file name in the marker and the data after it. If
+// there is no marker, it returns all of data and an empty name.
+func findTxtarMarker(data []byte) (before []byte, name string, after []byte) {
+	var i int
+	for {
+		if name, after = isTxtarMarker(data[i:]); name != "" {
+			return data[:i], name, after
+		}
+		j := bytes.Index(data[i:], txtarNewline)
+		if j < 0 {
+			return fixTxtarNewline(data), "", nil
+		}
+		i += j + 1
+	}
+}
+
+// isTxtarMarker reports whether data begins with a marker line, returning
+// the file name and the data after the line.
+func isTxtarMarker(data []byte) (name string, after []byte) {
+	if !bytes.HasPrefix(data, txtarMarker) {
+		return "", nil
+	}
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		data, after = data[:i], data[i+1:]
+	}
+	if !bytes.HasSuffix(data, txtarMarkerEnd) || len(data) < len(txtarMarker)+len(txtarMarkerEnd) {
+		return "", nil
+	}
+	return strings.TrimSpace(string(data[len(txtarMarker) : len(data)-len(txtarMarkerEnd)])), after
+}
+
+// fixTxtarNewline adds a final newline to non-empty data that lacks one.
+func fixTxtarNewline(data []byte) []byte {
+	if len(data) == 0 || data[len(data)-1] == '\n' {
+		return data
+	}
+	return append(data[:len(data):len(data)], '\n')
+}
+
+// formatTxtar returns the txtar encoding of files.
+func formatTxtar(files []txtarFile) []byte {
+	var buf bytes.Buffer
+	for _, f := range files {
+		fmt.Fprintf(&buf, "-- %s --\n", f.name)
+		buf.Write(fixTxtarNewline(f.data))
+	}
+	return buf.Bytes()
+}
+
+// FromTxtar returns a FileSystem, backed by a new memfs, holding the files
+// of a txtar archive. Parent directories are created as needed, the
+// archive's comment is ignored and a file named more than once takes its
+// last contents. File names are resolved from the root and cannot escape
+// it. As in the txtar format, every non-empty file ends with a newline.
+//
+// FromTxtar is meant for fixtures, so like regexp.MustCompile it panics if
+// the archive cannot be represented, which happens when a name is used both
+// as a file and as a directory.
+func FromTxtar(data []byte) FileSystem {
+	mfs, err := memfs.NewFS()
+	if err != nil {
+		panic(err)
+	}
+	for _, f := range parseTxtar(data) {
+		name := path.Join("/", f.name)
+		if err := mfs.MkdirAll(path.Dir(name), 0755); err != nil {
+			panic(fmt.Sprintf("gofs: FromTxtar: %v", err))
+		}
+		file, err := mfs.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			panic(fmt.Sprintf("gofs: FromTxtar: %v", err))
+		}
+		file.Write(f.data)
+		file.Close()
+	}
+	fsys, err := NewFs(mfs)
+	if err != nil {
+		panic(err)
+	}
+	return fsys
+}
+
+// ToTxtar returns a txtar archive of the regular files below root in fsys,
+// in lexical order and named relative to root. Directories are implied by
+// the file names, so empty directories are not recorded, nor are modes and
+// modification times. A newline is added to non-empty files lacking one.
+// The capture is limited to DefaultCaptureLimit bytes.
+func ToTxtar(fsys fs.FS, root string) ([]byte, error) {
+	var files []txtarFile
+	err := capture(fsys, root, nil, func(name string, info fs.FileInfo, data []byte) error {
+		if !info.IsDir() {
+			files = append(files, txtarFile{name: name, data: data})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return formatTxtar(files), nil
+}
@@ -0,0 +1,62 @@
+package gofs
+
+import (
+	"io/fs"
+	"reflect"
+	"testing"
+)
+
+const fixtureTxtar = `Comment lines are ignored.
+-- a.txt --
+alpha
+-- dir/b.txt --
+beta
+gamma
+-- dir/sub/empty --
+-- c.txt --
+no final newline`
+
+func TestTxtarRoundTrip(t *testing.T) {
+	fsys := FromTxtar([]byte(fixtureTxtar))
+	want := map[string]string{
+		"a.txt":         "alpha\n",
+		"dir/b.txt":     "beta\ngamma\n",
+		"dir/sub/empty": "",
+		"c.txt":         "no final newline\n",
+	}
+	for name, data := range want {
+		got, err := fs.ReadFile(fsys, name)
+		if err != nil || string(got) != data {
+			t.Errorf("ReadFile(%q) = %q, %v; want %q", name, got, err, data)
+		}
+	}
+
+	archive, err := ToTxtar(fsys, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantArchive := "-- a.txt --\nalpha\n-- c.txt --\nno final newline\n" +
+		"-- dir/b.txt --\nbeta\ngamma\n-- dir/sub/empty --\n"
+	if string(archive) != wantArchive {
+		t.Errorf("ToTxtar = %q, want %q", archive, wantArchive)
+	}
+	if again, _ := ToTxtar(FromTxtar(archive), "."); string(again) != string(archive) {
+		t.Errorf("second round trip = %q, want %q", again, archive)
+	}
+
+	sub, _ := ToTxtar(fsys, "dir")
+	if string(sub) != "-- b.txt --\nbeta\ngamma\n-- sub/empty --\n" {
+		t.Errorf("ToTxtar(dir) = %q", sub)
+	}
+}
+
+func TestParseTxtar(t *testing.T) {
+	got := parseTxtar([]byte("-- a --\n--b --\n-- not a marker\n-- c --"))
+	want := []txtarFile{
+		{name: "a", data: []byte("--b --\n-- not a marker\n")},
+		{name: "c", data: nil},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseTxtar = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,305 @@
+package gofs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VirtualFS is a read-only fs.FS of files whose contents are produced when
+// they are read, such as health checks and build metadata, optionally
+// layered over another fs.FS. It implements fs.FS, fs.StatFS, fs.ReadDirFS
+// and fs.ReadFileFS, and is safe for concurrent use, including adding files
+// while others are read.
+//
+// Directories leading to virtual files are synthesized with mode 0555 and
+// the time a file was last added below them, unless the wrapped filesystem
+// has them. Virtual files take precedence over files of the wrapped
+// filesystem with the same name, and listings of a directory present in
+// both show the entries of both.
+//
+// The contents of a virtual file are produced each time it is opened, and
+// never to answer Stat or list a directory. For files added with AddFunc,
+// every FileInfo reports the size of the contents produced last and the time
+// they last changed, or a size of -1 and the time the file was added if it
+// has not been opened yet. The size of a file added with AddReader is
+// unknown until it has been read, so it is always reported as -1, and its
+// modification time is the time it was added.
+type VirtualFS struct {
+	// FS is the wrapped filesystem, or nil.
+	FS fs.FS
+
+	mu    sync.RWMutex
+	nodes map[string]*virtualNode
+}
+
+// virtualNode is a file or synthesized directory of a VirtualFS.
+type virtualNode struct {
+	mode     fs.FileMode
+	size     int64     // of the contents last produced, or -1 if unknown
+	modTime  time.Time // of the last change of contents, or of the last addition below a directory
+	fn       func(context.Context) ([]byte, error)
+	data     []byte // the contents last produced by fn
+	produced bool   // whether fn has been called
+	reader   func() io.ReadCloser
+	children []string // for directories
+}
+
+// Virtual returns an empty VirtualFS over fsys, which may be nil.
+func Virtual(fsys fs.FS) *VirtualFS {
+	return &VirtualFS{
+		FS:    fsys,
+		nodes: map[string]*virtualNode{".": {mode: fs.ModeDir | 0555, modTime: time.Now()}},
+	}
+}
+
+// AddFunc adds a file named name whose contents are returned by fn each
+// time it is opened, with the permission bits mode. The context passed to
+// fn is the one given to OpenContext, or context.Background.
+func (v *VirtualFS) AddFunc(name string, fn func(ctx context.Context) ([]byte, error), mode fs.FileMode) error {
+	if mode.Type() != 0 || fn == nil {
+		return &fs.PathError{Op: "add", Path: name, Err: fs.ErrInvalid}
+	}
+	return v.add(name, &virtualNode{mode: mode, size: -1, fn: fn})
+}
+
+// AddReader adds a file named name, with mode 0444, whose contents are read
+// from the reader fn returns each time it is opened. The file is streamed,
+// so unlike those added with AddFunc it does not implement io.Seeker or
+// io.ReaderAt.
+func (v *VirtualFS) AddReader(name string, fn func() io.ReadCloser) error {
+	if fn == nil {
+		return &fs.PathError{Op: "add", Path: name, Err: fs.ErrInvalid}
+	}
+	return v.add(name, &virtualNode{mode: 0444, size: -1, reader: fn})
+}
+
+// add adds the file node, synthesizing its parent directories.
+func (v *VirtualFS) add(name string, node *virtualNode) error {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "add", Path: name, Err: fs.ErrInvalid}
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if _, ok := v.nodes[name]; ok {
+		return &fs.PathError{Op: "add", Path: name, Err: fs.ErrExist}
+	}
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if parent, ok := v.nodes[dir]; ok && !parent.mode.IsDir() {
+			return &fs.PathError{Op: "add", Path: name, Err: errors.New("parent is a virtual file")}
+		}
+	}
+
+	now := time.Now()
+	node.modTime = now
+	v.nodes[name] = node
+	for child, dir := name, path.Dir(name); ; child, dir = dir, path.Dir(dir) {
+		parent, ok := v.nodes[dir]
+		if !ok {
+			parent = &virtualNode{mode: fs.ModeDir | 0555}
+			v.nodes[dir] = parent
+		}
+		parent.modTime = now
+		if i, found := slices.BinarySearch(parent.children, path.Base(child)); !found {
+			parent.children = slices.Insert(parent.children, i, path.Base(child))
+		}
+		if dir == "." {
+			return nil
+		}
+	}
+}
+
+// lookup returns the virtual node of name, or nil if name is a file of the
+// wrapped filesystem. It fails if name is invalid or below a virtual file.
+func (v *VirtualFS) lookup(op, name string) (*virtualNode, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if node, ok := v.nodes[name]; ok {
+		return node, nil
+	}
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if node, ok := v.nodes[dir]; ok && !node.mode.IsDir() {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+	}
+	if v.FS == nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return nil, nil
+}
+
+// info returns the FileInfo of the virtual node of name.
+func (v *VirtualFS) info(name string, node *virtualNode) fs.FileInfo {
+	if node.mode.IsDir() && v.FS != nil {
+		if info, err := fs.Stat(v.FS, name); err == nil && info.IsDir() {
+			return info
+		}
+	}
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return &frozenInfo{name: path.Base(name), size: node.size, mode: node.mode, modTime: node.modTime}
+}
+
+// produce calls the function of the AddFunc file node, recording the size
+// of the contents and, if they changed, the time.
+func (v *VirtualFS) produce(ctx context.Context, node *virtualNode) ([]byte, error) {
+	data, err := node.fn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if !node.produced || !bytes.Equal(data, node.data) {
+		node.data, node.size, node.modTime = bytes.Clone(data), int64(len(data)), time.Now()
+		node.produced = true
+	}
+	return data, nil
+}
+
+// dirInfos returns the entries of the virtual directory name merged with
+// those of the wrapped filesystem, sorted by name.
+func (v *VirtualFS) dirInfos(op, name string, node *virtualNode) ([]fs.FileInfo, error) {
+	v.mu.RLock()
+	children := make(map[string]*virtualNode, len(node.children))
+	for _, child := range node.children {
+		children[child] = v.nodes[joinName(name, child)]
+	}
+	v.mu.RUnlock()
+
+	var infos []fs.FileInfo
+	if v.FS != nil {
+		// A file of the wrapped filesystem at name is hidden by the
+		// virtual directory.
+		if info, err := fs.Stat(v.FS, name); err == nil && info.IsDir() {
+			entries, err := fs.ReadDir(v.FS, name)
+			if err != nil {
+				return nil, pathError(op, name, err)
+			}
+			for _, e := range entries {
+				if children[e.Name()] != nil {
+					continue
+				}
+				info, err := e.Info()
+				if err != nil {
+					return nil, pathError(op, name, err)
+				}
+				infos = append(infos, info)
+			}
+		}
+	}
+	for child, n := range children {
+		infos = append(infos, v.info(joinName(name, child), n))
+	}
+	slices.SortFunc(infos, func(a, b fs.FileInfo) int { return strings.Compare(a.Name(), b.Name()) })
+	return infos, nil
+}
+
+// Open opens the named file, producing its contents if it is virtual.
+func (v *VirtualFS) Open(name string) (fs.File, error) {
+	return v.OpenContext(context.Background(), name)
+}
+
+// OpenContext is like Open, passing ctx to the function producing the
+// contents of a file added with AddFunc.
+func (v *VirtualFS) OpenContext(ctx context.Context, name string) (fs.File, error) {
+	node, err := v.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case node == nil:
+		return v.FS.Open(name)
+	case node.mode.IsDir():
+		infos, err := v.dirInfos("open", name, node)
+		if err != nil {
+			return nil, err
+		}
+		return &infoDir{info: v.info(name, node), entries: infoEntries(infos)}, nil
+	case node.fn != nil:
+		data, err := v.produce(ctx, node)
+		if err != nil {
+			return nil, pathError("open", name, err)
+		}
+		return &embedOpenFile{Reader: bytes.NewReader(data), info: v.info(name, node)}, nil
+	default:
+		rc := node.reader()
+		if rc == nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: errors.New("nil reader")}
+		}
+		return &virtualStream{ReadCloser: rc, info: v.info(name, node)}, nil
+	}
+}
+
+// Stat returns the FileInfo of the named file.
+func (v *VirtualFS) Stat(name string) (fs.FileInfo, error) {
+	node, err := v.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	if node == nil {
+		return fs.Stat(v.FS, name)
+	}
+	return v.info(name, node), nil
+}
+
+// ReadDir reads the named directory, merging virtual entries with those of
+// the wrapped filesystem.
+func (v *VirtualFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	node, err := v.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if node == nil {
+		return fs.ReadDir(v.FS, name)
+	}
+	if !node.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	infos, err := v.dirInfos("readdir", name, node)
+	if err != nil {
+		return nil, err
+	}
+	return infoEntries(infos), nil
+}
+
+// ReadFile reads the named file, producing its contents if it is virtual.
+func (v *VirtualFS) ReadFile(name string) ([]byte, error) {
+	node, err := v.lookup("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case node == nil:
+		return fs.ReadFile(v.FS, name)
+	case node.mode.IsDir():
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: errors.New("is a directory")}
+	}
+	f, err := v.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, pathError("readfile", name, err)
+	}
+	return data, nil
+}
+
+// virtualStream is an open file added with AddReader.
+type virtualStream struct {
+	io.ReadCloser
+	info fs.FileInfo
+}
+
+func (f *virtualStream) Stat() (fs.FileInfo, error) { return f.info, nil }
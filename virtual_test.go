@@ -0,0 +1,144 @@
+package gofs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+type userKey struct{}
+
+func TestVirtual(t *testing.T) {
+	_, gfs := setupTreeFS(t)
+	v := Virtual(gfs)
+
+	calls := 0
+	if err := v.AddFunc("health/status.json", func(ctx context.Context) ([]byte, error) {
+		calls++
+		if user, _ := ctx.Value(userKey{}).(string); user != "" {
+			return []byte(`{"user":"` + user + `"}`), nil
+		}
+		return []byte(`{"ok":true}`), nil
+	}, 0444); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.AddReader("a/version.txt", func() io.ReadCloser { return io.NopCloser(strings.NewReader("v1.2.3")) }); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.AddFunc("root.txt", func(context.Context) ([]byte, error) { return []byte("virtual root"), nil }, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.AddFunc("broken", func(context.Context) ([]byte, error) { return nil, errors.New("backend down") }, 0444); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{
+		"health/status.json": `{"ok":true}`,
+		"a/version.txt":      "v1.2.3",
+		"root.txt":           "virtual root",
+		"a/one.txt":          "one",
+		"b/two.txt":          "two",
+	} {
+		if data, err := v.ReadFile(name); err != nil || string(data) != want {
+			t.Errorf("ReadFile(%q) = %q, %v; want %q", name, data, err, want)
+		}
+	}
+	if _, err := v.ReadFile("status.json"); calls != 1 || !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("calls = %d, ReadFile(status.json) error = %v", calls, err)
+	}
+	if _, err := v.ReadFile("broken"); err == nil || !strings.Contains(err.Error(), "backend down") {
+		t.Errorf("ReadFile(broken) error = %v, want backend down", err)
+	}
+
+	ctx := context.WithValue(context.Background(), userKey{}, "ci")
+	f, err := v.OpenContext(ctx, "health/status.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(f)
+	info, _ := f.Stat()
+	f.Close()
+	if string(data) != `{"user":"ci"}` || info.Size() != int64(len(data)) || info.Mode() != 0444 {
+		t.Errorf("OpenContext = %q, size %d, mode %v", data, info.Size(), info.Mode())
+	}
+
+	info, err = v.Stat("health")
+	if err != nil || !info.IsDir() || info.ModTime().IsZero() {
+		t.Errorf("Stat(health) = %v, %v; want a synthesized directory", info, err)
+	}
+	before := calls
+	checkWalk(t, v, ". a a/one.txt a/version.txt a/x a/x/deep b b/two.txt broken health health/status.json root.txt")
+	v.Stat("health/status.json")
+	if calls != before {
+		t.Errorf("Stat and ReadDir called the function %d times", calls-before)
+	}
+
+	empty := func(context.Context) ([]byte, error) { return nil, nil }
+	if err := v.AddFunc("health/status.json", empty, 0444); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("AddFunc(existing) error = %v, want ErrExist", err)
+	}
+	if err := v.AddFunc("root.txt/x", empty, 0444); err == nil {
+		t.Error("AddFunc below a virtual file succeeded")
+	}
+	if err := v.AddFunc("dir", empty, fs.ModeDir|0555); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("AddFunc(dir mode) error = %v, want ErrInvalid", err)
+	}
+	if err := v.AddFunc("nil", nil, 0444); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("AddFunc(nil) error = %v, want ErrInvalid", err)
+	}
+	if err := v.AddReader("nil", nil); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("AddReader(nil) error = %v, want ErrInvalid", err)
+	}
+}
+
+func TestVirtual_Standalone(t *testing.T) {
+	v := Virtual(nil)
+	v.AddFunc("build/info.json", func(context.Context) ([]byte, error) { return []byte(`{}`), nil }, 0444)
+	v.AddFunc("build/commit", func(context.Context) ([]byte, error) { return []byte("abc123"), nil }, 0444)
+	v.AddReader("build/log", func() io.ReadCloser { return io.NopCloser(strings.NewReader("built")) })
+	if info, err := v.Stat("build/commit"); err != nil || info.Size() != -1 {
+		t.Errorf("Stat(build/commit) before reading = %v, %v; want size -1", info, err)
+	}
+	v.ReadFile("build/commit")
+	info, err := v.Stat("build/commit")
+	if err != nil || info.Size() != 6 {
+		t.Errorf("Stat(build/commit) after reading = %v, %v; want size 6", info, err)
+	}
+	v.ReadFile("build/commit")
+	if again, err := v.Stat("build/commit"); err != nil || again.Size() != 6 || !again.ModTime().Equal(info.ModTime()) {
+		t.Errorf("Stat(build/commit) after reading again = %v, %v; want it unchanged", again, err)
+	}
+	if info, err := v.Stat("build/log"); err != nil || info.Size() != -1 {
+		t.Errorf("Stat(build/log) = %v, %v; want size -1", info, err)
+	}
+	checkWalk(t, v, ". build build/commit build/info.json build/log")
+	// TestFS expects listings to agree with open files, which holds once
+	// the contents have been produced.
+	v.ReadFile("build/info.json")
+	if err := fstest.TestFS(v, "build/commit", "build/info.json", "build/log"); err != nil {
+		t.Error(err)
+	}
+	if _, err := v.Stat("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat(missing) error = %v, want ErrNotExist", err)
+	}
+}
+
+func TestVirtual_Layered(t *testing.T) {
+	base := fstest.MapFS{
+		"static/app.js": {Data: []byte("app"), Mode: 0644},
+		"static/old.js": {Data: []byte("shadowed"), Mode: 0644},
+	}
+	v := Virtual(base)
+	v.AddFunc("static/old.js", func(context.Context) ([]byte, error) { return []byte("virtual"), nil }, 0444)
+	v.AddFunc("healthz", func(context.Context) ([]byte, error) { return []byte("ok"), nil }, 0444)
+	v.AddReader("static/version", func() io.ReadCloser { return io.NopCloser(strings.NewReader("v1")) })
+	v.ReadFile("static/old.js")
+	v.ReadFile("healthz")
+	if err := fstest.TestFS(v, "healthz", "static/app.js", "static/old.js", "static/version"); err != nil {
+		t.Error(err)
+	}
+}
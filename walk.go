@@ -0,0 +1,320 @@
+package gofs
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path"
+	"runtime"
+	"sync"
+)
+
+// WalkParallel walks the file tree rooted at root, calling fn for each file
+// or directory in the tree, including root. Up to workers directories are
+// read concurrently; if workers is less than one, runtime.GOMAXPROCS(0) is
+// used.
+//
+// The callback contract is the same as for fs.WalkDir: returning fs.SkipDir
+// from a directory skips it, returning fs.SkipDir from a file skips the rest
+// of its parent directory, returning fs.SkipAll ends the walk, and any other
+// error ends the walk and is returned. fn is never called concurrently, but
+// because directories are read in parallel the order of the calls is not
+// deterministic beyond each directory being visited before its entries. Use
+// WalkParallelOrdered when callbacks must arrive in lexical order.
+//
+// If ctx is canceled the walk stops and ctx.Err() is returned. WalkParallel
+// does not return until every directory read it started has finished.
+func WalkParallel(ctx context.Context, fsys fs.FS, root string, workers int, fn fs.WalkDirFunc) error {
+	w := newParallelWalker(ctx, fsys, workers, fn)
+	stop := context.AfterFunc(ctx, func() { w.halt(ctx.Err()) })
+	defer stop()
+	return w.run(root, func(name string, d fs.DirEntry) error {
+		w.mu.Lock()
+		w.queue = append(w.queue, dirJob{name, d})
+		w.pending++
+		w.mu.Unlock()
+		for i := 0; i < w.workers; i++ {
+			w.wg.Add(1)
+			go w.work()
+		}
+		return nil
+	})
+}
+
+// WalkParallelOrdered is like WalkParallel, but fn is called in exactly the
+// same order as fs.WalkDir would call it. Directories are read ahead of the
+// callbacks by up to workers concurrent reads, so the walk still overlaps
+// storage latency with the work done in fn.
+func WalkParallelOrdered(ctx context.Context, fsys fs.FS, root string, workers int, fn fs.WalkDirFunc) error {
+	w := newParallelWalker(ctx, fsys, workers, fn)
+	return w.run(root, func(name string, d fs.DirEntry) error {
+		return w.visitOrdered(name, d, w.prefetch(name))
+	})
+}
+
+// parallelWalker holds the state shared by WalkParallel and
+// WalkParallelOrdered.
+type parallelWalker struct {
+	ctx     context.Context
+	fsys    fs.FS
+	fn      fs.WalkDirFunc
+	workers int
+
+	sem  chan struct{} // bounds concurrent directory reads in ordered mode
+	stop chan struct{} // closed when the walk ends early
+	wg   sync.WaitGroup
+
+	mu      sync.Mutex // serializes fn in unordered mode and guards the fields below
+	err     error
+	stopped bool
+	queue   []dirJob   // directories waiting to be read in unordered mode
+	pending int        // directories queued or being read
+	cond    *sync.Cond // broadcast when the queue grows, drains or the walk stops
+}
+
+// dirJob is a directory waiting to be read by WalkParallel.
+type dirJob struct {
+	name string
+	d    fs.DirEntry
+}
+
+func newParallelWalker(ctx context.Context, fsys fs.FS, workers int, fn fs.WalkDirFunc) *parallelWalker {
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	w := &parallelWalker{
+		ctx:     ctx,
+		fsys:    fsys,
+		fn:      fn,
+		workers: workers,
+		sem:     make(chan struct{}, workers),
+		stop:    make(chan struct{}),
+	}
+	w.cond = sync.NewCond(&w.mu)
+	return w
+}
+
+// run visits root the way fs.WalkDir does and hands the root directory to
+// walkRoot when fn accepts it. It then waits for every outstanding read.
+func (w *parallelWalker) run(root string, walkRoot func(name string, d fs.DirEntry) error) error {
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+
+	var err error
+	info, statErr := fs.Stat(w.fsys, root)
+	if statErr != nil {
+		err = w.fn(root, nil, statErr)
+	} else {
+		d := fs.FileInfoToDirEntry(info)
+		err = w.fn(root, d, nil)
+		if err == nil && d.IsDir() {
+			err = walkRoot(root, d)
+		}
+	}
+	if err != nil {
+		w.halt(err)
+	}
+	w.wg.Wait()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if errors.Is(w.err, fs.SkipDir) || errors.Is(w.err, fs.SkipAll) {
+		return nil
+	}
+	return w.err
+}
+
+// halt records err as the result of the walk, unless one has already been
+// recorded, and tells outstanding reads to stop. The caller must not hold mu.
+func (w *parallelWalker) halt(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.haltLocked(err)
+}
+
+func (w *parallelWalker) haltLocked(err error) {
+	if w.stopped {
+		return
+	}
+	w.stopped = true
+	w.err = err
+	close(w.stop)
+	w.cond.Broadcast()
+}
+
+// acquire waits for a read slot. It returns false if the walk has ended or
+// ctx has been canceled in the meantime.
+func (w *parallelWalker) acquire() bool {
+	select {
+	case w.sem <- struct{}{}:
+		return true
+	case <-w.stop:
+		return false
+	case <-w.ctx.Done():
+		w.halt(w.ctx.Err())
+		return false
+	}
+}
+
+// work reads directories from the queue until it is empty and no other
+// worker can add to it, or the walk ends.
+func (w *parallelWalker) work() {
+	defer w.wg.Done()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for {
+		for len(w.queue) == 0 && w.pending > 0 && !w.stopped {
+			w.cond.Wait()
+		}
+		if w.stopped || w.pending == 0 {
+			return
+		}
+		// Taking the most recent directory keeps the queue short in deep
+		// trees.
+		job := w.queue[len(w.queue)-1]
+		w.queue = w.queue[:len(w.queue)-1]
+
+		w.mu.Unlock()
+		entries, err := fs.ReadDir(w.fsys, job.name)
+		w.mu.Lock()
+
+		if !w.stopped {
+			w.visit(job, entries, err)
+		}
+		if w.pending--; w.pending == 0 {
+			w.cond.Broadcast()
+		}
+	}
+}
+
+// visit calls fn for each entry of the directory read for job, queueing the
+// subdirectories fn accepts. The caller must hold mu.
+func (w *parallelWalker) visit(job dirJob, entries []fs.DirEntry, readErr error) {
+	if readErr != nil {
+		if err := w.fn(job.name, job.d, readErr); err != nil {
+			if !errors.Is(err, fs.SkipDir) {
+				w.haltLocked(err)
+			}
+			return
+		}
+	}
+	for _, entry := range entries {
+		if err := w.ctx.Err(); err != nil {
+			w.haltLocked(err)
+			return
+		}
+		child := path.Join(job.name, entry.Name())
+		err := w.fn(child, entry, nil)
+		switch {
+		case errors.Is(err, fs.SkipDir):
+			if entry.IsDir() {
+				continue
+			}
+			return
+		case err != nil:
+			w.haltLocked(err)
+			return
+		}
+		if entry.IsDir() {
+			w.queue = append(w.queue, dirJob{child, entry})
+			w.pending++
+			w.cond.Signal()
+		}
+	}
+}
+
+// dirFuture is a directory read that may still be in progress.
+type dirFuture struct {
+	done    chan struct{}
+	entries []fs.DirEntry
+	err     error
+}
+
+// prefetch starts reading the directory name in the background.
+func (w *parallelWalker) prefetch(name string) *dirFuture {
+	f := &dirFuture{done: make(chan struct{})}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer close(f.done)
+		if !w.acquire() {
+			f.err = errWalkStopped
+			return
+		}
+		f.entries, f.err = fs.ReadDir(w.fsys, name)
+		<-w.sem
+	}()
+	return f
+}
+
+// errWalkStopped is the result of a prefetch abandoned because the walk
+// ended. It never reaches fn or the caller.
+var errWalkStopped = errors.New("walk stopped")
+
+// wait returns the result of the read, or the reason the walk ended.
+func (f *dirFuture) wait(w *parallelWalker) ([]fs.DirEntry, error) {
+	select {
+	case <-f.done:
+	case <-w.ctx.Done():
+		return nil, w.ctx.Err()
+	}
+	if f.err == errWalkStopped {
+		return nil, w.ctx.Err()
+	}
+	return f.entries, f.err
+}
+
+// visitOrdered calls fn for the entries of the directory name, whose read
+// has been started as f, descending into subdirectories depth first. Reads of
+// the next workers subdirectories are started before their turn comes.
+func (w *parallelWalker) visitOrdered(name string, d fs.DirEntry, f *dirFuture) error {
+	entries, err := f.wait(w)
+	if err != nil {
+		if ctxErr := w.ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err = w.fn(name, d, err); err != nil {
+			if errors.Is(err, fs.SkipDir) && d.IsDir() {
+				err = nil
+			}
+			return err
+		}
+	}
+
+	futures := make([]*dirFuture, len(entries))
+	next, ahead := 0, 0
+	for i, entry := range entries {
+		// Keep up to workers reads in flight ahead of the callbacks.
+		for ; next < len(entries) && ahead < w.workers; next++ {
+			if entries[next].IsDir() {
+				futures[next] = w.prefetch(path.Join(name, entries[next].Name()))
+				ahead++
+			}
+		}
+		if entry.IsDir() {
+			ahead--
+		}
+
+		if err := w.ctx.Err(); err != nil {
+			return err
+		}
+		child := path.Join(name, entry.Name())
+		err := w.fn(child, entry, nil)
+		switch {
+		case errors.Is(err, fs.SkipDir):
+			if entry.IsDir() {
+				continue
+			}
+			return nil
+		case err != nil:
+			return err
+		}
+		if entry.IsDir() {
+			if err := w.visitOrdered(child, entry, futures[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,284 @@
+package gofs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/absfs/memfs"
+)
+
+// setupWalkFS creates a tree of width directories per level, depth levels
+// deep, below the directory "root". Every directory holds one file.
+func setupWalkFS(t *testing.T, width, depth int) FileSystem {
+	t.Helper()
+	mfs, err := memfs.NewFS()
+	if err != nil {
+		t.Fatalf("Failed to create memfs: %v", err)
+	}
+	var mk func(dir string, level int)
+	mk = func(dir string, level int) {
+		if err := mfs.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory %s: %v", dir, err)
+		}
+		if err := writeFile(mfs, dir+"/file.txt", []byte(dir)); err != nil {
+			t.Fatalf("Failed to write file in %s: %v", dir, err)
+		}
+		if level == depth {
+			return
+		}
+		for i := 0; i < width; i++ {
+			mk(fmt.Sprintf("%s/d%d", dir, i), level+1)
+		}
+	}
+	mk("root", 0)
+	gfs, err := NewFs(mfs)
+	if err != nil {
+		t.Fatalf("Failed to create gofs: %v", err)
+	}
+	return gfs
+}
+
+// slowFS delays every ReadDir and records the peak number of concurrent calls
+// and of running goroutines.
+type slowFS struct {
+	fs.FS
+	delay time.Duration
+
+	mu            sync.Mutex
+	active        int
+	maxSeen       int
+	maxGoroutines int
+}
+
+func (s *slowFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	s.mu.Lock()
+	s.active++
+	if s.active > s.maxSeen {
+		s.maxSeen = s.active
+	}
+	s.maxGoroutines = max(s.maxGoroutines, runtime.NumGoroutine())
+	s.mu.Unlock()
+
+	time.Sleep(s.delay)
+
+	s.mu.Lock()
+	s.active--
+	s.mu.Unlock()
+	return fs.ReadDir(s.FS, name)
+}
+
+// collectWalk returns the paths fs.WalkDir visits, for comparison.
+func collectWalk(t *testing.T, fsys fs.FS, root string, fn fs.WalkDirFunc) []string {
+	t.Helper()
+	var got []string
+	err := fs.WalkDir(fsys, root, func(name string, d fs.DirEntry, err error) error {
+		got = append(got, name)
+		return fn(name, d, err)
+	})
+	if err != nil {
+		t.Fatalf("fs.WalkDir() failed: %v", err)
+	}
+	return got
+}
+
+func TestWalkParallel(t *testing.T) {
+	gfs := setupWalkFS(t, 3, 3)
+	ctx := context.Background()
+	ok := func(string, fs.DirEntry, error) error { return nil }
+
+	t.Run("visits every path", func(t *testing.T) {
+		var got []string
+		err := WalkParallel(ctx, gfs, "root", 4, func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			got = append(got, name)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("WalkParallel() failed: %v", err)
+		}
+		want := collectWalk(t, gfs, "root", ok)
+		sort.Strings(got)
+		sort.Strings(want)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("WalkParallel() visited %d paths, want %d", len(got), len(want))
+		}
+	})
+
+	t.Run("reads concurrently within bound", func(t *testing.T) {
+		slow := &slowFS{FS: gfs, delay: 5 * time.Millisecond}
+		if err := WalkParallel(ctx, slow, "root", 3, ok); err != nil {
+			t.Fatalf("WalkParallel() failed: %v", err)
+		}
+		if slow.maxSeen < 2 || slow.maxSeen > 3 {
+			t.Errorf("peak concurrent reads = %d, want between 2 and 3", slow.maxSeen)
+		}
+	})
+
+	t.Run("bounded goroutines", func(t *testing.T) {
+		slow := &slowFS{FS: gfs, delay: time.Millisecond}
+		before := runtime.NumGoroutine()
+		if err := WalkParallel(ctx, slow, "root", 2, ok); err != nil {
+			t.Fatalf("WalkParallel() failed: %v", err)
+		}
+		if extra := slow.maxGoroutines - before; extra > 2 {
+			t.Errorf("WalkParallel() ran %d extra goroutines, want at most 2", extra)
+		}
+	})
+
+	t.Run("skip dir", func(t *testing.T) {
+		var got []string
+		err := WalkParallel(ctx, gfs, "root", 4, func(name string, d fs.DirEntry, err error) error {
+			got = append(got, name)
+			if name == "root/d1" {
+				return fs.SkipDir
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("WalkParallel() failed: %v", err)
+		}
+		for _, name := range got {
+			if strings.HasPrefix(name, "root/d1/") {
+				t.Errorf("WalkParallel() visited %q inside skipped directory", name)
+			}
+		}
+	})
+
+	t.Run("skip all", func(t *testing.T) {
+		calls := 0
+		err := WalkParallel(ctx, gfs, "root", 4, func(name string, d fs.DirEntry, err error) error {
+			calls++
+			if calls == 5 {
+				return fs.SkipAll
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("WalkParallel() error = %v, want nil", err)
+		}
+		if calls != 5 {
+			t.Errorf("fn called %d times after SkipAll, want 5", calls)
+		}
+	})
+
+	t.Run("error stops walk", func(t *testing.T) {
+		errStop := errors.New("stop")
+		err := WalkParallel(ctx, gfs, "root", 4, func(name string, d fs.DirEntry, err error) error {
+			if name == "root/d2/d0" {
+				return errStop
+			}
+			return nil
+		})
+		if !errors.Is(err, errStop) {
+			t.Errorf("WalkParallel() error = %v, want %v", err, errStop)
+		}
+	})
+
+	t.Run("canceled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		slow := &slowFS{FS: gfs, delay: time.Millisecond}
+		err := WalkParallel(ctx, slow, "root", 2, func(name string, d fs.DirEntry, err error) error {
+			cancel()
+			return nil
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("WalkParallel() error = %v, want context.Canceled", err)
+		}
+	})
+
+	t.Run("missing root", func(t *testing.T) {
+		err := WalkParallel(ctx, gfs, "missing", 2, func(name string, d fs.DirEntry, err error) error {
+			return err
+		})
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("WalkParallel() error = %v, want fs.ErrNotExist", err)
+		}
+	})
+}
+
+func TestWalkParallelOrdered(t *testing.T) {
+	gfs := setupWalkFS(t, 3, 3)
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		fn   func(name string, d fs.DirEntry) error
+	}{
+		{"all", func(string, fs.DirEntry) error { return nil }},
+		{"skip dir", func(name string, d fs.DirEntry) error {
+			if name == "root/d1" || name == "root/d2/d2" {
+				return fs.SkipDir
+			}
+			return nil
+		}},
+		{"skip rest of directory from file", func(name string, d fs.DirEntry) error {
+			if name == "root/d0/d1/file.txt" {
+				return fs.SkipDir
+			}
+			return nil
+		}},
+		{"skip all", func(name string, d fs.DirEntry) error {
+			if name == "root/d1/d1" {
+				return fs.SkipAll
+			}
+			return nil
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := collectWalk(t, gfs, "root", func(name string, d fs.DirEntry, err error) error {
+				return tt.fn(name, d)
+			})
+			slow := &slowFS{FS: gfs, delay: time.Millisecond}
+			var got []string
+			err := WalkParallelOrdered(ctx, slow, "root", 4, func(name string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				got = append(got, name)
+				return tt.fn(name, d)
+			})
+			if err != nil {
+				t.Fatalf("WalkParallelOrdered() failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("WalkParallelOrdered() order =\n%v\nwant\n%v", got, want)
+			}
+		})
+	}
+
+	t.Run("reads ahead concurrently", func(t *testing.T) {
+		slow := &slowFS{FS: gfs, delay: 5 * time.Millisecond}
+		err := WalkParallelOrdered(ctx, slow, "root", 3, func(string, fs.DirEntry, error) error { return nil })
+		if err != nil {
+			t.Fatalf("WalkParallelOrdered() failed: %v", err)
+		}
+		if slow.maxSeen < 2 || slow.maxSeen > 3 {
+			t.Errorf("peak concurrent reads = %d, want between 2 and 3", slow.maxSeen)
+		}
+	})
+
+	t.Run("canceled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		err := WalkParallelOrdered(ctx, gfs, "root", 2, func(name string, d fs.DirEntry, err error) error {
+			if name == "root/d0" {
+				cancel()
+			}
+			return nil
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("WalkParallelOrdered() error = %v, want context.Canceled", err)
+		}
+	})
+}
@@ -0,0 +1,402 @@
+package gofs
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Op describes the kind of change reported by an Event.
+type Op int
+
+const (
+	// Create reports that a path was added.
+	Create Op = iota + 1
+
+	// Modify reports that a file's size, modification time, mode or
+	// contents changed.
+	Modify
+
+	// Remove reports that a path no longer exists.
+	Remove
+
+	// Rename reports that a path was moved from Event.OldPath to Event.Path.
+	Rename
+)
+
+// String returns the name of the operation.
+func (op Op) String() string {
+	switch op {
+	case Create:
+		return "CREATE"
+	case Modify:
+		return "MODIFY"
+	case Remove:
+		return "REMOVE"
+	case Rename:
+		return "RENAME"
+	}
+	return "Op(" + strconv.Itoa(int(op)) + ")"
+}
+
+// Event is a change detected by a Watcher.
+type Event struct {
+	Op Op
+
+	// Path is the name of the changed file, relative to the watched fs.FS.
+	Path string
+
+	// OldPath is the previous name of a renamed file. It is empty for every
+	// other operation.
+	OldPath string
+}
+
+// String returns a human-readable form of the event.
+func (e Event) String() string {
+	if e.Op == Rename {
+		return e.Op.String() + " " + e.OldPath + " -> " + e.Path
+	}
+	return e.Op.String() + " " + e.Path
+}
+
+// Clock is the source of time used by a Watcher. Tests can supply a fake
+// clock to drive polling deterministically.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock is the Clock backed by the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Watcher polls an fs.FS for changes. Because absfs backends have no change
+// notification, a Watcher takes a snapshot of every watched path on each
+// poll using Stat and ReadDir and reports the differences.
+//
+// A file is considered modified when its size, modification time or mode
+// changes, or, if Hash is set, when the digest of its contents changes. A
+// file that disappears in the same poll that another file with the same
+// size, modification time and mode (and digest, if hashed) appears is
+// reported as a Rename.
+//
+// The zero value polls once a second, non-recursively, without hashing or
+// debouncing.
+type Watcher struct {
+	// Interval is the time between polls. Zero means one second.
+	Interval time.Duration
+
+	// Recursive makes a watched directory include every file below it,
+	// rather than only its direct entries.
+	Recursive bool
+
+	// Include, if non-empty, restricts events to paths matching at least
+	// one of these patterns. Patterns use the GlobAll syntax and are matched
+	// against the full path. Directories are traversed regardless.
+	Include []string
+
+	// Exclude lists patterns, in the GlobAll syntax, for paths to ignore.
+	// Excluded directories are not traversed.
+	Exclude []string
+
+	// Hash, if non-zero, is used to digest the contents of every regular
+	// file on each poll, detecting modifications that leave size and
+	// modification time unchanged.
+	Hash crypto.Hash
+
+	// Debounce delays reporting a path until it has gone this long without
+	// further changes, so a burst of writes produces a single event.
+	// Changes are merged while pending: for example a create followed by a
+	// modify is reported as one Create, and a create followed by a remove
+	// is not reported at all.
+	Debounce time.Duration
+
+	// Clock is the source of time. Nil means the real clock.
+	Clock Clock
+}
+
+// Watch polls the given paths of fsys every interval, recursively, and
+// reports changes on the returned channel until ctx is canceled, at which
+// point the channel is closed. It is shorthand for a Watcher with Interval
+// and Recursive set; use a Watcher directly for debouncing, hashing or
+// filtering.
+func Watch(ctx context.Context, fsys fs.FS, paths []string, interval time.Duration) <-chan Event {
+	w := &Watcher{Interval: interval, Recursive: true}
+	return w.Watch(ctx, fsys, paths)
+}
+
+// Watch starts polling the given paths of fsys and reports changes on the
+// returned channel until ctx is canceled, at which point the channel is
+// closed. The first poll happens immediately and establishes the baseline;
+// it produces no events. Events from the same poll are delivered in path
+// order.
+//
+// Invalid Include or Exclude patterns never match. The Watcher must not be
+// modified while a watch is running.
+func (w *Watcher) Watch(ctx context.Context, fsys fs.FS, paths []string) <-chan Event {
+	ch := make(chan Event)
+	clock := w.Clock
+	if clock == nil {
+		clock = realClock{}
+	}
+	interval := w.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	s := &watchScanner{w: w, fsys: fsys}
+	s.include = compilePatterns(w.Include)
+	s.exclude = compilePatterns(w.Exclude)
+
+	go func() {
+		defer close(ch)
+		prev := s.scan(paths)
+		pending := make(map[string]*pendingEvent)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-clock.After(interval):
+			}
+
+			cur := s.scan(paths)
+			now := clock.Now()
+			for _, ev := range diffSnapshots(prev, cur, w.Hash != 0) {
+				mergePending(pending, ev, now)
+			}
+			prev = cur
+
+			for _, ev := range duePending(pending, now, w.Debounce) {
+				select {
+				case ch <- ev:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return ch
+}
+
+// fileState is what a Watcher remembers about a path between polls.
+type fileState struct {
+	size    int64
+	modTime time.Time
+	mode    fs.FileMode
+	digest  []byte
+}
+
+// watchScanner takes snapshots of the watched paths.
+type watchScanner struct {
+	w       *Watcher
+	fsys    fs.FS
+	include []*globMatcher
+	exclude []*globMatcher
+}
+
+// compilePatterns compiles GlobAll-style patterns, dropping invalid ones.
+func compilePatterns(patterns []string) []*globMatcher {
+	var ms []*globMatcher
+	for _, p := range patterns {
+		if m, err := compileGlob(p, true, false); err == nil {
+			ms = append(ms, m)
+		}
+	}
+	return ms
+}
+
+// scan returns the current state of every watched path.
+func (s *watchScanner) scan(paths []string) map[string]fileState {
+	snap := make(map[string]fileState)
+	for _, p := range paths {
+		info, err := fs.Stat(s.fsys, p)
+		if err != nil || s.excluded(p) {
+			continue
+		}
+		s.record(snap, p, info)
+		if info.IsDir() {
+			s.scanDir(snap, p, s.w.Recursive)
+		}
+	}
+	return snap
+}
+
+// scanDir records the entries of dir, descending if recursive is set.
+func (s *watchScanner) scanDir(snap map[string]fileState, dir string, recursive bool) {
+	entries, err := fs.ReadDir(s.fsys, dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		name := path.Join(dir, entry.Name())
+		if s.excluded(name) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		s.record(snap, name, info)
+		if recursive && entry.IsDir() {
+			s.scanDir(snap, name, true)
+		}
+	}
+}
+
+// record adds name to snap if it passes the Include filter.
+func (s *watchScanner) record(snap map[string]fileState, name string, info fs.FileInfo) {
+	if len(s.include) > 0 && !matchAny(s.include, name) {
+		return
+	}
+	st := fileState{size: info.Size(), modTime: info.ModTime(), mode: info.Mode()}
+	if s.w.Hash != 0 && info.Mode().IsRegular() {
+		st.digest, _ = HashFile(s.fsys, name, s.w.Hash)
+	}
+	snap[name] = st
+}
+
+func (s *watchScanner) excluded(name string) bool {
+	return matchAny(s.exclude, name)
+}
+
+func matchAny(ms []*globMatcher, name string) bool {
+	for _, m := range ms {
+		if m.match(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// diffSnapshots returns the events that turn prev into cur, pairing removed
+// and created paths with identical state into renames.
+func diffSnapshots(prev, cur map[string]fileState, hashed bool) []Event {
+	var created, removed []string
+	var events []Event
+	for name, st := range cur {
+		old, ok := prev[name]
+		switch {
+		case !ok:
+			created = append(created, name)
+		case changed(old, st, hashed):
+			events = append(events, Event{Op: Modify, Path: name})
+		}
+	}
+	for name := range prev {
+		if _, ok := cur[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(created)
+	sort.Strings(removed)
+
+	paired := make(map[string]bool)
+	for _, old := range removed {
+		match := ""
+		for _, name := range created {
+			if !paired[name] && sameFile(prev[old], cur[name], hashed) {
+				match = name
+				break
+			}
+		}
+		if match == "" {
+			events = append(events, Event{Op: Remove, Path: old})
+			continue
+		}
+		paired[match] = true
+		events = append(events, Event{Op: Rename, Path: match, OldPath: old})
+	}
+	for _, name := range created {
+		if !paired[name] {
+			events = append(events, Event{Op: Create, Path: name})
+		}
+	}
+	return events
+}
+
+// changed reports whether a path present in both snapshots was modified.
+// Directories only change when their type does, since their size and
+// modification time change whenever an entry is added or removed, which
+// is already reported for the entry itself.
+func changed(old, cur fileState, hashed bool) bool {
+	if old.mode.IsDir() && cur.mode.IsDir() {
+		return false
+	}
+	if old.size != cur.size || !old.modTime.Equal(cur.modTime) || old.mode != cur.mode {
+		return true
+	}
+	return hashed && !bytes.Equal(old.digest, cur.digest)
+}
+
+// sameFile reports whether two states plausibly describe the same file,
+// for rename detection.
+func sameFile(a, b fileState, hashed bool) bool {
+	if a.mode != b.mode || a.size != b.size || !a.modTime.Equal(b.modTime) {
+		return false
+	}
+	return !hashed || bytes.Equal(a.digest, b.digest)
+}
+
+// pendingEvent is an event waiting out the debounce period.
+type pendingEvent struct {
+	Event
+	last time.Time
+}
+
+// mergePending folds ev into the pending events, keyed by path.
+func mergePending(pending map[string]*pendingEvent, ev Event, now time.Time) {
+	if ev.Op == Rename {
+		if old, ok := pending[ev.OldPath]; ok {
+			delete(pending, ev.OldPath)
+			switch old.Op {
+			case Create:
+				// Created and renamed while pending: a create at the new name.
+				ev = Event{Op: Create, Path: ev.Path}
+			case Rename:
+				// Renamed twice: report the original name.
+				ev.OldPath = old.OldPath
+			}
+		}
+	}
+
+	p, ok := pending[ev.Path]
+	if !ok {
+		pending[ev.Path] = &pendingEvent{Event: ev, last: now}
+		return
+	}
+	p.last = now
+	switch {
+	case p.Op == Create && ev.Op == Remove:
+		delete(pending, ev.Path)
+	case p.Op == Rename && ev.Op == Remove:
+		// Renamed and then removed: the original name is what disappeared.
+		delete(pending, ev.Path)
+		mergePending(pending, Event{Op: Remove, Path: p.OldPath}, now)
+	case p.Op == Create, p.Op == Rename && ev.Op == Modify:
+		// A create or rename followed by modifications keeps its kind.
+	case p.Op == Remove && ev.Op == Create:
+		p.Event = Event{Op: Modify, Path: ev.Path}
+	default:
+		p.Event = ev
+	}
+}
+
+// duePending removes and returns, in path order, the pending events that
+// have been quiet for at least debounce.
+func duePending(pending map[string]*pendingEvent, now time.Time, debounce time.Duration) []Event {
+	var due []Event
+	for name, p := range pending {
+		if now.Sub(p.last) >= debounce {
+			due = append(due, p.Event)
+			delete(pending, name)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].Path < due[j].Path })
+	return due
+}
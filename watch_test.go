@@ -0,0 +1,303 @@
+package gofs
+
+import (
+	"context"
+	"crypto"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/absfs/memfs"
+)
+
+// fakeClock is a Clock whose time only moves when Advance is called.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+	added   chan struct{}
+}
+
+type fakeWaiter struct {
+	when time.Time
+	ch   chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(1e9, 0), added: make(chan struct{}, 100)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	c.waiters = append(c.waiters, fakeWaiter{c.now.Add(d), ch})
+	c.added <- struct{}{}
+	return ch
+}
+
+// waitForWaiter blocks until some goroutine is waiting in After.
+func (c *fakeClock) waitForWaiter(t *testing.T) {
+	t.Helper()
+	select {
+	case <-c.added:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the watcher to poll")
+	}
+}
+
+// Advance moves the clock forward, firing every timer that falls due.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	kept := c.waiters[:0]
+	for _, w := range c.waiters {
+		if !w.when.After(c.now) {
+			w.ch <- c.now
+			continue
+		}
+		kept = append(kept, w)
+	}
+	c.waiters = kept
+}
+
+// watchHarness runs a Watcher against memfs with a fake clock.
+type watchHarness struct {
+	t      *testing.T
+	mfs    *memfs.FileSystem
+	clock  *fakeClock
+	events <-chan Event
+}
+
+func startWatch(t *testing.T, w *Watcher, setup func(*memfs.FileSystem), paths ...string) *watchHarness {
+	t.Helper()
+	mfs, err := memfs.NewFS()
+	if err != nil {
+		t.Fatalf("Failed to create memfs: %v", err)
+	}
+	setup(mfs)
+	gfs, _ := NewFs(mfs)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	clock := newFakeClock()
+	w.Clock = clock
+	if w.Interval == 0 {
+		w.Interval = time.Second
+	}
+	h := &watchHarness{t: t, mfs: mfs, clock: clock, events: w.Watch(ctx, gfs, paths)}
+	clock.waitForWaiter(t) // baseline scan done
+	return h
+}
+
+// poll advances the clock by one interval and returns the events delivered
+// by the resulting poll.
+func (h *watchHarness) poll(d time.Duration) []Event {
+	h.t.Helper()
+	h.clock.Advance(d)
+	var got []Event
+	for {
+		select {
+		case ev := <-h.events:
+			got = append(got, ev)
+		case <-h.clock.added:
+			return got
+		case <-time.After(5 * time.Second):
+			h.t.Fatal("timed out waiting for poll to finish")
+		}
+	}
+}
+
+func (h *watchHarness) write(name, content string) {
+	h.t.Helper()
+	if err := writeFile(h.mfs, name, []byte(content)); err != nil {
+		h.t.Fatal(err)
+	}
+}
+
+func mkdirs(mfs *memfs.FileSystem, dirs ...string) {
+	for _, dir := range dirs {
+		mfs.Mkdir(dir, 0755)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	t.Run("create modify remove", func(t *testing.T) {
+		h := startWatch(t, &Watcher{Recursive: true}, func(m *memfs.FileSystem) {
+			mkdirs(m, "conf")
+			writeFile(m, "conf/a.yaml", []byte("a"))
+		}, "conf")
+
+		if got := h.poll(time.Second); len(got) != 0 {
+			t.Errorf("poll without changes = %v, want none", got)
+		}
+
+		h.write("conf/b.yaml", "b")
+		h.write("conf/a.yaml", "changed")
+		want := []Event{{Op: Modify, Path: "conf/a.yaml"}, {Op: Create, Path: "conf/b.yaml"}}
+		if got := h.poll(time.Second); !reflect.DeepEqual(got, want) {
+			t.Errorf("poll = %v, want %v", got, want)
+		}
+
+		h.mfs.Remove("conf/b.yaml")
+		want = []Event{{Op: Remove, Path: "conf/b.yaml"}}
+		if got := h.poll(time.Second); !reflect.DeepEqual(got, want) {
+			t.Errorf("poll = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("rename", func(t *testing.T) {
+		h := startWatch(t, &Watcher{Recursive: true}, func(m *memfs.FileSystem) {
+			mkdirs(m, "conf")
+			writeFile(m, "conf/old.yaml", []byte("data"))
+		}, "conf")
+
+		if err := h.mfs.Rename("conf/old.yaml", "conf/new.yaml"); err != nil {
+			t.Fatal(err)
+		}
+		want := []Event{{Op: Rename, Path: "conf/new.yaml", OldPath: "conf/old.yaml"}}
+		if got := h.poll(time.Second); !reflect.DeepEqual(got, want) {
+			t.Errorf("poll = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("recursive", func(t *testing.T) {
+		setup := func(m *memfs.FileSystem) { mkdirs(m, "tpl", "tpl/partials") }
+
+		h := startWatch(t, &Watcher{Recursive: true}, setup, "tpl")
+		h.write("tpl/partials/nav.html", "nav")
+		want := []Event{{Op: Create, Path: "tpl/partials/nav.html"}}
+		if got := h.poll(time.Second); !reflect.DeepEqual(got, want) {
+			t.Errorf("recursive poll = %v, want %v", got, want)
+		}
+
+		h = startWatch(t, &Watcher{}, setup, "tpl")
+		h.write("tpl/partials/nav.html", "nav")
+		if got := h.poll(time.Second); len(got) != 0 {
+			t.Errorf("non-recursive poll = %v, want none", got)
+		}
+	})
+
+	t.Run("include and exclude", func(t *testing.T) {
+		w := &Watcher{
+			Recursive: true,
+			Include:   []string{"**/*.html"},
+			Exclude:   []string{"site/cache"},
+		}
+		h := startWatch(t, w, func(m *memfs.FileSystem) { mkdirs(m, "site", "site/cache") }, "site")
+		h.write("site/index.html", "index")
+		h.write("site/notes.txt", "ignored")
+		h.write("site/cache/page.html", "ignored")
+		want := []Event{{Op: Create, Path: "site/index.html"}}
+		if got := h.poll(time.Second); !reflect.DeepEqual(got, want) {
+			t.Errorf("poll = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("hash detects same-size same-mtime change", func(t *testing.T) {
+		mtime := time.Unix(1e9, 0)
+		setup := func(m *memfs.FileSystem) {
+			writeFile(m, "a.txt", []byte("aaaa"))
+			m.Chtimes("a.txt", mtime, mtime)
+		}
+		rewrite := func(h *watchHarness) {
+			h.write("a.txt", "bbbb")
+			h.mfs.Chtimes("a.txt", mtime, mtime)
+		}
+
+		h := startWatch(t, &Watcher{}, setup, "a.txt")
+		rewrite(h)
+		if got := h.poll(time.Second); len(got) != 0 {
+			t.Errorf("poll without hashing = %v, want none", got)
+		}
+
+		h = startWatch(t, &Watcher{Hash: crypto.SHA256}, setup, "a.txt")
+		rewrite(h)
+		want := []Event{{Op: Modify, Path: "a.txt"}}
+		if got := h.poll(time.Second); !reflect.DeepEqual(got, want) {
+			t.Errorf("poll with hashing = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("debounce", func(t *testing.T) {
+		w := &Watcher{Recursive: true, Debounce: 3 * time.Second}
+		h := startWatch(t, w, func(m *memfs.FileSystem) { mkdirs(m, "d") }, "d")
+
+		h.write("d/burst.txt", "1")
+		if got := h.poll(time.Second); len(got) != 0 {
+			t.Errorf("poll during burst = %v, want none", got)
+		}
+		h.write("d/burst.txt", "12")
+		if got := h.poll(time.Second); len(got) != 0 {
+			t.Errorf("poll during burst = %v, want none", got)
+		}
+		if got := h.poll(time.Second); len(got) != 0 {
+			t.Errorf("poll before quiet period = %v, want none", got)
+		}
+		want := []Event{{Op: Create, Path: "d/burst.txt"}}
+		if got := h.poll(2 * time.Second); !reflect.DeepEqual(got, want) {
+			t.Errorf("poll after quiet period = %v, want %v", got, want)
+		}
+
+		// A file created and removed within the window is never reported.
+		h.write("d/tmp.txt", "x")
+		h.poll(time.Second)
+		h.mfs.Remove("d/tmp.txt")
+		h.poll(time.Second)
+		if got := h.poll(5 * time.Second); len(got) != 0 {
+			t.Errorf("poll = %v, want none for transient file", got)
+		}
+	})
+
+	t.Run("closes on cancel", func(t *testing.T) {
+		mfs, _ := memfs.NewFS()
+		gfs, _ := NewFs(mfs)
+		ctx, cancel := context.WithCancel(context.Background())
+		events := Watch(ctx, gfs, []string{"missing"}, time.Hour)
+		cancel()
+		select {
+		case _, ok := <-events:
+			if ok {
+				t.Error("received event after cancel")
+			}
+		case <-time.After(5 * time.Second):
+			t.Error("channel not closed after cancel")
+		}
+	})
+}
+
+func TestMergePending(t *testing.T) {
+	now := time.Unix(0, 0)
+	tests := []struct {
+		name   string
+		events []Event
+		want   []Event
+	}{
+		{"create then modify", []Event{{Op: Create, Path: "a"}, {Op: Modify, Path: "a"}}, []Event{{Op: Create, Path: "a"}}},
+		{"create then remove", []Event{{Op: Create, Path: "a"}, {Op: Remove, Path: "a"}}, nil},
+		{"remove then create", []Event{{Op: Remove, Path: "a"}, {Op: Create, Path: "a"}}, []Event{{Op: Modify, Path: "a"}}},
+		{"modify then remove", []Event{{Op: Modify, Path: "a"}, {Op: Remove, Path: "a"}}, []Event{{Op: Remove, Path: "a"}}},
+		{"create then rename", []Event{{Op: Create, Path: "a"}, {Op: Rename, Path: "b", OldPath: "a"}}, []Event{{Op: Create, Path: "b"}}},
+		{"rename then remove", []Event{{Op: Rename, Path: "b", OldPath: "a"}, {Op: Remove, Path: "b"}}, []Event{{Op: Remove, Path: "a"}}},
+		{"rename twice", []Event{{Op: Rename, Path: "b", OldPath: "a"}, {Op: Rename, Path: "c", OldPath: "b"}}, []Event{{Op: Rename, Path: "c", OldPath: "a"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pending := make(map[string]*pendingEvent)
+			for _, ev := range tt.events {
+				mergePending(pending, ev, now)
+			}
+			if got := duePending(pending, now, 0); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("merged = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}